@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrDuplicateEndpoint is returned by API.Register when another Endpoint with
+// the same name has already been registered.
+var ErrDuplicateEndpoint error = errors.New("Endpoint name already registered")
+
+// Middleware wraps an http.Handler with additional behavior, such as request
+// logging or panic recovery.
+type Middleware func(http.Handler) http.Handler
+
+// API groups many Endpoints under a common base path, so they can be served
+// by a single http.Handler with shared defaults.
+type API struct {
+	// BasePath is prepended to every Endpoint's path. For instance, if
+	// BasePath is "/api" then an Endpoint named "yams" answers at "/api/yams"
+	// and "/api/yams/{id}".
+	BasePath string
+	// Codec, if not nil, is used by Endpoints whose own Codec has no Marshal
+	// or Render function.
+	Codec *Codec
+	// Logger is used by Endpoints that have no Logger of their own. If both
+	// are nil, log messages go to standard output.
+	Logger Logger
+	// Tracer is used by Endpoints that have no Tracer of their own.
+	Tracer Tracer
+	// StatusCodeLookup holds error mappings shared by all Endpoints. An
+	// Endpoint's own StatusCodeLookup takes precedence for any error it maps.
+	StatusCodeLookup map[error]int
+	// Middleware is applied to every request the API handles, in order, so
+	// the first Middleware is the outermost.
+	Middleware []Middleware
+	// BatchPath, if not empty, is where (under BasePath) the API takes POSTs
+	// of several requests at once, such as "/batch". The body is a JSON array
+	// of BatchRequests, which run in order through the API's Endpoints, and
+	// the response is a 207 (Multi-Status) with a JSON array of
+	// BatchResponses. Each batched request passes through Middleware, as the
+	// batch itself does. Batched requests inherit the Accept, Authorization,
+	// Cookie and traceparent headers of the batch. No Endpoint may be named
+	// after BatchPath.
+	BatchPath string
+
+	endpoints []*Endpoint
+	names     map[string]bool
+}
+
+// NewAPI returns an empty API serving under basePath.
+func NewAPI(basePath string) *API {
+	return &API{
+		BasePath:         strings.TrimRight(basePath, "/"),
+		StatusCodeLookup: map[error]int{},
+		names:            map[string]bool{},
+	}
+}
+
+// Register adds e to the API. It returns ErrDuplicateEndpoint if an Endpoint
+// of the same name is already registered, or if e would answer at BatchPath.
+func (a *API) Register(e *Endpoint) error {
+	if a.names == nil {
+		a.names = map[string]bool{}
+	}
+	if a.names[e.Name] || a.BatchPath == "/"+e.Name {
+		return ErrDuplicateEndpoint
+	}
+	a.names[e.Name] = true
+	a.endpoints = append(a.endpoints, e)
+	return nil
+}
+
+// Endpoints returns the registered Endpoints in registration order.
+func (a *API) Endpoints() []*Endpoint {
+	return append([]*Endpoint(nil), a.endpoints...)
+}
+
+// resolve returns a copy of e with the API's defaults filled in. The
+// registered Endpoint itself is left untouched.
+func (a *API) resolve(e *Endpoint) *Endpoint {
+	c := *e
+	if c.Codec.Marshal == nil && c.Codec.Render == nil && a.Codec != nil {
+		c.Codec = *a.Codec
+	}
+	if c.Logger == nil {
+		c.Logger = a.Logger
+	}
+	if c.Logger == nil && c.RequestLogger == nil {
+		c.Logger = IOLogger{os.Stdout}
+	}
+	if c.Tracer == nil {
+		c.Tracer = a.Tracer
+	}
+	c.StatusCodeLookup = map[error]int{}
+	for err, code := range a.StatusCodeLookup {
+		c.StatusCodeLookup[err] = code
+	}
+	for err, code := range e.StatusCodeLookup {
+		c.StatusCodeLookup[err] = code
+	}
+	return &c
+}
+
+// Router registers the whole API on m under BasePath, and returns m. If the
+// calling function passes nil for m, Router will create a new http.ServeMux.
+// Note that with an empty BasePath the API claims every path on m.
+func (a *API) Router(m *http.ServeMux) *http.ServeMux {
+	if m == nil {
+		m = http.NewServeMux()
+	}
+	m.Handle(a.BasePath+"/", a.Handler())
+	return m
+}
+
+// Handler returns a single http.Handler serving every registered Endpoint.
+// It panics if BatchPath was set after registering an Endpoint that answers
+// there.
+func (a *API) Handler() http.Handler {
+	if a.BatchPath != "" && a.names[strings.TrimPrefix(a.BatchPath, "/")] {
+		panic("rest: BatchPath " + a.BatchPath + " clashes with a registered Endpoint")
+	}
+	m := http.NewServeMux()
+	for _, e := range a.endpoints {
+		a.resolve(e).Register(prefixMux{m, a.BasePath})
+	}
+
+	var h http.Handler = m
+	for i := len(a.Middleware) - 1; i >= 0; i-- {
+		h = a.Middleware[i](h)
+	}
+	// batched requests go through the Middleware too, each on its own
+	if a.BatchPath != "" {
+		m.Handle("POST "+a.BasePath+a.BatchPath, a.batchHandler(h))
+	}
+	return h
+}
+
+// Route describes one method and path the API answers.
+type Route struct {
+	Method   string
+	Path     string
+	Endpoint string
+	// Implemented is false when the Endpoint still uses the stub handler for
+	// this method, in which case requests receive 501 Not Implemented.
+	Implemented bool
+}
+
+// Routes lists every method and path the API answers, grouped by Endpoint in
+// registration order.
+func (a *API) Routes() []Route {
+	var routes []Route
+	for _, e := range a.endpoints {
+		collection := a.BasePath + "/" + e.Name
+		item := collection + "/{id}"
+		routes = append(routes,
+			Route{"GET", collection, e.Name, isImplemented(e.GetCollection, UnimplementedCollectionHandler)},
+			Route{"POST", collection, e.Name, isImplemented(e.PostCollection, UnimplementedCollectionHandler)},
+			Route{"HEAD", item, e.Name, isImplemented(e.Head, UnimplementedHandler)},
+			Route{"GET", item, e.Name, isImplemented(e.Get, UnimplementedHandler)},
+			Route{"POST", item, e.Name, isImplemented(e.Post, UnimplementedHandler)},
+			Route{"PUT", item, e.Name, isImplemented(e.Put, UnimplementedHandler)},
+			Route{"DELETE", item, e.Name, isImplemented(e.Delete, UnimplementedHandler)},
+		)
+		if e.Batch != nil {
+			routes = append(routes,
+				Route{"PUT", collection, e.Name, isImplemented(e.Put, UnimplementedHandler)},
+				Route{"DELETE", collection, e.Name, isImplemented(e.Delete, UnimplementedHandler)},
+			)
+		}
+	}
+	if a.BatchPath != "" {
+		routes = append(routes, Route{"POST", a.BasePath + a.BatchPath, "", true})
+	}
+	return routes
+}
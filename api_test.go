@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"testing"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestAPIRegister(t *testing.T) {
+	a := NewAPI("/api")
+	if err := a.Register(NewEndpoint("yams")); err != nil {
+		t.Fatalf("Expected no error registering yams, got %s", err)
+	}
+	if err := a.Register(NewEndpoint("beets")); err != nil {
+		t.Fatalf("Expected no error registering beets, got %s", err)
+	}
+	if err := a.Register(NewEndpoint("yams")); err != ErrDuplicateEndpoint {
+		t.Errorf("Expected ErrDuplicateEndpoint registering yams twice, got %v", err)
+	}
+	if n := len(a.Endpoints()); n != 2 {
+		t.Errorf("Expected 2 endpoints, got %d", n)
+	}
+}
+
+func TestAPIHandler(t *testing.T) {
+	errRotten := errors.New("rotten")
+	a := NewAPI("/api/")
+	a.Codec = &Codec{
+		Accepts: "application/yams",
+		MaxSize: 1 << 10,
+		Marshal: func(v interface{}) ([]byte, error) {
+			return []byte("YAMSYAMSYAMS"), nil
+		},
+	}
+	a.StatusCodeLookup[errRotten] = http.StatusGone
+	var wrapped int
+	a.Middleware = append(a.Middleware, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped++
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	yams := &Endpoint{
+		GetCollection:  UnimplementedCollectionHandler,
+		PostCollection: UnimplementedCollectionHandler,
+		Head:           UnimplementedHandler,
+		Get: func(r *http.Request, id string, body []byte) (interface{}, error) {
+			return nil, errRotten
+		},
+		Put:    UnimplementedHandler,
+		Post:   UnimplementedHandler,
+		Delete: UnimplementedHandler,
+		Name:   "yams",
+	}
+	beets := newFalseEndpoint("beets")
+	a.Register(yams)
+	a.Register(beets)
+
+	handler := a.Handler()
+	for _, test := range []struct {
+		method, url string
+		code        int
+	}{
+		{"GET", "http://example.com/api/yams/1", http.StatusGone},
+		{"GET", "http://example.com/api/yams", http.StatusNotImplemented},
+		{"DELETE", "http://example.com/api/beets/1", http.StatusNotImplemented},
+		{"PUT", "http://example.com/api/beets", http.StatusMethodNotAllowed},
+		{"GET", "http://example.com/yams/1", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.url, nil)
+		r.Header.Set("Accept", "application/yams")
+		handler.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s: expected http return code %d, got %d", test.method, test.url, test.code, w.Code)
+		}
+	}
+	if wrapped != 5 {
+		t.Errorf("Expected middleware to see 5 requests, saw %d", wrapped)
+	}
+	if yams.Codec.Marshal != nil || yams.StatusCodeLookup != nil {
+		t.Errorf("Expected API defaults not to modify the registered endpoint")
+	}
+}
+
+func TestAPIRoutes(t *testing.T) {
+	a := NewAPI("/api")
+	e := NewEndpoint("yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	a.Register(e)
+
+	routes := a.Routes()
+	if len(routes) != 7 {
+		t.Fatalf("Expected 7 routes, got %d", len(routes))
+	}
+	for _, route := range routes {
+		if route.Endpoint != "yams" {
+			t.Errorf("Expected route endpoint yams, got %s", route.Endpoint)
+		}
+		expected := route.Method == "GET" && route.Path == "/api/yams/{id}"
+		if route.Implemented != expected {
+			t.Errorf("%s %s: expected Implemented to be %t", route.Method, route.Path, expected)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized is sent when a request carries missing or invalid
+// credentials. It corresponds to http.StatusUnauthorized.
+var ErrUnauthorized error = errors.New("Unauthorized")
+
+// Action names one of the REST methods of an Endpoint. Per-method settings
+// on Endpoint are keyed by Action.
+type Action string
+
+const (
+	ActionGetCollection  Action = "GetCollection"
+	ActionPostCollection Action = "PostCollection"
+	ActionHead           Action = "Head"
+	ActionGet            Action = "Get"
+	ActionPut            Action = "Put"
+	ActionPost           Action = "Post"
+	ActionDelete         Action = "Delete"
+)
+
+// actionFor returns the Action a request maps to.
+func actionFor(r *http.Request, id string) Action {
+	if id == "" {
+		switch r.Method {
+		case "POST":
+			return ActionPostCollection
+		case "PUT": // bulk update
+			return ActionPut
+		case "DELETE": // bulk delete
+			return ActionDelete
+		}
+		return ActionGetCollection
+	}
+	switch r.Method {
+	case "HEAD":
+		return ActionHead
+	case "PUT":
+		return ActionPut
+	case "POST":
+		return ActionPost
+	case "DELETE":
+		return ActionDelete
+	}
+	return ActionGet
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Name   string
+	Roles  []string
+	Scopes []string
+	// Claims holds any further attributes the Authenticator knows about the
+	// caller, such as the claims of a JWT.
+	Claims map[string]interface{}
+}
+
+// Authenticator identifies the caller of a request.
+type Authenticator interface {
+	// Authenticate returns the caller of r. body is the request body as
+	// sent, still compressed if it has a Content-Encoding, which has already
+	// been read. It should return ErrUnauthorized if the credentials are
+	// missing or invalid.
+	Authenticate(r *http.Request, body []byte) (*Principal, error)
+	// Challenge returns the WWW-Authenticate header sent along with 401
+	// responses.
+	Challenge() string
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the authenticated caller of r, or nil if the request
+// was not authenticated.
+func PrincipalFrom(r *http.Request) *Principal {
+	p, _ := r.Context().Value(principalKey{}).(*Principal)
+	return p
+}
+
+// authenticator returns the Authenticator for action, or nil if the action is
+// public.
+func (e *Endpoint) authenticator(action Action) Authenticator {
+	if pol, ok := e.Policies[action]; ok && pol.Public {
+		return nil
+	}
+	if a, ok := e.MethodAuthenticators[action]; ok {
+		return a
+	}
+	return e.Authenticator
+}
+
+// authenticate identifies the caller and stores the Principal on the
+// request. Errors the Endpoint maps itself are passed through; all others
+// become ErrUnauthorized.
+func (e *Endpoint) authenticate(r *http.Request, action Action, body []byte, log Logger) (*http.Request, Authenticator, error) {
+	a := e.authenticator(action)
+	if a == nil {
+		return r, nil, nil
+	}
+	p, err := a.Authenticate(r, body)
+	if err == nil && p == nil {
+		err = ErrUnauthorized
+	}
+	if err != nil {
+		if _, ok := e.StatusCodeLookup[err]; !ok && err != ErrUnauthorized {
+			log.Warningf("Authentication failed: %s", err)
+			err = ErrUnauthorized
+		}
+		return r, a, err
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, p)), a, nil
+}
+
+func quoteRealm(scheme, realm string) string {
+	if realm == "" {
+		return scheme
+	}
+	return scheme + ` realm="` + strings.Replace(realm, `"`, `\"`, -1) + `"`
+}
+
+// BasicAuth authenticates requests with HTTP Basic credentials.
+type BasicAuth struct {
+	Realm string
+	// Verify checks a username and password, returning the Principal they
+	// identify or ErrUnauthorized.
+	Verify func(username, password string) (*Principal, error)
+}
+
+// Authenticate implements Authenticator.
+func (b BasicAuth) Authenticate(r *http.Request, body []byte) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	return b.Verify(username, password)
+}
+
+// Challenge implements Authenticator.
+func (b BasicAuth) Challenge() string {
+	return quoteRealm("Basic", b.Realm) + `, charset="UTF-8"`
+}
+
+// BearerAuth authenticates requests with an opaque bearer token, as in
+// "Authorization: Bearer mF_9.B5f-4.1JqM".
+type BearerAuth struct {
+	Realm string
+	// Verify checks a token, returning the Principal it identifies or
+	// ErrUnauthorized.
+	Verify func(token string) (*Principal, error)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(auth[7:])
+	return token, token != ""
+}
+
+// Authenticate implements Authenticator.
+func (b BearerAuth) Authenticate(r *http.Request, body []byte) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	return b.Verify(token)
+}
+
+// Challenge implements Authenticator.
+func (b BearerAuth) Challenge() string {
+	return quoteRealm("Bearer", b.Realm)
+}
+
+/*
+HMACAuth authenticates requests signed with a shared secret key. Clients send
+
+	Date: <HTTP date>
+	Authorization: HMAC-SHA256 keyId="<key id>", signature="<base64 signature>"
+
+where the signature is the HMAC-SHA256, under the key, of the method, the
+request URI, the Date header and the hex SHA-256 of the body, each followed by
+a newline. SignRequest produces such headers.
+*/
+type HMACAuth struct {
+	Realm string
+	// Key returns the secret for a key id, or ErrUnauthorized if there is
+	// none. The key id becomes the Principal's Name.
+	Key func(keyID string) ([]byte, error)
+	// MaxSkew is how far the Date header may be from the current time.
+	// Zero means five minutes.
+	MaxSkew time.Duration
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+func hmacSignature(key []byte, method, uri, date string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(method + "\n" + uri + "\n" + date + "\n" + hex.EncodeToString(sum[:]) + "\n"))
+	return mac.Sum(nil)
+}
+
+// SignRequest sets the Date and Authorization headers on r for HMACAuth.
+// body must be the request body that will be sent.
+func SignRequest(r *http.Request, keyID string, key []byte, body []byte) {
+	date := r.Header.Get("Date")
+	if date == "" {
+		date = time.Now().UTC().Format(http.TimeFormat)
+		r.Header.Set("Date", date)
+	}
+	sig := hmacSignature(key, r.Method, r.URL.RequestURI(), date, body)
+	r.Header.Set("Authorization", `HMAC-SHA256 keyId="`+keyID+`", signature="`+
+		base64.StdEncoding.EncodeToString(sig)+`"`)
+}
+
+// parseAuthParams parses the comma separated key="value" pairs following an
+// authorization scheme.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		i := strings.Index(part, "=")
+		if i < 0 {
+			continue
+		}
+		k := strings.TrimSpace(part[:i])
+		v := strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+		params[k] = v
+	}
+	return params
+}
+
+// Authenticate implements Authenticator.
+func (h HMACAuth) Authenticate(r *http.Request, body []byte) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	const scheme = "HMAC-SHA256 "
+	if len(auth) < len(scheme) || !strings.EqualFold(auth[:len(scheme)], scheme) {
+		return nil, ErrUnauthorized
+	}
+	params := parseAuthParams(auth[len(scheme):])
+	keyID, signature := params["keyId"], params["signature"]
+	if keyID == "" || signature == "" {
+		return nil, ErrUnauthorized
+	}
+
+	date := r.Header.Get("Date")
+	t, err := http.ParseTime(date)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	now, skew := time.Now(), h.MaxSkew
+	if h.Now != nil {
+		now = h.Now()
+	}
+	if skew == 0 {
+		skew = 5 * time.Minute
+	}
+	if t.Before(now.Add(-skew)) || t.After(now.Add(skew)) {
+		return nil, ErrUnauthorized
+	}
+
+	key, err := h.Key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	got, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	if !hmac.Equal(got, hmacSignature(key, r.Method, r.URL.RequestURI(), date, body)) {
+		return nil, ErrUnauthorized
+	}
+	return &Principal{Name: keyID}, nil
+}
+
+// Challenge implements Authenticator.
+func (h HMACAuth) Challenge() string {
+	return quoteRealm("HMAC-SHA256", h.Realm)
+}
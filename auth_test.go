@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"testing"
+
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func newAuthEndpoint(t *testing.T, a Authenticator) *Endpoint {
+	e := newFalseEndpoint("yams")
+	e.Authenticator = a
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if p := PrincipalFrom(r); p == nil || p.Name != "jo" {
+			t.Errorf("Expected principal jo in handler, got %+v", p)
+		}
+		return nil, nil
+	}
+	e.Post = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	return e
+}
+
+func serveAuth(e *Endpoint, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.Header.Set("Accept", "application/yams")
+	e.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestBasicAuth(t *testing.T) {
+	e := newAuthEndpoint(t, BasicAuth{
+		Realm: "yams",
+		Verify: func(username, password string) (*Principal, error) {
+			if username == "jo" && password == "sweetpotato" {
+				return &Principal{Name: "jo"}, nil
+			}
+			return nil, ErrUnauthorized
+		},
+	})
+
+	r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+	r.SetBasicAuth("jo", "sweetpotato")
+	if w := serveAuth(e, r); w.Code != http.StatusOK {
+		t.Errorf("Valid credentials: expected http return code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	r, _ = http.NewRequest("GET", "http://example.com/yams/1", nil)
+	r.SetBasicAuth("jo", "yam")
+	w := serveAuth(e, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Invalid credentials: expected http return code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if c := w.Header().Get("WWW-Authenticate"); c != `Basic realm="yams", charset="UTF-8"` {
+		t.Errorf("Invalid credentials: unexpected WWW-Authenticate %q", c)
+	}
+
+	// a nil entry makes an action public
+	e.MethodAuthenticators = map[Action]Authenticator{ActionPost: nil}
+	r, _ = http.NewRequest("POST", "http://example.com/yams/1", nil)
+	if w := serveAuth(e, r); w.Code != http.StatusOK {
+		t.Errorf("Public action: expected http return code %d, got %d", http.StatusOK, w.Code)
+	}
+	r, _ = http.NewRequest("GET", "http://example.com/yams/1", nil)
+	if w := serveAuth(e, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("No credentials: expected http return code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	e := newAuthEndpoint(t, BearerAuth{
+		Verify: func(token string) (*Principal, error) {
+			if token == "yamtoken" {
+				return &Principal{Name: "jo"}, nil
+			}
+			return nil, ErrUnauthorized
+		},
+	})
+
+	for _, test := range []struct {
+		header string
+		code   int
+	}{
+		{"Bearer yamtoken", http.StatusOK},
+		{"bearer yamtoken", http.StatusOK},
+		{"Bearer beettoken", http.StatusUnauthorized},
+		{"Basic eWFtOnlhbQ==", http.StatusUnauthorized},
+	} {
+		r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+		r.Header.Set("Authorization", test.header)
+		w := serveAuth(e, r)
+		if w.Code != test.code {
+			t.Errorf("Authorization %q: expected http return code %d, got %d", test.header, test.code, w.Code)
+		}
+		if test.code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("Authorization %q: expected Bearer challenge, got %q", test.header, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	key := []byte("sekrit")
+	e := newAuthEndpoint(t, HMACAuth{
+		Key: func(keyID string) ([]byte, error) {
+			if keyID == "jo" {
+				return key, nil
+			}
+			return nil, ErrUnauthorized
+		},
+		Now: func() time.Time { return now },
+	})
+
+	body := []byte("YAMS")
+	sign := func(keyID string, key []byte, date time.Time, signed []byte) *http.Request {
+		r, _ := http.NewRequest("POST", "http://example.com/yams/1?fresh=true", bytes.NewBuffer(body))
+		r.Header.Set("Date", date.Format(http.TimeFormat))
+		SignRequest(r, keyID, key, signed)
+		return r
+	}
+
+	if w := serveAuth(e, sign("jo", key, now, body)); w.Code != http.StatusOK {
+		t.Errorf("Valid signature: expected http return code %d, got %d", http.StatusOK, w.Code)
+	}
+	for name, r := range map[string]*http.Request{
+		"wrong key":     sign("jo", []byte("guess"), now, body),
+		"unknown key":   sign("sam", key, now, body),
+		"stale date":    sign("jo", key, now.Add(-time.Hour), body),
+		"tampered body": sign("jo", key, now, []byte("BEETS")),
+	} {
+		if w := serveAuth(e, r); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected http return code %d, got %d", name, http.StatusUnauthorized, w.Code)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrForbidden is sent when an authenticated caller is not allowed to
+// perform an action. It corresponds to http.StatusForbidden.
+var ErrForbidden error = errors.New("Forbidden")
+
+// Policy is a declarative authorization rule for one Action of an Endpoint.
+// All of the rules that are set must hold for the action to be allowed.
+type Policy struct {
+	// Public lets anyone perform the action. Authentication is skipped
+	// altogether, and the other rules are ignored.
+	Public bool
+	// Roles, if not empty, requires the caller to hold at least one of them.
+	Roles []string
+	// Scopes, if not empty, requires the caller to hold all of them.
+	Scopes []string
+	// Owner, if not nil, is called with the object id (empty for collection
+	// actions) and must report whether the caller may act on that object.
+	Owner func(r *http.Request, p *Principal, id string) bool
+}
+
+// allows reports whether p may perform the action under the policy.
+func (pol Policy) allows(r *http.Request, p *Principal, id string) bool {
+	if len(pol.Roles) > 0 {
+		ok := false
+		for _, role := range pol.Roles {
+			if containsString(p.Roles, role) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for _, scope := range pol.Scopes {
+		if !containsString(p.Scopes, scope) {
+			return false
+		}
+	}
+	if pol.Owner != nil && !pol.Owner(r, p, id) {
+		return false
+	}
+	return true
+}
+
+// authorize checks the caller of r against the policy for action. Actions
+// without a policy are allowed to anyone the Authenticator accepted.
+func (e *Endpoint) authorize(r *http.Request, action Action, id string) error {
+	pol, ok := e.Policies[action]
+	if !ok || pol.Public {
+		return nil
+	}
+	p := PrincipalFrom(r)
+	if p == nil {
+		return ErrUnauthorized
+	}
+	if !pol.allows(r, p, id) {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"testing"
+
+	"net/http"
+)
+
+func TestPolicies(t *testing.T) {
+	principals := map[string]*Principal{
+		"admin":  {Name: "admin", Roles: []string{"admin"}, Scopes: []string{"yams:read", "yams:write"}},
+		"farmer": {Name: "jo", Roles: []string{"farmer"}, Scopes: []string{"yams:read"}},
+	}
+	e := newFalseEndpoint("yams")
+	e.Authenticator = BearerAuth{Verify: func(token string) (*Principal, error) {
+		if p, ok := principals[token]; ok {
+			return p, nil
+		}
+		return nil, ErrUnauthorized
+	}}
+	ok := func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.Get, e.Put, e.Delete = ok, ok, ok
+	e.Policies = map[Action]Policy{
+		ActionGetCollection: {Public: true},
+		ActionGet:           {Scopes: []string{"yams:read"}},
+		ActionDelete:        {Roles: []string{"admin"}},
+		ActionPut: {Owner: func(r *http.Request, p *Principal, id string) bool {
+			return p.Name == id
+		}},
+	}
+
+	for _, test := range []struct {
+		method, url, token string
+		code               int
+	}{
+		{"GET", "http://example.com/yams", "", http.StatusOK},
+		{"GET", "http://example.com/yams/1", "farmer", http.StatusOK},
+		{"GET", "http://example.com/yams/1", "", http.StatusUnauthorized},
+		{"DELETE", "http://example.com/yams/1", "admin", http.StatusOK},
+		{"DELETE", "http://example.com/yams/1", "farmer", http.StatusForbidden},
+		{"PUT", "http://example.com/yams/jo", "farmer", http.StatusOK},
+		{"PUT", "http://example.com/yams/sam", "farmer", http.StatusForbidden},
+		{"HEAD", "http://example.com/yams/1", "farmer", http.StatusNotImplemented},
+	} {
+		r, _ := http.NewRequest(test.method, test.url, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		if w := serveAuth(e, r); w.Code != test.code {
+			t.Errorf("%s %s as %q: expected http return code %d, got %d",
+				test.method, test.url, test.token, test.code, w.Code)
+		}
+	}
+
+	// without an Authenticator, non-public policies cannot be satisfied
+	e.Authenticator = nil
+	r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+	if w := serveAuth(e, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("No authenticator: expected http return code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,279 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+Batch enables bulk operations on an Endpoint's collection:
+
+	POST /Name               with an array body calls PostCollection per item
+	PUT /Name?id=1&id=2      calls Put for each id, with the same body
+	DELETE /Name?id=1,2,3    calls Delete for each id
+
+Each answers 207 (Multi-Status) with a BatchResult reporting every item. An
+array body needs a Codec with SplitArray. Bulk updates and deletes are
+authenticated as the Put or Delete action, and Policies are checked for each
+id in turn. Items are decoded with the request codec's Unmarshal, so codecs
+that only have a Decode function cannot be used for bulk POST and PUT
+requests.
+*/
+type Batch struct {
+	// MaxItems bounds the number of items in one request. Zero means 1000.
+	MaxItems int
+}
+
+const defaultBatchMaxItems = 1000
+
+// BatchItemResult reports the outcome of one item of a bulk request.
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	// Body is what the handler returned, or a ValidationFailure.
+	Body  interface{} `json:"body,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// BatchResult is the response body of a bulk request.
+type BatchResult struct {
+	Results []BatchItemResult `json:"results"`
+}
+
+type batchItem struct {
+	id   string
+	body []byte
+}
+
+// bulk reports whether a request for action on the collection is a bulk
+// update or delete, whose Policies are checked per item.
+func bulk(action Action, id string) bool {
+	return id == "" && (action == ActionPut || action == ActionDelete)
+}
+
+// batchItems splits a bulk request into its items. It reports false for
+// requests that are not bulk requests.
+func (e *Endpoint) batchItems(r *http.Request, id string, data []byte) ([]batchItem, bool, error) {
+	if e.Batch == nil || id != "" {
+		return nil, false, nil
+	}
+	max := e.Batch.MaxItems
+	if max == 0 {
+		max = defaultBatchMaxItems
+	}
+
+	// items are unmarshaled one by one, which codecs that only decode
+	// whole request bodies cannot do
+	codec := e.requestCodec(r)
+	decodeOnly := codec.Decode != nil && codec.Unmarshal == nil
+
+	var items []batchItem
+	switch r.Method {
+	case "POST":
+		if codec.SplitArray == nil {
+			return nil, false, nil
+		}
+		if decodeOnly {
+			return nil, true, ErrBadRequest
+		}
+		bodies, ok := codec.SplitArray(data)
+		if !ok {
+			return nil, false, nil
+		}
+		for _, body := range bodies {
+			items = append(items, batchItem{body: body})
+		}
+	case "PUT", "DELETE":
+		if decodeOnly && r.Method == "PUT" {
+			return nil, true, ErrBadRequest
+		}
+		for _, v := range r.URL.Query()["id"] {
+			for _, id := range strings.Split(v, ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					items = append(items, batchItem{id: id, body: data})
+				}
+			}
+		}
+		if len(items) == 0 {
+			return nil, true, ErrBadRequest
+		}
+	default:
+		return nil, false, nil
+	}
+	if len(items) > max {
+		return nil, true, ErrBadRequest
+	}
+	return items, true, nil
+}
+
+// runBatch calls the handler for action once per item.
+func (e *Endpoint) runBatch(r *http.Request, action Action, items []batchItem) *BatchResult {
+	result := &BatchResult{Results: []BatchItemResult{}}
+	for i, item := range items {
+		var (
+			rv  interface{}
+			err error
+		)
+		if item.id != "" {
+			if !idPattern.MatchString(item.id) {
+				err = ErrBadRequest
+			} else {
+				err = e.authorize(r, action, item.id)
+			}
+		}
+
+		ir := r
+		if err == nil && e.Model != nil && action != ActionDelete {
+			var model interface{}
+			model, err = e.decode(r, item.body, false)
+			if fieldErrs, ok := err.(ValidationErrors); ok {
+				rv = ValidationFailure{fieldErrs}
+			}
+			ir = r.WithContext(context.WithValue(r.Context(), decodedKey{}, model))
+		}
+		if err == nil {
+			switch action {
+			case ActionPostCollection:
+				rv, err = e.PostCollection(ir, item.body)
+			case ActionPut:
+				rv, err = e.Put(ir, item.id, item.body)
+			case ActionDelete:
+				rv, err = e.Delete(ir, item.id, item.body)
+			}
+		}
+
+		res := BatchItemResult{Index: i, ID: item.id, Status: e.statusCode(err), Body: rv}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		result.Results = append(result.Results, res)
+	}
+	return result
+}
+
+// BatchRequest is one request inside a call to an API's batch endpoint.
+type BatchRequest struct {
+	Method string `json:"method"`
+	// Path is relative to the API's BasePath, e.g. "/yams/1?fields=name".
+	Path   string            `json:"path"`
+	Header map[string]string `json:"headers,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the outcome of one BatchRequest. Bodies that are not
+// JSON are given as JSON strings.
+type BatchResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"headers,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// maxBatchSize limits the size of a request to an API's batch endpoint.
+const maxBatchSize = 10 << 20
+
+// batchInherited lists the headers batched requests inherit from the
+// request carrying them.
+var batchInherited = []string{"Accept", "Authorization", "Cookie", "traceparent"}
+
+// batchRecorder collects the response to one batched request.
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *batchRecorder) Header() http.Header { return b.header }
+
+func (b *batchRecorder) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *batchRecorder) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// batchHandler serves the API's batch endpoint. It takes a JSON array of
+// BatchRequests, runs them in order through h, and answers 207
+// (Multi-Status) with a JSON array of BatchResponses.
+func (a *API) batchHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBatchSize+1))
+		if err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if len(data) > maxBatchSize {
+			http.Error(w, "", http.StatusRequestEntityTooLarge)
+			return
+		}
+		var reqs []BatchRequest
+		if err := json.Unmarshal(data, &reqs); err != nil || len(reqs) > defaultBatchMaxItems {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+
+		resps := make([]BatchResponse, len(reqs))
+		for i, req := range reqs {
+			resps[i] = a.runBatched(r, h, req)
+		}
+		out, err := json.Marshal(resps)
+		if err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write(out)
+	})
+}
+
+func (a *API) runBatched(r *http.Request, h http.Handler, req BatchRequest) BatchResponse {
+	if !strings.HasPrefix(req.Path, "/") || strings.SplitN(req.Path, "?", 2)[0] == a.BatchPath {
+		return BatchResponse{Status: http.StatusBadRequest}
+	}
+	sub, err := http.NewRequestWithContext(r.Context(), strings.ToUpper(req.Method), a.BasePath+req.Path, bytes.NewReader(req.Body))
+	if err != nil {
+		return BatchResponse{Status: http.StatusBadRequest}
+	}
+	sub.RemoteAddr = r.RemoteAddr
+	for _, k := range batchInherited {
+		if v := r.Header.Get(k); v != "" {
+			sub.Header.Set(k, v)
+		}
+	}
+	for k, v := range req.Header {
+		sub.Header.Set(k, v)
+	}
+	// the response is embedded in ours, so it must not be compressed
+	sub.Header.Del("Accept-Encoding")
+
+	rec := &batchRecorder{header: http.Header{}}
+	h.ServeHTTP(rec, sub)
+
+	resp := BatchResponse{Status: rec.status, Header: map[string]string{}}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	for k := range rec.header {
+		resp.Header[k] = rec.header.Get(k)
+	}
+	if body := rec.body.Bytes(); len(body) > 0 {
+		if json.Valid(body) {
+			resp.Body = body
+		} else {
+			resp.Body, _ = json.Marshal(string(body))
+		}
+	}
+	return resp
+}
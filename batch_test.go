@@ -0,0 +1,279 @@
+package rest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func newBatchEndpoint() *Endpoint {
+	e := newFalseEndpoint("yams")
+	e.Codec = Codec{
+		Accepts:   "application/json",
+		MaxSize:   1 << 20,
+		Marshal:   json.Marshal,
+		Unmarshal: json.Unmarshal,
+		SplitArray: func(data []byte) ([][]byte, bool) {
+			var items []json.RawMessage
+			if !bytes.HasPrefix(data, []byte("[")) || json.Unmarshal(data, &items) != nil {
+				return nil, false
+			}
+			split := make([][]byte, len(items))
+			for i, item := range items {
+				split[i] = item
+			}
+			return split, true
+		},
+	}
+	e.Batch = &Batch{MaxItems: 3}
+	e.StatusCodeLookup[ErrNotFound] = http.StatusNotFound
+	return e
+}
+
+func serveBatch(e *Endpoint, method, url, body string) (*httptest.ResponseRecorder, BatchResult) {
+	r, _ := http.NewRequest(method, url, strings.NewReader(body))
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	var result BatchResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w, result
+}
+
+func statuses(result BatchResult) []int {
+	var codes []int
+	for _, res := range result.Results {
+		codes = append(codes, res.Status)
+	}
+	return codes
+}
+
+func TestBatchPostCollection(t *testing.T) {
+	type yam struct {
+		Name string `json:"name" validate:"required"`
+	}
+	var created []string
+	e := newBatchEndpoint()
+	e.Model = yam{}
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		y := Decoded(r).(*yam)
+		created = append(created, y.Name)
+		return y, nil
+	}
+
+	w, result := serveBatch(e, "POST", "http://example.com/yams", `[{"name":"garnet"},{},{"name":"jewel"}]`)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected http return code %d, got %d", http.StatusMultiStatus, w.Code)
+	}
+	if got := statuses(result); len(got) != 3 || got[0] != 200 || got[1] != 422 || got[2] != 200 {
+		t.Errorf("Expected item statuses [200 422 200], got %v", got)
+	}
+	if len(created) != 2 || created[0] != "garnet" || created[1] != "jewel" {
+		t.Errorf("Expected garnet and jewel created, got %v", created)
+	}
+	if result.Results[1].Body == nil || result.Results[2].Index != 2 {
+		t.Errorf("Expected validation failure body and indexes, got %+v", result.Results)
+	}
+
+	created = nil
+	if w, _ := serveBatch(e, "POST", "http://example.com/yams", `{"name":"garnet"}`); w.Code != http.StatusOK || len(created) != 1 {
+		t.Errorf("Single object: expected plain PostCollection, got %d with %v", w.Code, created)
+	}
+	if w, _ := serveBatch(e, "POST", "http://example.com/yams", `[{},{},{},{}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("Over MaxItems: expected http return code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestBatchDeleteAndPut(t *testing.T) {
+	var deleted, updated []string
+	e := newBatchEndpoint()
+	e.Codec.Accepts = "application/yams" // for serveAuth
+	e.Delete = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if id == "3" {
+			return nil, ErrNotFound
+		}
+		deleted = append(deleted, id)
+		return nil, nil
+	}
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		updated = append(updated, id+"="+string(body))
+		return nil, nil
+	}
+	e.Authenticator = BearerAuth{Verify: func(token string) (*Principal, error) {
+		return &Principal{Name: token}, nil
+	}}
+	e.Policies = map[Action]Policy{
+		ActionGetCollection: {Public: true},
+		ActionDelete: {Owner: func(r *http.Request, p *Principal, id string) bool {
+			return id != "2"
+		}},
+	}
+
+	r, _ := http.NewRequest("DELETE", "http://example.com/yams?id=1,2&id=3", nil)
+	r.Header.Set("Authorization", "Bearer jo")
+	w := serveAuth(e, r)
+	var result BatchResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected http return code %d, got %d", http.StatusMultiStatus, w.Code)
+	}
+	if got := statuses(result); len(got) != 3 || got[0] != 200 || got[1] != 403 || got[2] != 404 {
+		t.Errorf("Expected item statuses [200 403 404], got %v", got)
+	}
+	if len(deleted) != 1 || result.Results[1].ID != "2" {
+		t.Errorf("Expected only 1 deleted, got %v", deleted)
+	}
+
+	// bulk actions are not covered by the collection's public policy
+	r, _ = http.NewRequest("DELETE", "http://example.com/yams?id=1", nil)
+	if w := serveAuth(e, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous bulk delete: expected http return code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	r, _ = http.NewRequest("PUT", "http://example.com/yams?id=1&id=bad!id", strings.NewReader(`"mashed"`))
+	r.Header.Set("Authorization", "Bearer jo")
+	w = serveAuth(e, r)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if got := statuses(result); len(got) != 2 || got[0] != 200 || got[1] != 400 {
+		t.Errorf("Expected item statuses [200 400], got %v", got)
+	}
+	if len(updated) != 1 || updated[0] != `1="mashed"` {
+		t.Errorf("Expected one update with the shared body, got %v", updated)
+	}
+
+	r, _ = http.NewRequest("DELETE", "http://example.com/yams", nil)
+	r.Header.Set("Authorization", "Bearer jo")
+	if w := serveAuth(e, r); w.Code != http.StatusBadRequest {
+		t.Errorf("Without ids: expected http return code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	e.Batch = nil
+	if w, _ := serveBatch(e, "DELETE", "http://example.com/yams?id=1", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Without Batch: expected http return code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestAPIBatch(t *testing.T) {
+	e := newBatchEndpoint()
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if r.Header.Get("Authorization") != "Bearer jo" {
+			return nil, ErrUnauthorized
+		}
+		return map[string]string{"id": id}, nil
+	}
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return map[string]string{"id": id, "body": string(body)}, nil
+	}
+	a := NewAPI("/api")
+	a.BatchPath = "/batch"
+	a.Register(e)
+	var seen []string
+	a.Middleware = []Middleware{func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.Method+" "+r.URL.Path)
+			h.ServeHTTP(w, r)
+		})
+	}}
+
+	r, _ := http.NewRequest("POST", "http://example.com/api/batch", strings.NewReader(`[
+		{"method": "GET", "path": "/yams/1"},
+		{"method": "put", "path": "/yams/2", "body": {"name": "garnet"}},
+		{"method": "GET", "path": "/yams/3", "headers": {"Accept": "text/plain"}},
+		{"method": "POST", "path": "/batch"}
+	]`))
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("Authorization", "Bearer jo")
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	a.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected http return code %d, got %d", http.StatusMultiStatus, w.Code)
+	}
+
+	var resps []BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resps); err != nil {
+		t.Fatalf("Error decoding batch response: %s", err)
+	}
+	expected := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusOK, `{"id":"1"}`},
+		{http.StatusOK, `{"body":"{\"name\": \"garnet\"}","id":"2"}`},
+		{http.StatusNotAcceptable, `"\n"`},
+		{http.StatusBadRequest, ``},
+	}
+	for i, exp := range expected {
+		if resps[i].Status != exp.status || string(resps[i].Body) != exp.body {
+			t.Errorf("Request %d: expected %d %s, got %d %s", i, exp.status, exp.body, resps[i].Status, resps[i].Body)
+		}
+	}
+	if resps[0].Header["Content-Type"] != "application/json" {
+		t.Errorf("Expected response headers, got %v", resps[0].Header)
+	}
+	if got := strings.Join(seen, ", "); got != "POST /api/batch, GET /api/yams/1, PUT /api/yams/2, GET /api/yams/3" {
+		t.Errorf("Expected the batch and each request to pass through Middleware, got %s", got)
+	}
+
+	found := false
+	for _, route := range a.Routes() {
+		found = found || (route.Method == "POST" && route.Path == "/api/batch")
+	}
+	if !found {
+		t.Errorf("Expected batch route to be listed")
+	}
+}
+
+func TestBatchDecodeCodec(t *testing.T) {
+	type yam struct {
+		Name string `json:"name"`
+	}
+	var updated []string
+	e := newBatchEndpoint()
+	e.Model = yam{}
+	e.Codec.Decode = func(r *http.Request, v interface{}) error {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		updated = append(updated, id+"="+Decoded(r).(*yam).Name)
+		return nil, nil
+	}
+
+	w, result := serveBatch(e, "PUT", "http://example.com/yams?id=1,2", `{"name":"garnet"}`)
+	if got := statuses(result); w.Code != http.StatusMultiStatus || len(got) != 2 || got[0] != 200 || got[1] != 200 {
+		t.Errorf("Expected item statuses [200 200], got %d %v", w.Code, got)
+	}
+	if len(updated) != 2 || updated[0] != "1=garnet" || updated[1] != "2=garnet" {
+		t.Errorf("Expected each item decoded from the shared body, got %v", updated)
+	}
+
+	e.Codec.Unmarshal = nil
+	if w, _ := serveBatch(e, "PUT", "http://example.com/yams?id=1,2", `{"name":"garnet"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Decode-only codec: expected http return code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w, _ := serveBatch(e, "PUT", "http://example.com/yams/1", `{"name":"jewel"}`); w.Code != http.StatusOK || updated[len(updated)-1] != "1=jewel" {
+		t.Errorf("Decode-only codec: expected single PUT to work, got %d with %v", w.Code, updated)
+	}
+}
+
+func TestAPIBatchPathClash(t *testing.T) {
+	a := NewAPI("/api")
+	a.BatchPath = "/batch"
+	if err := a.Register(newFalseEndpoint("batch")); err != ErrDuplicateEndpoint {
+		t.Errorf("Expected %v, got %v", ErrDuplicateEndpoint, err)
+	}
+
+	a = NewAPI("/api")
+	a.Register(newFalseEndpoint("batch"))
+	a.BatchPath = "/batch"
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Handler to panic on a clashing BatchPath")
+		}
+	}()
+	a.Handler()
+}
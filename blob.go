@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// Blob is a file, such as an image or a PDF, that a Get or Head handler
+// returns a pointer to in place of an object to marshal. It is sent as it
+// is, with its own media type, and answers Range requests with 206 (Partial
+// Content), or with 416 (Range Not Satisfiable) for ranges outside it.
+// If-Range, If-None-Match and If-Modified-Since are checked against its ETag
+// and ModTime. See Endpoint.Blobs for serving clients that do not accept the
+// endpoint's codecs.
+type Blob struct {
+	// Content is read from the start for each response. If it is an
+	// io.Closer, it is closed once the response has been written.
+	Content io.ReadSeeker
+	// MediaType is sent as the Content-Type. If empty, it is guessed from
+	// the extension of Filename, or else from the first bytes of Content.
+	MediaType string
+	// ModTime, if not zero, is sent as the Last-Modified header.
+	ModTime time.Time
+	// ETag, if not empty, is sent as the ETag header. It must be quoted, as
+	// in `"v2"`, and be strong for If-Range to match it.
+	ETag string
+	// Filename, if not empty, is sent in a Content-Disposition header that
+	// makes browsers save the blob under that name, or show it if Inline is
+	// set.
+	Filename string
+	Inline   bool
+}
+
+// disposition returns the Content-Disposition header value for b, or the
+// empty string if it needs none.
+func (b *Blob) disposition() string {
+	if b.Filename == "" {
+		return ""
+	}
+	kind := "attachment"
+	if b.Inline {
+		kind = "inline"
+	}
+	return mime.FormatMediaType(kind, map[string]string{"filename": b.Filename})
+}
+
+// blobWriter records the status and size of a response http.ServeContent
+// writes.
+type blobWriter struct {
+	http.ResponseWriter
+	status, n int
+}
+
+func (b *blobWriter) WriteHeader(status int) {
+	b.status = status
+	b.ResponseWriter.WriteHeader(status)
+}
+
+func (b *blobWriter) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	n, err := b.ResponseWriter.Write(p)
+	b.n += n
+	return n, err
+}
+
+// writeBlob answers r with b, and returns the status code and the number of
+// bytes sent. Blobs are never compressed, so that byte ranges refer to the
+// file itself.
+func writeBlob(w http.ResponseWriter, r *http.Request, b *Blob) (int, int) {
+	if c, ok := b.Content.(io.Closer); ok {
+		defer c.Close()
+	}
+	h := w.Header()
+	h.Del("Content-Type")
+	if b.MediaType != "" {
+		h.Set("Content-Type", b.MediaType)
+	}
+	if d := b.disposition(); d != "" {
+		h.Set("Content-Disposition", d)
+	}
+	if b.ETag != "" {
+		h.Set("ETag", b.ETag)
+	}
+	h.Set("X-Handled-By", "github.com/goldibex/rest")
+	content := b.Content
+	if content == nil {
+		content = bytes.NewReader(nil)
+	}
+	bw := &blobWriter{ResponseWriter: w}
+	http.ServeContent(bw, r, b.Filename, b.ModTime, content)
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.status, bw.n
+}
@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+type closingReader struct {
+	*strings.Reader
+	closed bool
+}
+
+func (c *closingReader) Close() error {
+	c.closed = true
+	return nil
+}
+
+func newBlobEndpoint(content **closingReader) *Endpoint {
+	modTime := time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)
+	e := newFalseEndpoint("photos")
+	e.Blobs = true
+	e.Codec.Header = http.Header{"Content-Disposition": {"attachment"}}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if id != "yam" {
+			return nil, ErrNotFound
+		}
+		*content = &closingReader{Reader: strings.NewReader("0123456789")}
+		return &Blob{
+			Content:   *content,
+			MediaType: "image/png",
+			ModTime:   modTime,
+			ETag:      `"v1"`,
+			Filename:  "sweet yam.png",
+		}, nil
+	}
+	e.StatusCodeLookup[ErrNotFound] = http.StatusNotFound
+	return e
+}
+
+func TestBlob(t *testing.T) {
+	var content *closingReader
+	e := newBlobEndpoint(&content)
+
+	for _, test := range []struct {
+		name    string
+		header  http.Header
+		code    int
+		body    string
+		crange  string
+		headers bool
+	}{
+		{"whole", http.Header{"Accept": {"image/png"}}, http.StatusOK, "0123456789", "", true},
+		{"range", http.Header{"Range": {"bytes=2-4"}}, http.StatusPartialContent, "234", "bytes 2-4/10", true},
+		{"suffix", http.Header{"Range": {"bytes=-3"}}, http.StatusPartialContent, "789", "bytes 7-9/10", true},
+		{"unsatisfiable", http.Header{"Range": {"bytes=20-30"}}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */10", false},
+		{"if-range match", http.Header{"Range": {"bytes=0-0"}, "If-Range": {`"v1"`}}, http.StatusPartialContent, "0", "bytes 0-0/10", true},
+		{"if-range stale", http.Header{"Range": {"bytes=0-0"}, "If-Range": {`"v0"`}}, http.StatusOK, "0123456789", "", true},
+		{"if-range date", http.Header{"Range": {"bytes=0-0"}, "If-Range": {"Tue, 01 Mar 2016 00:00:00 GMT"}}, http.StatusPartialContent, "0", "bytes 0-0/10", true},
+		{"not modified", http.Header{"If-None-Match": {`"v1"`}}, http.StatusNotModified, "", "", false},
+	} {
+		r, _ := http.NewRequest("GET", "http://example.com/photos/yam", nil)
+		for k, v := range test.header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		e.Handler().ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: expected http return code %d, got %d", test.name, test.code, w.Code)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: expected body %q, got %q", test.name, test.body, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Range"); got != test.crange {
+			t.Errorf("%s: expected Content-Range %q, got %q", test.name, test.crange, got)
+		}
+		if !test.headers {
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != "image/png" {
+			t.Errorf("%s: expected Content-Type image/png, got %s", test.name, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="sweet yam.png"` {
+			t.Errorf("%s: expected the blob's Content-Disposition, got %s", test.name, got)
+		}
+		if got := w.Header().Get("Last-Modified"); got != "Tue, 01 Mar 2016 00:00:00 GMT" {
+			t.Errorf("%s: expected Last-Modified, got %s", test.name, got)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: expected no Content-Encoding, got %s", test.name, got)
+		}
+		if !content.closed {
+			t.Errorf("%s: expected the content to be closed", test.name)
+		}
+	}
+
+	// failures still go through the codec, whatever the client accepts
+	r, _ := http.NewRequest("GET", "http://example.com/photos/parsnip", nil)
+	r.Header.Set("Accept", "image/png")
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/yams" {
+		t.Errorf("Missing blob: expected 404 as application/yams, got %d as %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// collections are still negotiated
+	if code := tryEndpoint(e, "GET", "image/png", "http://example.com/photos"); code != http.StatusNotAcceptable {
+		t.Errorf("Collection: expected http return code %d, got %d", http.StatusNotAcceptable, code)
+	}
+	e.Blobs = false
+	if code := tryEndpoint(e, "GET", "image/png", "http://example.com/photos/yam"); code != http.StatusNotAcceptable {
+		t.Errorf("Without Blobs: expected http return code %d, got %d", http.StatusNotAcceptable, code)
+	}
+}
+
+func TestBlobDisposition(t *testing.T) {
+	for _, test := range []struct {
+		blob     Blob
+		expected string
+	}{
+		{Blob{}, ""},
+		{Blob{Filename: "yam.pdf"}, "attachment; filename=yam.pdf"},
+		{Blob{Filename: "yam.pdf", Inline: true}, "inline; filename=yam.pdf"},
+		{Blob{Filename: "ñame.pdf"}, "attachment; filename*=utf-8''%C3%B1ame.pdf"},
+	} {
+		if got := test.blob.disposition(); got != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachePolicy describes the Cache-Control header sent with successful
+// responses.
+type CachePolicy struct {
+	// MaxAge is how long the response may be reused without revalidation.
+	MaxAge time.Duration
+	// Public lets shared caches store responses to authenticated requests.
+	Public bool
+	// Private keeps responses out of shared caches, and out of the
+	// Endpoint's ResponseCache.
+	Private bool
+	// NoCache requires caches to revalidate before every reuse.
+	NoCache bool
+	// NoStore forbids caching altogether; the other fields are ignored.
+	NoStore bool
+	// StaleWhileRevalidate lets caches serve a stale response for this long
+	// while they revalidate it in the background.
+	StaleWhileRevalidate time.Duration
+}
+
+// String returns the policy as a Cache-Control header value.
+func (p CachePolicy) String() string {
+	if p.NoStore {
+		return "no-store"
+	}
+	var directives []string
+	if p.Public {
+		directives = append(directives, "public")
+	}
+	if p.Private {
+		directives = append(directives, "private")
+	}
+	if p.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	directives = append(directives, "max-age="+strconv.Itoa(int(p.MaxAge.Seconds())))
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+strconv.Itoa(int(p.StaleWhileRevalidate.Seconds())))
+	}
+	return strings.Join(directives, ", ")
+}
+
+// storable reports whether the Endpoint's ResponseCache may keep responses
+// under the policy.
+func (p *CachePolicy) storable() bool {
+	return p != nil && !p.NoStore && !p.NoCache && !p.Private && p.MaxAge > 0
+}
+
+// storableFor reports whether the Endpoint's ResponseCache may keep the
+// response to r under the policy. Responses to authenticated requests may
+// differ from caller to caller, so they are only kept under a Public policy.
+func (p *CachePolicy) storableFor(r *http.Request) bool {
+	if !p.storable() {
+		return false
+	}
+	return p.Public || (r.Header.Get("Authorization") == "" && PrincipalFrom(r) == nil)
+}
+
+// cachePolicy returns the policy for action, or nil if it has none.
+func (e *Endpoint) cachePolicy(action Action) *CachePolicy {
+	if p, ok := e.MethodCachePolicies[action]; ok {
+		return p
+	}
+	return e.CachePolicy
+}
+
+type responseMetaKey struct{}
+
+// responseMeta collects what handlers tell us about the response they return.
+type responseMeta struct {
+	lastModified time.Time
+}
+
+func withResponseMeta(r *http.Request) (*http.Request, *responseMeta) {
+	meta := &responseMeta{}
+	return r.WithContext(context.WithValue(r.Context(), responseMetaKey{}, meta)), meta
+}
+
+// SetLastModified records when the object a handler is returning last
+// changed. It is sent as the Last-Modified header, and lets GET and HEAD
+// requests carrying a later If-Modified-Since be answered with 304 (Not
+// Modified).
+func SetLastModified(r *http.Request, t time.Time) {
+	if meta, ok := r.Context().Value(responseMetaKey{}).(*responseMeta); ok {
+		meta.lastModified = t
+	}
+}
+
+// notModified reports whether r's If-Modified-Since makes a response last
+// modified at t unnecessary.
+func notModified(r *http.Request, t time.Time) bool {
+	if t.IsZero() || (r.Method != "GET" && r.Method != "HEAD") || r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !t.Truncate(time.Second).After(since)
+}
+
+// cachedResponse is a response kept by a ResponseCache, before compression.
+type cachedResponse struct {
+	status       int
+	body         []byte
+	lastModified time.Time
+	expires      time.Time
+}
+
+// ResponseCache keeps responses to GET requests in memory for as long as the
+// Endpoint's CachePolicy allows, so repeated reads skip the handler. Any
+// successful write to the same Endpoint clears its entries. Responses under
+// a Private, NoCache or NoStore policy are never kept, nor are responses to
+// authenticated requests unless the policy is Public.
+type ResponseCache struct {
+	// MaxEntries bounds the number of responses kept. Zero means no limit.
+	MaxEntries int
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+}
+
+// NewResponseCache returns an empty ResponseCache holding at most maxEntries
+// responses.
+func NewResponseCache(maxEntries int) *ResponseCache {
+	return &ResponseCache{MaxEntries: maxEntries, entries: map[string]*cachedResponse{}}
+}
+
+func (c *ResponseCache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *ResponseCache) get(key string) *cachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (c *ResponseCache) put(key string, entry *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]*cachedResponse{}
+	}
+	if c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		// make room by dropping expired entries, or else whatever expires
+		// soonest
+		now := c.now()
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = entry
+}
+
+// Invalidate drops every response kept for the named Endpoint.
+func (c *ResponseCache) Invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if strings.HasPrefix(k, name+" ") {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// cacheKey identifies the response to r by the codec that encoded it and the
+// version that produced it, rather than by the raw Accept header. Responses
+// are kept before compression, so each hit is encoded afresh for the
+// Accept-Encoding of the request it answers.
+func (e *Endpoint) cacheKey(r *http.Request) string {
+	return e.Name + " " + r.URL.RequestURI() + " " + e.responseCodec(r).Accepts + " " + versionFrom(r)
+}
+
+// cached returns the kept response for r, if there is one.
+func (e *Endpoint) cached(r *http.Request, action Action) *cachedResponse {
+	if e.Cache == nil || r.Method != "GET" || !e.cachePolicy(action).storableFor(r) {
+		return nil
+	}
+	return e.Cache.get(e.cacheKey(r))
+}
+
+// cacheResponse sets the caching headers for a successful response, keeps
+// it in the ResponseCache if it may be reused, and clears the cache after a
+// write. Only responses to GET and HEAD requests carry a Cache-Control
+// header.
+func (e *Endpoint) cacheResponse(w http.ResponseWriter, r *http.Request, action Action, entry *cachedResponse, fresh bool) {
+	policy := e.cachePolicy(action)
+	if policy != nil && (r.Method == "GET" || r.Method == "HEAD") {
+		w.Header().Set("Cache-Control", policy.String())
+	}
+	if !entry.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", entry.lastModified.UTC().Format(http.TimeFormat))
+	}
+	if e.Cache == nil {
+		return
+	}
+	switch action {
+	case ActionGet, ActionGetCollection, ActionHead:
+		if fresh && r.Method == "GET" && policy.storableFor(r) {
+			entry.expires = e.Cache.now().Add(policy.MaxAge)
+			e.Cache.put(e.cacheKey(r), entry)
+		}
+	default:
+		e.Cache.Invalidate(e.Name)
+	}
+}
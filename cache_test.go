@@ -0,0 +1,241 @@
+package rest
+
+import (
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func TestCachePolicyString(t *testing.T) {
+	for _, test := range []struct {
+		policy   CachePolicy
+		expected string
+	}{
+		{CachePolicy{MaxAge: time.Minute}, "max-age=60"},
+		{CachePolicy{Public: true, MaxAge: time.Hour, StaleWhileRevalidate: 30 * time.Second}, "public, max-age=3600, stale-while-revalidate=30"},
+		{CachePolicy{Private: true, NoCache: true}, "private, no-cache, max-age=0"},
+		{CachePolicy{NoStore: true, MaxAge: time.Hour}, "no-store"},
+	} {
+		if got := test.policy.String(); got != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, got)
+		}
+	}
+}
+
+func serveCache(e *Endpoint, method, url string, header http.Header) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, url, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	return serveAuth(e, r)
+}
+
+func TestCacheHeaders(t *testing.T) {
+	modified := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	e := newFalseEndpoint("yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		SetLastModified(r, modified.Add(500*time.Millisecond))
+		return nil, nil
+	}
+	e.Head = e.Get
+	e.Delete = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.CachePolicy = &CachePolicy{Public: true, MaxAge: time.Minute}
+	e.MethodCachePolicies = map[Action]*CachePolicy{ActionDelete: nil}
+
+	w := serveCache(e, "GET", "http://example.com/yams/1", nil)
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("Expected Cache-Control from policy, got %q", got)
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Tue, 01 Mar 2016 12:00:00 GMT" {
+		t.Errorf("Expected Last-Modified from handler, got %q", got)
+	}
+	if !varies(w.Header(), "Accept") {
+		t.Errorf("Expected Vary Accept, got %q", w.Header().Values("Vary"))
+	}
+
+	for _, test := range []struct {
+		method, since string
+		code          int
+	}{
+		{"GET", "Tue, 01 Mar 2016 12:00:00 GMT", http.StatusNotModified},
+		{"HEAD", "Tue, 01 Mar 2016 12:00:00 GMT", http.StatusNotModified},
+		{"GET", "Tue, 01 Mar 2016 11:59:59 GMT", http.StatusOK},
+		{"GET", "yesterday", http.StatusOK},
+	} {
+		w := serveCache(e, test.method, "http://example.com/yams/1", http.Header{"If-Modified-Since": {test.since}})
+		if w.Code != test.code {
+			t.Errorf("%s since %q: expected http return code %d, got %d", test.method, test.since, test.code, w.Code)
+		}
+		if test.code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("Cache-Control") == "") {
+			t.Errorf("Expected 304 with no body and Cache-Control, got %q %v", w.Body.String(), w.Header())
+		}
+	}
+
+	if w := serveCache(e, "DELETE", "http://example.com/yams/1", nil); w.Header().Get("Cache-Control") != "" {
+		t.Errorf("Expected no Cache-Control with nil method policy, got %q", w.Header().Get("Cache-Control"))
+	}
+	delete(e.MethodCachePolicies, ActionDelete)
+	if w := serveCache(e, "DELETE", "http://example.com/yams/1", nil); w.Header().Get("Cache-Control") != "" {
+		t.Errorf("Expected no Cache-Control on DELETE, got %q", w.Header().Get("Cache-Control"))
+	}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, ErrNotFound
+	}
+	if w := serveCache(e, "GET", "http://example.com/yams/1", nil); w.Header().Get("Cache-Control") != "" {
+		t.Errorf("Expected no Cache-Control on errors, got %q", w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	calls := 0
+	e := newFalseEndpoint("yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		calls++
+		return nil, nil
+	}
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		calls++
+		return nil, nil
+	}
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.CachePolicy = &CachePolicy{MaxAge: time.Minute}
+	e.Cache = NewResponseCache(2)
+	e.Cache.Now = func() time.Time { return now }
+
+	get := func(url string, expected int) {
+		calls = 0
+		if w := serveCache(e, "GET", url, nil); w.Code != http.StatusOK || w.Body.String() != "YAMSYAMSYAMS" {
+			t.Errorf("GET %s: expected cached or fresh body, got %d %q", url, w.Code, w.Body.String())
+		}
+		if calls != expected {
+			t.Errorf("GET %s: expected %d handler calls, got %d", url, expected, calls)
+		}
+	}
+	get("http://example.com/yams/1", 1)
+	get("http://example.com/yams/1", 0)
+	get("http://example.com/yams", 1)
+	get("http://example.com/yams", 0)
+
+	// writes clear the endpoint's entries
+	serveCache(e, "PUT", "http://example.com/yams/1", nil)
+	get("http://example.com/yams/1", 1)
+
+	now = now.Add(2 * time.Minute)
+	get("http://example.com/yams/1", 1)
+
+	// MaxEntries makes room by dropping expired entries, then the entry
+	// expiring first
+	now = now.Add(time.Second)
+	get("http://example.com/yams/2", 1)
+	now = now.Add(time.Second)
+	get("http://example.com/yams/3", 1)
+	get("http://example.com/yams/3", 0)
+	get("http://example.com/yams/2", 0)
+	get("http://example.com/yams/1", 1)
+
+	e.MethodCachePolicies = map[Action]*CachePolicy{ActionGet: {Private: true, MaxAge: time.Minute}}
+	get("http://example.com/yams/4", 1)
+	get("http://example.com/yams/4", 1)
+}
+
+func TestResponseCacheAuthenticated(t *testing.T) {
+	calls := 0
+	e := newFalseEndpoint("yams")
+	e.Authenticator = BasicAuth{
+		Realm: "yams",
+		Verify: func(username, password string) (*Principal, error) {
+			return &Principal{Name: username}, nil
+		},
+	}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		calls++
+		return nil, nil
+	}
+	e.CachePolicy = &CachePolicy{MaxAge: time.Minute}
+	e.Cache = NewResponseCache(0)
+
+	get := func(username string, expected int) {
+		calls = 0
+		r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+		r.SetBasicAuth(username, "sweetpotato")
+		if w := serveAuth(e, r); w.Code != http.StatusOK {
+			t.Errorf("GET as %s: expected http return code %d, got %d", username, http.StatusOK, w.Code)
+		}
+		if calls != expected {
+			t.Errorf("GET as %s: expected %d handler calls, got %d", username, expected, calls)
+		}
+	}
+	// one caller's response is never served to another
+	get("jo", 1)
+	get("sam", 1)
+	get("jo", 1)
+
+	// unless the policy says it is the same for everyone
+	e.CachePolicy.Public = true
+	get("jo", 1)
+	get("sam", 0)
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	calls := 0
+	e := newFalseEndpoint("yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		calls++
+		return nil, nil
+	}
+	e.Alternates = []Codec{{
+		Accepts: "application/json",
+		Marshal: func(v interface{}) ([]byte, error) {
+			return []byte(`"yams"`), nil
+		},
+	}}
+	e.Compression = &Compression{}
+	e.CachePolicy = &CachePolicy{MaxAge: time.Minute}
+	e.Cache = NewResponseCache(0)
+
+	for _, test := range []struct {
+		accept, acceptEncoding, body string
+		calls                        int
+	}{
+		{"application/yams", "", "YAMSYAMSYAMS", 1},
+		{"application/json", "", `"yams"`, 1},
+		{"application/yams, text/html;q=0.5", "", "YAMSYAMSYAMS", 0},
+		{"application/json", "gzip", "", 0},
+		{"application/json", "identity", `"yams"`, 0},
+	} {
+		calls = 0
+		w := tryVersions(e.Handler(), "http://example.com/yams/1", map[string]string{"Accept": test.accept, "Accept-Encoding": test.acceptEncoding})
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("Accept %q: expected body %q, got %q", test.accept, test.body, w.Body.String())
+		}
+		if enc := w.Header().Get("Content-Encoding"); (test.acceptEncoding == "gzip") != (enc == "gzip") {
+			t.Errorf("Accept-Encoding %q: got Content-Encoding %q", test.acceptEncoding, enc)
+		}
+		if calls != test.calls {
+			t.Errorf("Accept %q: expected %d handler calls, got %d", test.accept, test.calls, calls)
+		}
+	}
+
+	// versions sharing a cache keep their responses apart
+	cache := NewResponseCache(0)
+	v := NewVersions(VersionByHeader)
+	for _, name := range []string{"1", "2"} {
+		version := newVersionedEndpoint("application/yams", "v"+name)
+		version.CachePolicy, version.Cache = &CachePolicy{MaxAge: time.Minute}, cache
+		v.Add(name, version)
+	}
+	h := v.Handler()
+	for _, name := range []string{"1", "2", "1"} {
+		w := tryVersions(h, "http://example.com/yams/1", map[string]string{"Accept": "application/yams", "X-API-Version": name})
+		if w.Body.String() != "v"+name {
+			t.Errorf("Version %s: expected body %q, got %q", name, "v"+name, w.Body.String())
+		}
+	}
+}
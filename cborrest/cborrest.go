@@ -0,0 +1,536 @@
+package cborrest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"time"
+
+	"rest"
+	"rest/internal/tagcodec"
+)
+
+// MediaType is the content type of CBOR bodies.
+const MediaType = "application/cbor"
+
+// maxDepth bounds the nesting of decoded arrays, maps and tags.
+const maxDepth = 1000
+
+// indefinite is the additional information marking an indefinite length.
+const indefinite = 31
+
+var (
+	errTruncated = errors.New("cborrest: unexpected end of data")
+	errTooDeep   = errors.New("cborrest: nesting too deep")
+	errBreak     = errors.New("cborrest: unexpected break")
+)
+
+// Codec is a REST codec set up for CBOR requests and responses. By default
+// it only allows request bodies of up to a megabyte.
+var Codec rest.Codec = NewCodec(Options{})
+
+func init() {
+	rest.RegisterCodec(Codec)
+}
+
+// Options control how values are encoded.
+type Options struct {
+	// Deterministic follows the core deterministic encoding of RFC 8949:
+	// map entries are sorted by their encoded keys, and floats take the
+	// shortest of the half, single and double precision forms that holds
+	// them exactly. Integers and lengths are always encoded in the shortest
+	// form, and struct fields always come out in declaration order.
+	Deterministic bool
+}
+
+// Marshal returns the CBOR encoding of v. Structs become maps keyed by field
+// name, honoring json tags as encoding/json does, and values implementing
+// encoding.TextMarshaler (such as time.Time) become text strings.
+func Marshal(v interface{}) ([]byte, error) {
+	return Options{}.Marshal(v)
+}
+
+// Marshal returns the CBOR encoding of v.
+func (o Options) Marshal(v interface{}) ([]byte, error) {
+	return tagcodec.Encode(writer{shortestFloats: o.Deterministic}, nil, reflect.ValueOf(v), o.Deterministic)
+}
+
+// Unmarshal decodes CBOR data into the value v points to, matching map keys
+// to struct fields as encoding/json does. Indefinite-length items are
+// accepted. Tags 0 and 1 decode to time.Time; other tags are ignored and
+// their content decoded as is.
+func Unmarshal(data []byte, v interface{}) error {
+	d := decoder{data: data}
+	src, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(data) {
+		return fmt.Errorf("cborrest: %d bytes of trailing data", len(data)-d.pos)
+	}
+	return tagcodec.Unmarshal(src, v)
+}
+
+// NewCodec returns a CBOR codec encoding with the given options.
+func NewCodec(o Options) rest.Codec {
+	return rest.Codec{
+		Accepts:    MediaType,
+		MaxSize:    1 << 20, // 1 megabyte
+		Marshal:    o.Marshal,
+		Unmarshal:  Unmarshal,
+		SplitArray: splitArray,
+	}
+}
+
+// NewEndpoint returns a *rest.Endpoint configured to use CBOR.
+func NewEndpoint(name string) *rest.Endpoint {
+	return &rest.Endpoint{
+		GetCollection:  rest.UnimplementedCollectionHandler,
+		PostCollection: rest.UnimplementedCollectionHandler,
+
+		Get:    rest.UnimplementedHandler,
+		Head:   rest.UnimplementedHandler,
+		Put:    rest.UnimplementedHandler,
+		Post:   rest.UnimplementedHandler,
+		Delete: rest.UnimplementedHandler,
+
+		Codec:            Codec,
+		Name:             name,
+		StatusCodeLookup: map[error]int{},
+		Logger:           rest.IOLogger{Writer: os.Stdout},
+	}
+}
+
+// splitArray splits an encoded array into its encoded items.
+func splitArray(data []byte) ([][]byte, bool) {
+	d := decoder{data: data}
+	if len(data) == 0 || data[0]>>5 != 4 {
+		return nil, false
+	}
+	n, err := d.argument(data[0] & 0x1f)
+	if err != nil {
+		return nil, false
+	}
+	var items [][]byte
+	for i := uint64(0); i < n; i++ {
+		if data[0]&0x1f == indefinite {
+			if done, err := d.atBreak(); err != nil {
+				return nil, false
+			} else if done {
+				break
+			}
+		}
+		start := d.pos
+		if _, err := d.value(1); err != nil {
+			return nil, false
+		}
+		items = append(items, data[start:d.pos])
+	}
+	return items, d.pos == len(data)
+}
+
+// writer implements tagcodec.Writer for CBOR.
+type writer struct {
+	shortestFloats bool
+}
+
+// appendHead appends the head of an item of major type major with argument n,
+// in its shortest form.
+func appendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+func (writer) AppendNil(b []byte) []byte { return append(b, 0xf6) }
+
+func (writer) AppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xf5)
+	}
+	return append(b, 0xf4)
+}
+
+func (writer) AppendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(b, 1, uint64(-1-v))
+	}
+	return appendHead(b, 0, uint64(v))
+}
+
+func (writer) AppendUint(b []byte, v uint64) []byte {
+	return appendHead(b, 0, v)
+}
+
+func (w writer) AppendFloat(b []byte, v float64, bits int) []byte {
+	if w.shortestFloats {
+		if h, ok := toHalf(v); ok {
+			return binary.BigEndian.AppendUint16(append(b, 0xf9), h)
+		}
+		if float64(float32(v)) == v {
+			bits = 32
+		}
+	}
+	if bits == 32 {
+		return binary.BigEndian.AppendUint32(append(b, 0xfa), math.Float32bits(float32(v)))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xfb), math.Float64bits(v))
+}
+
+func (writer) AppendString(b []byte, v string) []byte {
+	return append(appendHead(b, 3, uint64(len(v))), v...)
+}
+
+func (writer) AppendBytes(b []byte, v []byte) []byte {
+	return append(appendHead(b, 2, uint64(len(v))), v...)
+}
+
+func (writer) AppendArrayHeader(b []byte, n int) []byte {
+	return appendHead(b, 4, uint64(n))
+}
+
+func (writer) AppendMapHeader(b []byte, n int) []byte {
+	return appendHead(b, 5, uint64(n))
+}
+
+// toHalf returns the half precision encoding of v, if it has one that
+// holds v exactly. NaNs all become the canonical quiet NaN.
+func toHalf(v float64) (uint16, bool) {
+	var sign uint16
+	if math.Signbit(v) {
+		sign = 0x8000
+	}
+	switch {
+	case math.IsNaN(v):
+		return 0x7e00, true
+	case math.IsInf(v, 0):
+		return sign | 0x7c00, true
+	case v == 0:
+		return sign, true
+	}
+	frac, exp := math.Frexp(math.Abs(v))
+	exp-- // v = (frac*2) * 2^exp with frac*2 in [1, 2)
+	var h uint16
+	switch {
+	case exp > 15:
+		return 0, false
+	case exp >= -14:
+		m := (frac*2 - 1) * 1024
+		if m != math.Trunc(m) {
+			return 0, false
+		}
+		h = sign | uint16(exp+15)<<10 | uint16(m)
+	default:
+		m := math.Ldexp(math.Abs(v), 24)
+		if m != math.Trunc(m) || m >= 1024 {
+			return 0, false
+		}
+		h = sign | uint16(m)
+	}
+	return h, fromHalf(h) == v
+}
+
+// fromHalf decodes a half precision float.
+func fromHalf(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant != 0 {
+			return math.NaN()
+		}
+		v = math.Inf(1)
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		v = -v
+	}
+	return v
+}
+
+// decoder parses CBOR into tagcodec's generic values.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) next(n uint64) ([]byte, error) {
+	if uint64(len(d.data)-d.pos) < n {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// argument reads the argument following an initial byte with additional
+// information ai. An indefinite length is reported as math.MaxUint64.
+func (d *decoder) argument(ai byte) (uint64, error) {
+	d.pos++
+	switch {
+	case ai < 24:
+		return uint64(ai), nil
+	case ai == indefinite:
+		return math.MaxUint64, nil
+	case ai > 27:
+		return 0, fmt.Errorf("cborrest: invalid additional information %d", ai)
+	}
+	b, err := d.next(1 << (ai - 24))
+	if err != nil {
+		return 0, err
+	}
+	switch len(b) {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// atBreak consumes a break stop code if one is next.
+func (d *decoder) atBreak() (bool, error) {
+	if d.pos >= len(d.data) {
+		return false, errTruncated
+	}
+	if d.data[d.pos] == 0xff {
+		d.pos++
+		return true, nil
+	}
+	return false, nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	if d.pos >= len(d.data) {
+		return nil, errTruncated
+	}
+	c := d.data[d.pos]
+	major, ai := c>>5, c&0x1f
+	if major == 7 {
+		return d.simple(ai)
+	}
+	n, err := d.argument(ai)
+	if err != nil {
+		return nil, err
+	}
+	if ai == indefinite && (major < 2 || major == 6) {
+		return nil, fmt.Errorf("cborrest: invalid indefinite length for major type %d", major)
+	}
+	if ai != indefinite && n == math.MaxUint64 && major >= 2 && major <= 5 {
+		// too long to be real, and would read as indefinite below
+		return nil, errTruncated
+	}
+
+	switch major {
+	case 0:
+		if n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+		return n, nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cborrest: negative integer out of range")
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		b, err := d.str(major, n)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(b), nil
+		}
+		return b, nil
+	case 4:
+		return d.array(n, depth)
+	case 5:
+		return d.dict(n, depth)
+	}
+	return d.tag(n, depth)
+}
+
+// simple decodes the items of major type 7: floats and simple values.
+func (d *decoder) simple(ai byte) (interface{}, error) {
+	d.pos++
+	switch ai {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23: // null, undefined
+		return nil, nil
+	case 25:
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		return fromHalf(binary.BigEndian.Uint16(b)), nil
+	case 26:
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 27:
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case indefinite:
+		return nil, errBreak
+	}
+	return nil, fmt.Errorf("cborrest: unsupported simple value %d", ai)
+}
+
+// str reads a byte or text string, joining the chunks of an
+// indefinite-length one.
+func (d *decoder) str(major byte, n uint64) ([]byte, error) {
+	if n != math.MaxUint64 {
+		b, err := d.next(n)
+		return append([]byte{}, b...), err
+	}
+	b := []byte{}
+	for {
+		done, err := d.atBreak()
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return b, nil
+		}
+		c := d.data[d.pos]
+		if c>>5 != major || c&0x1f == indefinite {
+			return nil, errors.New("cborrest: invalid chunk in indefinite-length string")
+		}
+		n, err := d.argument(c & 0x1f)
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, chunk...)
+	}
+}
+
+func (d *decoder) array(n uint64, depth int) (interface{}, error) {
+	var items []interface{}
+	if n != math.MaxUint64 {
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, errTruncated
+		}
+		items = make([]interface{}, 0, n)
+	} else {
+		items = []interface{}{}
+	}
+	for i := uint64(0); i < n; i++ {
+		if n == math.MaxUint64 {
+			if done, err := d.atBreak(); err != nil || done {
+				return items, err
+			}
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (d *decoder) dict(n uint64, depth int) (interface{}, error) {
+	if n != math.MaxUint64 && n > uint64(len(d.data)-d.pos) {
+		return nil, errTruncated
+	}
+	var keys, values []interface{}
+	allStrings := true
+	for i := uint64(0); i < n; i++ {
+		if n == math.MaxUint64 {
+			done, err := d.atBreak()
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				break
+			}
+		}
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.(string); !ok {
+			allStrings = false
+		}
+		keys, values = append(keys, k), append(values, v)
+	}
+	if allStrings {
+		m := make(map[string]interface{}, len(keys))
+		for i, k := range keys {
+			m[k.(string)] = values[i]
+		}
+		return m, nil
+	}
+	m := make(map[interface{}]interface{}, len(keys))
+	for i, k := range keys {
+		if k != nil && !reflect.TypeOf(k).Comparable() {
+			return nil, fmt.Errorf("cborrest: unusable map key of type %T", k)
+		}
+		m[k] = values[i]
+	}
+	return m, nil
+}
+
+// tag decodes a tagged item. Tags 0 (RFC 3339 text) and 1 (seconds since
+// the epoch) become time.Time; the content of other tags is returned as is.
+func (d *decoder) tag(n uint64, depth int) (interface{}, error) {
+	v, err := d.value(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	switch n {
+	case 0:
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("cborrest: malformed date/time string")
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case 1:
+		switch t := v.(type) {
+		case int64:
+			return time.Unix(t, 0).UTC(), nil
+		case uint64:
+			return nil, errors.New("cborrest: epoch time out of range")
+		case float64:
+			sec, frac := math.Modf(t)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		return nil, errors.New("cborrest: malformed epoch time")
+	}
+	return v, nil
+}
@@ -0,0 +1,242 @@
+package cborrest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"time"
+
+	"rest"
+)
+
+type testT struct {
+	Yams     string            `json:"yams"`
+	HasYams  bool              `json:"has_yams"`
+	YamCount int               `json:"yam_count"`
+	Weight   float64           `json:"weight,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Notes    map[string]string `json:"notes,omitempty"`
+	Harvest  time.Time         `json:"harvest"`
+	Secret   string            `json:"-"`
+}
+
+func TestEncoding(t *testing.T) {
+	// examples from RFC 8949, appendix A
+	for _, test := range []struct {
+		v        interface{}
+		expected string
+	}{
+		{nil, "f6"},
+		{false, "f4"},
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{1000000, "1a000f4240"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{int64(math.MinInt64), "3b7fffffffffffffff"},
+		{1.1, "fb3ff199999999999a"},
+		{float32(100000), "fa47c35000"},
+		{"IETF", "6449455446"},
+		{"ü", "62c3bc"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]int{1, 2, 3}, "83010203"},
+		{struct {
+			A int `json:"a"`
+			B int `json:"b,omitempty"`
+		}{A: 1}, "a1616101"},
+	} {
+		data, err := Marshal(test.v)
+		if err != nil {
+			t.Fatalf("Error marshaling %#v: %s", test.v, err)
+		}
+		if got := hex.EncodeToString(data); got != test.expected {
+			t.Errorf("%#v: expected %s, got %s", test.v, test.expected, got)
+		}
+	}
+}
+
+func TestDecoding(t *testing.T) {
+	for _, test := range []struct {
+		data     string
+		expected interface{}
+	}{
+		{"f90000", 0.0},
+		{"f93c00", 1.0},
+		{"f97bff", 65504.0},
+		{"f90001", 5.960464477539063e-08},
+		{"f9c400", -4.0},
+		{"f97c00", math.Inf(1)},
+		{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9f018202039f0405ffff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"bf61610161629f0203ffff", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"c074323031332d30332d32315432303a30343a30305a", time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{"c11a514b67b0", time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{"c1fb41d452d9ec200000", time.Date(2013, 3, 21, 20, 4, 0, 500000000, time.UTC)},
+		{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", "http://www.example.com"},
+	} {
+		data, _ := hex.DecodeString(test.data)
+		var v interface{}
+		if err := Unmarshal(data, &v); err != nil {
+			t.Errorf("Error decoding %s: %s", test.data, err)
+			continue
+		}
+		if tm, ok := v.(time.Time); ok {
+			v = tm.UTC()
+		}
+		if !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("%s: expected %#v, got %#v", test.data, test.expected, v)
+		}
+	}
+
+	var v interface{}
+	if data, _ := hex.DecodeString("f97e00"); Unmarshal(data, &v) != nil || !math.IsNaN(v.(float64)) {
+		t.Errorf("Expected NaN, got %v", v)
+	}
+	for _, bad := range []string{"", "82", "9f01", "5f01ff", "ff", "1c", "3bffffffffffffffff", "f6f6", "5b7fffffffffffffff"} {
+		data, _ := hex.DecodeString(bad)
+		var v interface{}
+		if err := Unmarshal(data, &v); err == nil {
+			t.Errorf("Expected error decoding %q", bad)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := testT{
+		Yams:     "YAMSYAMSYAMS",
+		HasYams:  true,
+		YamCount: -3,
+		Weight:   1.25,
+		Tags:     []string{"orange", "sweet"},
+		Notes:    map[string]string{"b": "2", "a": "1"},
+		Harvest:  time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC),
+		Secret:   "hidden",
+	}
+	for _, o := range []Options{{}, {Deterministic: true}} {
+		data, err := o.Marshal(in)
+		if err != nil {
+			t.Fatalf("Error marshaling: %s", err)
+		}
+		var out testT
+		if err := Unmarshal(data, &out); err != nil {
+			t.Fatalf("Error unmarshaling: %s", err)
+		}
+		expected := in
+		expected.Secret = ""
+		if !reflect.DeepEqual(expected, out) {
+			t.Errorf("Expected %+v, got %+v", expected, out)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	o := Options{Deterministic: true}
+	for _, test := range []struct {
+		v        interface{}
+		expected string
+	}{
+		{0.0, "f90000"},
+		{math.Copysign(0, -1), "f98000"},
+		{1.5, "f93e00"},
+		{65504.0, "f97bff"},
+		{5.960464477539063e-08, "f90001"},
+		{100000.0, "fa47c35000"},
+		{float32(3.4028234663852886e+38), "fa7f7fffff"},
+		{1.1, "fb3ff199999999999a"},
+		{math.NaN(), "f97e00"},
+		{math.Inf(-1), "f9fc00"},
+		{map[string]int{"bb": 2, "a": 1, "c": 3}, "a3616101616303626262" + "02"},
+	} {
+		data, err := o.Marshal(test.v)
+		if err != nil {
+			t.Fatalf("Error marshaling %#v: %s", test.v, err)
+		}
+		if got := hex.EncodeToString(data); got != test.expected {
+			t.Errorf("%#v: expected %s, got %s", test.v, test.expected, got)
+		}
+	}
+
+	m := map[string]int{}
+	for _, k := range strings.Split("the quick brown fox jumps over lazy dogs", " ") {
+		m[k] = len(k)
+	}
+	first, _ := o.Marshal(m)
+	for i := 0; i < 20; i++ {
+		if data, _ := o.Marshal(m); !bytes.Equal(data, first) {
+			t.Fatalf("Expected identical encodings, got %x and %x", first, data)
+		}
+	}
+}
+
+func TestNewEndpoint(t *testing.T) {
+	e := NewEndpoint("yams")
+	e.Model = testT{}
+	e.Post = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		yam := *rest.Decoded(r).(*testT)
+		yam.YamCount = strings.Count(yam.Yams, "YAMS")
+		yam.HasYams = yam.YamCount > 0
+		return yam, nil
+	}
+	handler := e.Handler()
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/yams/1", nil)
+	r.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("With invalid Accept: expected http return code %d, got %d", http.StatusNotAcceptable, w.Code)
+	}
+
+	data, _ := Marshal(testT{Yams: "YAMSYAMSYAMS"})
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "http://example.com/yams/1", bytes.NewReader(data))
+	r.Header.Set("Accept", MediaType)
+	r.Header.Set("Content-Type", MediaType)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("With a CBOR body: expected http return code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Content-Type") != MediaType {
+		t.Errorf("Expected Content-Type %s, got %s", MediaType, w.Header().Get("Content-Type"))
+	}
+	var resp testT
+	if err := Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response body: %s", err)
+	}
+	if !resp.HasYams || resp.YamCount != 3 {
+		t.Errorf("Expected 3 yams, got %+v", resp)
+	}
+}
+
+func TestSplitArray(t *testing.T) {
+	definite, _ := Marshal([]interface{}{testT{Yams: "a"}, 2, "three"})
+	// the same array with an indefinite length
+	indefinite := append(append([]byte{0x9f}, definite[1:]...), 0xff)
+	for _, data := range [][]byte{definite, indefinite} {
+		items, ok := Codec.SplitArray(data)
+		if !ok || len(items) != 3 {
+			t.Fatalf("%x: expected 3 items, got %d (ok %t)", data, len(items), ok)
+		}
+		var first testT
+		if err := Unmarshal(items[0], &first); err != nil || first.Yams != "a" {
+			t.Errorf("Expected first item to decode, got %+v (%v)", first, err)
+		}
+		if _, ok := Codec.SplitArray(data[:len(data)-1]); ok {
+			t.Errorf("Expected a truncated array not to split")
+		}
+	}
+	if data, _ := Marshal(testT{}); func() bool { _, ok := Codec.SplitArray(data); return ok }() {
+		t.Errorf("Expected a map not to split")
+	}
+}
@@ -0,0 +1,17 @@
+/*
+Package cborrest provides a bootstrapped CBOR-REST service implementation for
+Go's net/http package, in the same way rest/jsonrest does for JSON. CBOR
+(RFC 8949) is a compact binary format with a JSON-like data model.
+
+	e := cborrest.NewEndpoint("yams")
+	http.Handle("/", e.Handler())
+
+The encoder is built in, so there is nothing else to install. Structs are
+encoded as maps keyed by field name and honor the same json tags as
+encoding/json, so one type can serve both a JSON and a CBOR endpoint. Set
+Options.Deterministic for the core deterministic encoding of RFC 8949, under
+which equal values always encode to the same bytes:
+
+	e.Codec = cborrest.NewCodec(cborrest.Options{Deterministic: true})
+*/
+package cborrest
@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EncoderFunc wraps w so that whatever is written to the returned writer is
+// compressed into w. Closing the returned writer must flush it.
+type EncoderFunc func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]EncoderFunc{
+		"gzip": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		// the HTTP deflate coding is the zlib format, not bare DEFLATE
+		"deflate": func(w io.Writer) (io.WriteCloser, error) {
+			return zlib.NewWriter(w), nil
+		},
+	}
+)
+
+// RegisterEncoder makes a content coding available for response compression,
+// replacing any encoder already registered under name. gzip and deflate are
+// built in; brotli, for instance, can be added with
+//
+//	rest.RegisterEncoder("br", func(w io.Writer) (io.WriteCloser, error) {
+//		return brotli.NewWriter(w), nil
+//	})
+func RegisterEncoder(name string, f EncoderFunc) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[strings.ToLower(name)] = f
+}
+
+func encoder(name string) EncoderFunc {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	return encoders[name]
+}
+
+// DefaultCompressibleTypes are the media types compressed when a Compression
+// does not list its own. Types ending in +json or +xml are compressed too.
+var DefaultCompressibleTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"text/*",
+}
+
+// Compression configures compression of an Endpoint's responses, negotiated
+// with the client's Accept-Encoding header.
+type Compression struct {
+	// MinSize is the smallest response body, in bytes, worth compressing.
+	MinSize int
+	// Types lists the media types to compress; a type ending in "/*" matches
+	// a whole family. If empty, DefaultCompressibleTypes is used.
+	Types []string
+	// Encodings lists the content codings the server offers, most preferred
+	// first, for breaking ties between codings the client ranks equally. If
+	// empty, br (when registered), gzip and deflate are offered.
+	Encodings []string
+}
+
+// compressible reports whether responses of the given content type should be
+// compressed.
+func (c *Compression) compressible(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	types := c.Types
+	if len(types) == 0 {
+		if strings.HasSuffix(t, "+json") || strings.HasSuffix(t, "+xml") {
+			return true
+		}
+		types = DefaultCompressibleTypes
+	}
+	for _, allowed := range types {
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(t, allowed[:len(allowed)-1]) {
+			return true
+		}
+		if strings.EqualFold(allowed, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate picks the content coding to use for a request's Accept-Encoding
+// header, or "" to send the body as it is.
+func (c *Compression) negotiate(acceptEncoding string) string {
+	offered := c.Encodings
+	if len(offered) == 0 {
+		offered = []string{"br", "gzip", "deflate"}
+	}
+	q := parseAcceptEncoding(acceptEncoding)
+	best, bestQ := "", 0.0
+	for _, name := range offered {
+		name = strings.ToLower(name)
+		if encoder(name) == nil {
+			continue
+		}
+		weight, ok := q[name]
+		if !ok {
+			weight = q["*"]
+		}
+		if weight > bestQ {
+			best, bestQ = name, weight
+		}
+	}
+	return best
+}
+
+// parseAcceptEncoding returns the quality the client gave each coding.
+func parseAcceptEncoding(header string) map[string]float64 {
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					weight = v
+				}
+			}
+		}
+		q[name] = weight
+	}
+	return q
+}
+
+// addVary adds field to the Vary header unless it is already listed.
+func addVary(h http.Header, field string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// contentCoding picks the content coding for a response of size bytes, or
+// -1 if its size is not known in advance, setting Content-Encoding and
+// marking any strong ETag with the coding so that it stays unique to
+// this representation. It returns "" if the body should go out as it is.
+func (e *Endpoint) contentCoding(w http.ResponseWriter, r *http.Request, statusCode, size int) string {
+	c := e.Compression
+	h := w.Header()
+	if c == nil || h.Get("Content-Encoding") != "" || !c.compressible(h.Get("Content-Type")) {
+		return ""
+	}
+	if (size >= 0 && size < c.MinSize) || statusCode < 200 ||
+		statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		return ""
+	}
+	name := c.negotiate(r.Header.Get("Accept-Encoding"))
+	if name == "" {
+		return ""
+	}
+	h.Set("Content-Encoding", name)
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) && strings.HasSuffix(etag, `"`) && len(etag) > 1 {
+		h.Set("ETag", etag[:len(etag)-1]+"-"+name+`"`)
+	}
+	return name
+}
+
+// compress encodes a response body according to the endpoint's Compression
+// and the request's Accept-Encoding. It returns data untouched if the body
+// should go out as it is.
+func (e *Endpoint) compress(w http.ResponseWriter, r *http.Request, statusCode int, data []byte) ([]byte, error) {
+	name := e.contentCoding(w, r, statusCode, len(data))
+	if name == "" {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	zw, err := encoder(name)(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,210 @@
+package rest
+
+import (
+	"testing"
+
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func newCompressEndpoint(body string) *Endpoint {
+	e := NewEndpoint("yams")
+	e.Codec.Accepts = "application/json"
+	e.Codec.Marshal = func(v interface{}) ([]byte, error) {
+		return []byte(body), nil
+	}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.Head = e.Get
+	e.Compression = &Compression{MinSize: 1 << 10}
+	return e
+}
+
+func serveCompressed(e *Endpoint, method, acceptEncoding string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, "http://example.com/yams/1", nil)
+	r.Header.Set("Accept", "application/json")
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	return w
+}
+
+// varies reports whether h lists field in Vary.
+func varies(h http.Header, field string) bool {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.TrimSpace(f) == field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	c := &Compression{}
+	for _, test := range []struct {
+		header, expected string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"deflate, gzip;q=0.5", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"*", "gzip"},
+		{"*, gzip;q=0", "deflate"},
+		{"identity", ""},
+		{"br", ""},
+	} {
+		if got := c.negotiate(test.header); got != test.expected {
+			t.Errorf("Accept-Encoding %q: expected %q, got %q", test.header, test.expected, got)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	body := strings.Repeat(`{"yam":"garnet"},`, 100)
+	e := newCompressEndpoint(body)
+
+	w := serveCompressed(e, "GET", "gzip, deflate")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if !varies(w.Header(), "Accept-Encoding") {
+		t.Errorf("Expected Vary Accept-Encoding, got %q", w.Header().Values("Vary"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Error reading gzip body: %s", err)
+	}
+	if got, _ := ioutil.ReadAll(zr); string(got) != body {
+		t.Errorf("Expected gzip body to decode to the original, got %q", got)
+	}
+
+	w = serveCompressed(e, "GET", "deflate")
+	dr, err := zlib.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Error reading deflate body: %s", err)
+	}
+	if got, _ := ioutil.ReadAll(dr); w.Header().Get("Content-Encoding") != "deflate" || string(got) != body {
+		t.Errorf("Expected deflate body, got %q encoding", w.Header().Get("Content-Encoding"))
+	}
+
+	w = serveCompressed(e, "GET", "")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Errorf("Expected uncompressed body without Accept-Encoding")
+	}
+	if !varies(w.Header(), "Accept-Encoding") {
+		t.Errorf("Expected Vary on uncompressed response, got %q", w.Header().Values("Vary"))
+	}
+
+	// errors vary too, since a cache must not hand them to other clients
+	// in place of a compressed success
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, ErrNotFound
+	}
+	if w = serveCompressed(e, "GET", "gzip"); !varies(w.Header(), "Accept-Encoding") {
+		t.Errorf("Expected Vary on a failure, got %q", w.Header().Values("Vary"))
+	}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+
+	// without Compression, bodies go out as they are
+	plain := newCompressEndpoint(body)
+	plain.Compression = nil
+	if w = serveCompressed(plain, "GET", "gzip"); w.Header().Get("Content-Encoding") != "" || varies(w.Header(), "Accept-Encoding") {
+		t.Errorf("Expected no compression by default, got %v", w.Header())
+	}
+	if NewEndpoint("yams").Compression != nil {
+		t.Errorf("Expected NewEndpoint to leave Compression nil")
+	}
+
+	// HEAD advertises the same representation as GET
+	get, head := serveCompressed(e, "GET", "gzip"), serveCompressed(e, "HEAD", "gzip")
+	for _, h := range []string{"Content-Encoding", "Content-Length", "Vary"} {
+		if get.Header().Get(h) != head.Header().Get(h) {
+			t.Errorf("HEAD: expected %s %q, got %q", h, get.Header().Get(h), head.Header().Get(h))
+		}
+	}
+}
+
+func TestCompressionThresholds(t *testing.T) {
+	small := newCompressEndpoint(`{"yam":"garnet"}`)
+	if w := serveCompressed(small, "GET", "gzip"); w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected body under MinSize to go out uncompressed")
+	}
+
+	image := newCompressEndpoint(strings.Repeat("x", 2048))
+	image.Codec.Accepts = "image/png"
+	r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+	r.Header.Set("Accept", "image/png")
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	image.Handler().ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "" || varies(w.Header(), "Accept-Encoding") {
+		t.Errorf("Expected type outside the allowlist to be left alone, got %v", w.Header())
+	}
+
+	for contentType, ok := range map[string]bool{
+		"application/json; charset=utf-8": true,
+		"application/hal+json":            true,
+		"text/csv":                        true,
+		"image/png":                       false,
+	} {
+		if (&Compression{}).compressible(contentType) != ok {
+			t.Errorf("Content type %q: expected compressible %t", contentType, ok)
+		}
+	}
+	if (&Compression{Types: []string{"text/csv"}}).compressible("application/json") {
+		t.Errorf("Expected Types to replace the default allowlist")
+	}
+}
+
+type upperWriter struct{ w io.Writer }
+
+func (u upperWriter) Write(p []byte) (int, error) { return u.w.Write(bytes.ToUpper(p)) }
+func (u upperWriter) Close() error                { return nil }
+
+func TestCompressionETag(t *testing.T) {
+	RegisterEncoder("upper", func(w io.Writer) (io.WriteCloser, error) {
+		return upperWriter{w}, nil
+	})
+	defer func() {
+		encodersMu.Lock()
+		delete(encoders, "upper")
+		encodersMu.Unlock()
+	}()
+
+	e := newCompressEndpoint(strings.Repeat("yams", 512))
+	e.Compression.Encodings = []string{"upper", "gzip"}
+	for _, test := range []struct {
+		etag, expected string
+	}{
+		{`"abc"`, `"abc-upper"`},
+		{`W/"abc"`, `W/"abc"`},
+	} {
+		handler := e.Handler()
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+		r.Header.Set("Accept", "application/json")
+		r.Header.Set("Accept-Encoding", "gzip, upper")
+		w.Header().Set("ETag", test.etag)
+		handler.ServeHTTP(w, r)
+		if w.Header().Get("Content-Encoding") != "upper" || !strings.HasPrefix(w.Body.String(), "YAMS") {
+			t.Errorf("Expected registered encoder to be preferred, got %q", w.Header().Get("Content-Encoding"))
+		}
+		if got := w.Header().Get("ETag"); got != test.expected {
+			t.Errorf("ETag %s: expected %s, got %s", test.etag, test.expected, got)
+		}
+	}
+}
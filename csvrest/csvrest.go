@@ -0,0 +1,410 @@
+package csvrest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rest"
+)
+
+const (
+	// MediaType is the content type of CSV bodies.
+	MediaType = "text/csv"
+	// TSVMediaType is the content type of tab-separated bodies.
+	TSVMediaType = "text/tab-separated-values"
+)
+
+var (
+	// Codec is a REST codec answering requests for CSV. It only encodes, so
+	// it is usually added to an Endpoint's Alternates alongside a codec that
+	// decodes requests.
+	Codec rest.Codec = NewCodec(Options{})
+	// TSVCodec does the same for tab-separated values.
+	TSVCodec rest.Codec = NewCodec(Options{Comma: '\t'})
+)
+
+func init() {
+	rest.RegisterCodec(Codec)
+	rest.RegisterCodec(TSVCodec)
+}
+
+// Options control the layout of the table.
+type Options struct {
+	// Comma is the field delimiter. Zero means ','.
+	Comma rune
+	// Columns, if not empty, chooses the columns and their order. Otherwise
+	// rows of structs have a column for every field, in declaration order,
+	// and rows of maps have a column for every key of the first row, sorted.
+	Columns []string
+	// Filename, if not empty, has clients save the response as a file of
+	// that name, through a "Content-Disposition: attachment" header.
+	Filename string
+	// NoHeader leaves out the header row of column names.
+	NoHeader bool
+}
+
+/*
+Stream writes v as a table, one row per item if v is a slice or array, and
+one row otherwise. Rows are flattened into columns:
+
+  - struct fields are named by their csv tag, or else their json tag, or
+    else their Go name; a tag of "-" leaves the field out
+  - nested structs get a column per field, named with a dot, such as
+    "address.city", while the fields of embedded structs are promoted as
+    encoding/json would; maps nested in rows of maps are flattened the
+    same way
+  - values implementing encoding.TextMarshaler, such as time.Time, are
+    written as their text, and other maps and slices as JSON
+
+v may also be a channel or an iterator function, as rest.Each takes. Rows go
+out as they are encoded, so large collections are never held in memory.
+*/
+func (o Options) Stream(w io.Writer, v interface{}) error {
+	cw := csv.NewWriter(w)
+	if o.Comma != 0 {
+		cw.Comma = o.Comma
+	}
+	rows := reflect.ValueOf(v)
+	for rows.Kind() == reflect.Ptr || rows.Kind() == reflect.Interface {
+		rows = rows.Elem()
+	}
+	t := rowType(rows)
+	single := t == nil
+	if single && rows.IsValid() {
+		t = rows.Type()
+	}
+
+	// columns come from the row type if it is a struct, and otherwise from
+	// the first row
+	columns := o.Columns
+	if len(columns) == 0 && t != nil {
+		if t = derefType(t); t.Kind() == reflect.Struct && !isCellType(t) {
+			structColumns(t, "", &columns)
+		}
+	}
+	derive := len(columns) == 0
+	header := o.NoHeader
+	writeHeader := func() error {
+		if header {
+			return nil
+		}
+		header = true
+		return cw.Write(columns)
+	}
+
+	var record []string
+	n := 0
+	writeRow := func(row reflect.Value) error {
+		cells := map[string]string{}
+		if err := flatten("", row, cells); err != nil {
+			return err
+		}
+		if derive {
+			columns, derive = sortedKeys(cells), false
+		}
+		if err := writeHeader(); err != nil {
+			return err
+		}
+		record = record[:0]
+		for _, c := range columns {
+			record = append(record, cells[c])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		// push rows out now and then, for clients reading as they arrive
+		if n++; n%flushEvery == 0 {
+			cw.Flush()
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		return cw.Error()
+	}
+	if single {
+		if rows.IsValid() {
+			if err := writeRow(rows); err != nil {
+				return err
+			}
+		}
+	} else if _, err := rest.Each(rows.Interface(), func(item interface{}) error {
+		return writeRow(reflect.ValueOf(item))
+	}); err != nil {
+		return err
+	}
+	if err := writeHeader(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// flushEvery is how many rows Stream writes between flushes.
+const flushEvery = 100
+
+// rowType returns the type of the items of a sequence, as rest.Each takes
+// them, or nil if v is not a sequence.
+func rowType(v reflect.Value) reflect.Type {
+	if !v.IsValid() {
+		return nil
+	}
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return t.Elem()
+		}
+	case reflect.Chan:
+		return t.Elem()
+	case reflect.Func:
+		if t.NumIn() == 1 && t.In(0).Kind() == reflect.Func && t.In(0).NumIn() == 1 {
+			return t.In(0).In(0)
+		}
+	}
+	return nil
+}
+
+// Marshal returns v as a table, as Stream writes it.
+func (o Options) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := o.Stream(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewCodec returns a codec writing tables with the given options. It is a
+// CSV codec, unless Comma is a tab, which makes it a TSV codec.
+func NewCodec(o Options) rest.Codec {
+	c := rest.Codec{
+		Accepts: MediaType,
+		MaxSize: 1 << 20, // 1 megabyte
+		Marshal: o.Marshal,
+		Stream:  o.Stream,
+	}
+	if o.Comma == '\t' {
+		c.Accepts = TSVMediaType
+	}
+	if o.Filename != "" {
+		c.Header = http.Header{
+			"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": o.Filename})},
+		}
+	}
+	return c
+}
+
+// NewEndpoint returns a *rest.Endpoint configured to answer in CSV.
+func NewEndpoint(name string) *rest.Endpoint {
+	return &rest.Endpoint{
+		GetCollection:  rest.UnimplementedCollectionHandler,
+		PostCollection: rest.UnimplementedCollectionHandler,
+
+		Get:    rest.UnimplementedHandler,
+		Head:   rest.UnimplementedHandler,
+		Put:    rest.UnimplementedHandler,
+		Post:   rest.UnimplementedHandler,
+		Delete: rest.UnimplementedHandler,
+
+		Codec:            Codec,
+		Name:             name,
+		StatusCodeLookup: map[error]int{},
+		Logger:           rest.IOLogger{Writer: os.Stdout},
+	}
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// isCellType reports whether values of type t fill a single cell.
+func isCellType(t reflect.Type) bool {
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return false
+	case reflect.Map:
+		return t.Key().Kind() != reflect.String
+	}
+	return true
+}
+
+func isCell(v reflect.Value) bool {
+	return isCellType(v.Type())
+}
+
+// fieldName returns the column name of a struct field, and whether the
+// field is left out.
+func fieldName(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("csv")
+	if !ok {
+		tag = f.Tag.Get("json")
+	}
+	if tag == "-" {
+		return "", true
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+	return name, false
+}
+
+// embedded reports whether a struct field's fields are promoted.
+func embedded(f reflect.StructField, name string) bool {
+	return f.Anonymous && name == f.Name && derefType(f.Type).Kind() == reflect.Struct
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// structColumns appends the columns of struct type t.
+func structColumns(t reflect.Type, prefix string, columns *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, skip := fieldName(f)
+		if skip || (f.PkgPath != "" && !embedded(f, name)) {
+			continue
+		}
+		ft := derefType(f.Type)
+		switch {
+		case embedded(f, name):
+			structColumns(ft, prefix, columns)
+		case ft.Kind() == reflect.Struct && !isCellType(ft):
+			structColumns(ft, join(prefix, name), columns)
+		default:
+			*columns = append(*columns, join(prefix, name))
+		}
+	}
+}
+
+// sortedKeys returns the columns of a row's cells, sorted.
+func sortedKeys(cells map[string]string) []string {
+	columns := make([]string, 0, len(cells))
+	for c := range cells {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// flatten stores the cells of v in cells, keyed by column.
+func flatten(prefix string, v reflect.Value, cells map[string]string) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if isCell(v) {
+		if prefix == "" {
+			prefix = "value"
+		}
+		s, err := cell(v)
+		cells[prefix] = s
+		return err
+	}
+	if v.Kind() == reflect.Map {
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := flatten(join(prefix, iter.Key().String()), iter.Value(), cells); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, skip := fieldName(f)
+		if skip || (f.PkgPath != "" && !embedded(f, name)) {
+			continue
+		}
+		p := join(prefix, name)
+		if embedded(f, name) {
+			p = prefix
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Map {
+			// a struct's columns are fixed by its type, so its maps are
+			// single cells
+			s, err := cell(fv)
+			cells[p] = s
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := flatten(p, fv, cells); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cell formats a single value.
+func cell(v reflect.Value) (string, error) {
+	if !v.CanInterface() {
+		// promoted through an unexported embedded struct
+		v = reflect.ValueOf(fmt.Sprint(v))
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		text, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return "", nil
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		fallthrough
+	case reflect.Array:
+		data, err := json.Marshal(v.Interface())
+		return string(data), err
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
@@ -0,0 +1,123 @@
+package csvrest
+
+import (
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"rest"
+)
+
+type address struct {
+	City string `json:"city"`
+	Zip  string `csv:"postcode" json:"zip"`
+}
+
+type Audit struct {
+	Created time.Time `json:"created"`
+}
+
+type order struct {
+	ID      int               `json:"id"`
+	Item    string            `csv:"product"`
+	Secret  string            `json:"-"`
+	Ship    address           `json:"ship"`
+	Bill    *address          `json:"bill"`
+	Tags    []string          `json:"tags"`
+	Extra   map[string]string `json:"extra"`
+	private int
+	Audit
+}
+
+func TestStream(t *testing.T) {
+	created := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	orders := []order{
+		{ID: 1, Item: "yams, sweet", Ship: address{"Lagos", "100001"}, Tags: []string{"a", "b"}, Audit: Audit{created}},
+		{ID: 2, Item: `"garnet" yams`, Bill: &address{City: "Accra"}, Extra: map[string]string{"gift": "yes"}},
+	}
+	data, err := Codec.Marshal(orders)
+	if err != nil {
+		t.Fatalf("Error marshaling: %s", err)
+	}
+	expected := "id,product,ship.city,ship.postcode,bill.city,bill.postcode,tags,extra,created\n" +
+		"1,\"yams, sweet\",Lagos,100001,,,\"[\"\"a\"\",\"\"b\"\"]\",,2016-03-01T12:00:00Z\n" +
+		"2,\"\"\"garnet\"\" yams\",,,Accra,,,\"{\"\"gift\"\":\"\"yes\"\"}\",0001-01-01T00:00:00Z\n"
+	if string(data) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, data)
+	}
+
+	// the header comes from the type even with no rows
+	if data, _ := Codec.Marshal([]*order{}); !strings.HasPrefix(string(data), "id,product,") || strings.Count(string(data), "\n") != 1 {
+		t.Errorf("Expected just a header, got %q", data)
+	}
+
+	// maps take their columns from the first row
+	rows := []map[string]interface{}{
+		{"b": 2, "a": map[string]interface{}{"x": 1.5}},
+		{"a": map[string]interface{}{"x": true}, "b": "two", "c": "dropped"},
+	}
+	if data, _ := Codec.Marshal(rows); string(data) != "a.x,b\n1.5,2\ntrue,two\n" {
+		t.Errorf("Expected map rows, got %q", data)
+	}
+
+	o := Options{Comma: '\t', Columns: []string{"product", "id"}, NoHeader: true}
+	if data, _ := o.Marshal(orders[0]); string(data) != "yams, sweet\t1\n" {
+		t.Errorf("Expected a single TSV row, got %q", data)
+	}
+	if data, _ := Codec.Marshal([]int{1, 2}); string(data) != "value\n1\n2\n" {
+		t.Errorf("Expected a value column, got %q", data)
+	}
+	ch := make(chan map[string]int, 2)
+	ch <- map[string]int{"yams": 1}
+	ch <- map[string]int{"yams": 2}
+	close(ch)
+	if data, _ := Codec.Marshal(ch); string(data) != "yams\n1\n2\n" {
+		t.Errorf("Expected rows from the channel, got %q", data)
+	}
+	if data, _ := Codec.Marshal(nil); string(data) != "\n" {
+		t.Errorf("Expected an empty table, got %q", data)
+	}
+}
+
+func TestNewCodec(t *testing.T) {
+	if TSVCodec.Accepts != TSVMediaType {
+		t.Errorf("Expected %s, got %s", TSVMediaType, TSVCodec.Accepts)
+	}
+	c := NewCodec(Options{Filename: "orders 2016.csv"})
+	if cd := c.Header.Get("Content-Disposition"); cd != `attachment; filename="orders 2016.csv"` {
+		t.Errorf("Expected an attachment, got %q", cd)
+	}
+}
+
+func TestAlternate(t *testing.T) {
+	e := rest.NewEndpoint("orders")
+	e.Alternates = []rest.Codec{NewCodec(Options{Filename: "orders.csv"})}
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return []order{{ID: 1, Item: "yams"}}, nil
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/orders", nil)
+	r.Header.Set("Accept", "text/csv")
+	e.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != MediaType {
+		t.Fatalf("Expected %d and %s, got %d and %s", http.StatusOK, MediaType, w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(w.Body.String(), "id,product,") || !strings.Contains(w.Body.String(), "\n1,yams,") {
+		t.Errorf("Expected a CSV table, got %q", w.Body.String())
+	}
+	if w.Header().Get("Content-Disposition") == "" {
+		t.Errorf("Expected a Content-Disposition")
+	}
+
+	// the primary codec does not send it
+	w = httptest.NewRecorder()
+	r.Header.Set("Accept", "text/plain")
+	e.Handler().ServeHTTP(w, r)
+	if w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected no Content-Disposition for text/plain")
+	}
+}
@@ -0,0 +1,16 @@
+/*
+Package csvrest answers REST requests with CSV or TSV tables, for clients
+such as spreadsheets. Its codecs only encode, so they usually join an
+Endpoint's Alternates, giving a JSON endpoint a CSV export:
+
+	e := jsonrest.NewEndpoint("orders")
+	e.Alternates = append(e.Alternates, csvrest.NewCodec(csvrest.Options{
+		Filename: "orders.csv",
+	}))
+
+after which "curl -H 'Accept: text/csv' /orders" downloads orders.csv, with
+one row per item GetCollection returns. Nested structs and maps are flattened
+into dotted columns such as "address.city", and rows are streamed to the
+client as they are encoded. See Options.Stream for the details.
+*/
+package csvrest
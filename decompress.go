@@ -0,0 +1,184 @@
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedEncoding is sent when a request body uses a content coding
+// the server cannot decode. It corresponds to
+// http.StatusUnsupportedMediaType.
+var ErrUnsupportedEncoding error = errors.New("Unsupported content encoding")
+
+// ErrRequestTooLarge is sent when a request body, once decoded, is larger
+// than Codec.MaxSize. It corresponds to http.StatusRequestEntityTooLarge.
+var ErrRequestTooLarge error = errors.New("Request body too large")
+
+// DecoderFunc wraps r so that reading from the returned reader decompresses
+// what is read from r.
+type DecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]DecoderFunc{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"x-gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.ReadCloser, error) {
+			return zlib.NewReader(r)
+		},
+	}
+)
+
+// RegisterDecoder makes a content coding available for request bodies,
+// replacing any decoder already registered under name. gzip and deflate are
+// built in.
+func RegisterDecoder(name string, f DecoderFunc) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[strings.ToLower(name)] = f
+}
+
+func decoder(name string) DecoderFunc {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	return decoders[name]
+}
+
+// readBody reads the request body, returning it both as sent and with any
+// Content-Encoding undone. The decoded body may be no larger than
+// MaxSize of the request's codec, whatever its compressed size.
+func (e *Endpoint) readBody(r *http.Request) (raw, data []byte, err error) {
+	max := e.requestCodec(r).MaxSize
+	raw, err = ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(raw)) > max {
+		return nil, nil, ErrRequestTooLarge
+	}
+
+	// codings are listed in the order they were applied
+	codings := strings.Split(r.Header.Get("Content-Encoding"), ",")
+	data = raw
+	for i := len(codings) - 1; i >= 0; i-- {
+		name := strings.ToLower(strings.TrimSpace(codings[i]))
+		if name == "" || name == "identity" {
+			continue
+		}
+		decode := decoder(name)
+		if decode == nil {
+			return nil, nil, ErrUnsupportedEncoding
+		}
+		zr, err := decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, ErrBadRequest
+		}
+		data, err = ioutil.ReadAll(io.LimitReader(zr, max+1))
+		zr.Close()
+		if err != nil {
+			return nil, nil, ErrBadRequest
+		}
+		if int64(len(data)) > max {
+			return nil, nil, ErrRequestTooLarge
+		}
+	}
+	return raw, data, nil
+}
+
+// LimitReader returns a reader that reads from r but fails with
+// ErrRequestTooLarge, rather than stopping as io.LimitReader does, once more
+// than max bytes have been read. Codecs that decode request bodies
+// themselves can use it to bound parts of a body.
+func LimitReader(r io.Reader, max int64) io.Reader {
+	return &limitedReader{r: r, max: max}
+}
+
+type limitedReader struct {
+	r      io.Reader
+	n, max int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n > l.max {
+		return 0, ErrRequestTooLarge
+	}
+	if int64(len(p)) > l.max-l.n+1 {
+		p = p[:l.max-l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if l.n += int64(n); l.n > l.max {
+		return n - int(l.n-l.max), ErrRequestTooLarge
+	}
+	return n, err
+}
+
+// limitedBody is a request body read through a LimitReader, which closes
+// every reader it was decoded through.
+type limitedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (l *limitedBody) Close() error {
+	var err error
+	for i := len(l.closers) - 1; i >= 0; i-- {
+		if closeErr := l.closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// buffersBody reports whether the body of a request for action must be read
+// in full even if its codec decodes it as it arrives: the Authenticator may
+// check it, unless it is one known to look at headers alone, and Idempotency
+// fingerprints it.
+func (e *Endpoint) buffersBody(action Action) bool {
+	if e.Idempotency != nil && (action == ActionPost || action == ActionPostCollection) {
+		return true
+	}
+	switch e.authenticator(action).(type) {
+	case nil, BasicAuth, *BasicAuth, BearerAuth, *BearerAuth, JWTAuth, *JWTAuth:
+		return false
+	}
+	return true
+}
+
+// streamBody returns a copy of r whose Body undoes any Content-Encoding as
+// it is read, and fails with ErrRequestTooLarge past MaxSize of the request's
+// codec, for codecs that read the body themselves.
+func (e *Endpoint) streamBody(r *http.Request) (*http.Request, error) {
+	var body io.Reader = r.Body
+	closers := []io.Closer{r.Body}
+	codings := strings.Split(r.Header.Get("Content-Encoding"), ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		name := strings.ToLower(strings.TrimSpace(codings[i]))
+		if name == "" || name == "identity" {
+			continue
+		}
+		decode := decoder(name)
+		if decode == nil {
+			return nil, ErrUnsupportedEncoding
+		}
+		zr, err := decode(body)
+		if err != nil {
+			return nil, ErrBadRequest
+		}
+		body = zr
+		closers = append(closers, zr)
+	}
+	r = r.WithContext(r.Context())
+	r.Body = &limitedBody{LimitReader(body, e.requestCodec(r).MaxSize), closers}
+	return r, nil
+}
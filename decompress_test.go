@@ -0,0 +1,166 @@
+package rest
+
+import (
+	"testing"
+
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	var got []byte
+	e := newFalseEndpoint("yams")
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		got = body
+		return nil, nil
+	}
+	e.Codec.MaxSize = 1 << 10
+
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write([]byte("garnet"))
+	zw.Close()
+
+	bomb := gzipBytes(bytes.Repeat([]byte("yams"), 1<<10))
+	if len(bomb) > 1<<10 {
+		t.Fatalf("Expected compressed bomb under MaxSize, was %d bytes", len(bomb))
+	}
+
+	for _, test := range []struct {
+		name, encoding string
+		body           []byte
+		code           int
+		expected       string
+	}{
+		{"identity", "", []byte("garnet"), http.StatusOK, "garnet"},
+		{"gzip", "gzip", gzipBytes([]byte("garnet")), http.StatusOK, "garnet"},
+		{"deflate", "deflate", deflated.Bytes(), http.StatusOK, "garnet"},
+		{"stacked", "gzip, gzip", gzipBytes(gzipBytes([]byte("garnet"))), http.StatusOK, "garnet"},
+		{"bomb", "gzip", bomb, http.StatusRequestEntityTooLarge, ""},
+		{"corrupt", "gzip", []byte("garnet"), http.StatusBadRequest, ""},
+		{"unknown", "br", []byte("garnet"), http.StatusUnsupportedMediaType, ""},
+	} {
+		got = nil
+		r, _ := http.NewRequest("PUT", "http://example.com/yams/1", bytes.NewReader(test.body))
+		if test.encoding != "" {
+			r.Header.Set("Content-Encoding", test.encoding)
+		}
+		if w := serveAuth(e, r); w.Code != test.code {
+			t.Errorf("%s: expected http return code %d, got %d", test.name, test.code, w.Code)
+		}
+		if string(got) != test.expected {
+			t.Errorf("%s: expected handler to get %q, got %q", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestDecompressSignedRequest(t *testing.T) {
+	key := []byte("sekrit")
+	e := newFalseEndpoint("yams")
+	e.Authenticator = HMACAuth{Key: func(keyID string) ([]byte, error) {
+		return key, nil
+	}}
+	e.Post = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if string(body) != "garnet" {
+			t.Errorf("Expected decompressed body, got %q", body)
+		}
+		return nil, nil
+	}
+
+	body := gzipBytes([]byte("garnet"))
+	r, _ := http.NewRequest("POST", "http://example.com/yams/1", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", "gzip")
+	SignRequest(r, "jo", key, body)
+	if w := serveAuth(e, r); w.Code != http.StatusOK {
+		t.Errorf("Expected signature over the compressed body to verify, got %d", w.Code)
+	}
+
+	r, _ = http.NewRequest("POST", "http://example.com/yams/1", strings.NewReader(string(body)))
+	r.Header.Set("Content-Encoding", "gzip")
+	SignRequest(r, "jo", key, []byte("garnet"))
+	if w := serveAuth(e, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected signature over the decoded body to fail, got %d", w.Code)
+	}
+}
+
+func TestStreamRequest(t *testing.T) {
+	var got interface{}
+	e := newFalseEndpoint("yams")
+	e.Model = ""
+	e.Codec.MaxSize = 1 << 10
+	e.Codec.Decode = func(r *http.Request, v interface{}) error {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		if string(data) == "sweet" {
+			return ValidationErrors{{"", "must not be sweet"}}
+		}
+		*v.(*string) = string(data)
+		return nil
+	}
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if body != nil {
+			t.Errorf("Expected a nil body, got %q", body)
+		}
+		got = *Decoded(r).(*string)
+		return nil, nil
+	}
+
+	bomb := gzipBytes(bytes.Repeat([]byte("yams"), 1<<10))
+	for _, test := range []struct {
+		name, encoding string
+		body           []byte
+		code           int
+		expected       interface{}
+	}{
+		{"identity", "", []byte("garnet"), http.StatusOK, "garnet"},
+		{"gzip", "gzip", gzipBytes([]byte("garnet")), http.StatusOK, "garnet"},
+		{"bomb", "gzip", bomb, http.StatusRequestEntityTooLarge, nil},
+		{"invalid", "", []byte("sweet"), http.StatusUnprocessableEntity, nil},
+		{"unknown", "br", []byte("garnet"), http.StatusUnsupportedMediaType, nil},
+	} {
+		got = nil
+		r, _ := http.NewRequest("PUT", "http://example.com/yams/1", bytes.NewReader(test.body))
+		if test.encoding != "" {
+			r.Header.Set("Content-Encoding", test.encoding)
+		}
+		if w := serveAuth(e, r); w.Code != test.code {
+			t.Errorf("%s: expected http return code %d, got %d", test.name, test.code, w.Code)
+		}
+		if got != test.expected {
+			t.Errorf("%s: expected handler to get %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	r := LimitReader(strings.NewReader("sweet yams"), 5)
+	p := make([]byte, 3)
+	var got []byte
+	for i := 0; i < 4; i++ {
+		n, err := r.Read(p)
+		if n < 0 || n > len(p) {
+			t.Fatalf("Read %d: expected a count within [0, %d], got %d", i, len(p), n)
+		}
+		got = append(got, p[:n]...)
+		if i >= 1 && err != ErrRequestTooLarge {
+			t.Errorf("Read %d: expected %v, got %v", i, ErrRequestTooLarge, err)
+		}
+	}
+	if string(got) != "sweet" {
+		t.Errorf("Expected the first 5 bytes, got %q", got)
+	}
+}
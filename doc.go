@@ -1,7 +1,8 @@
 /*
 Package rest provides a simple, powerful, convention-oriented REST API helper for Go's net/http package.
 The package itself handles nearly all the work associated with responding appropriately
-to an HTTP/REST request, and returns an http.Handler (or Gorilla mux.Router) object ready for use.
+to an HTTP/REST request, and returns an http.Handler (or registers itself on an http.ServeMux) ready for use.
+Applications routing with Gorilla mux can use the adapter in rest/muxrest.
 
 Given a set of functions to handle REST methods ("GET", "POST", and the like),
 rest invokes these functions as properly addressed HTTP requests come in. It returns
@@ -10,5 +11,12 @@ specified.
 
 Most users will probably want to start with the associated package rest/jsonrest,
 which provides a fast and easy starting point for a REST/JSON system.
+rest/xmlrest does the same for XML, and rest/msgpackrest and rest/cborrest
+for the MessagePack and CBOR binary formats. rest/protorest serves Protocol
+Buffers, with the protobuf JSON mapping for clients that ask for JSON, and
+rest/csvrest exports collections as CSV or TSV tables. rest/formrest decodes
+HTML form posts and file uploads for endpoints of any format, and rest/htmlrest
+renders responses as browsable pages for people exploring an API. For clients
+that follow links, rest/halrest answers in HAL and rest/jsonapirest in JSON:API.
 */
 package rest
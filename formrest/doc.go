@@ -0,0 +1,22 @@
+/*
+Package formrest decodes HTML form submissions, both URL-encoded and
+multipart/form-data, into an Endpoint's Model, so that handlers need not
+parse the raw body themselves. Its codecs only decode, so they join the
+Alternates of an Endpoint answering in some other format:
+
+	type Upload struct {
+		Title  string          `form:"title"`
+		Public bool            `form:"public"`
+		Photo  *formrest.File  `form:"photo"`
+	}
+
+	e := jsonrest.NewEndpoint("photos")
+	e.Model = Upload{}
+	e.Alternates = append(e.Alternates, formrest.Codec, formrest.MultipartCodec)
+
+Requests are matched to a codec by their Content-Type. Multipart bodies are
+read as they arrive, with limits on the whole body and on each part (see
+NewMultipartCodec). Endpoints that would rather stream uploads than hold them
+in memory leave out the Model and read the parts with EachPart.
+*/
+package formrest
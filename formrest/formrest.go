@@ -0,0 +1,368 @@
+package formrest
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"rest"
+)
+
+const (
+	// MediaType is the content type of URL-encoded forms.
+	MediaType = "application/x-www-form-urlencoded"
+	// MultipartMediaType is the content type of forms with file uploads.
+	MultipartMediaType = "multipart/form-data"
+)
+
+var (
+	// Codec decodes URL-encoded form bodies into an Endpoint's Model. It
+	// only decodes, so it belongs in an Endpoint's Alternates. By default it
+	// only allows request bodies of up to a megabyte.
+	Codec rest.Codec = rest.Codec{
+		Accepts:   MediaType,
+		MaxSize:   1 << 20, // 1 megabyte
+		Unmarshal: Unmarshal,
+	}
+	// MultipartCodec decodes multipart form bodies, with the limits of
+	// NewMultipartCodec's defaults.
+	MultipartCodec rest.Codec = NewMultipartCodec(Options{})
+)
+
+func init() {
+	rest.RegisterCodec(Codec)
+	rest.RegisterCodec(MultipartCodec)
+}
+
+// Options set the limits on multipart bodies.
+type Options struct {
+	// MaxSize bounds the whole body, and becomes the codec's MaxSize. Zero
+	// means 32 megabytes.
+	MaxSize int64
+	// MaxPartSize bounds each field and file. Zero means MaxSize.
+	MaxPartSize int64
+}
+
+// NewMultipartCodec returns a codec decoding multipart form bodies into an
+// Endpoint's Model, reading them as they arrive. Uploaded files are bound to
+// fields of type *File or []*File. Endpoints with no Model leave the body to
+// their handlers, which can stream it with EachPart.
+func NewMultipartCodec(o Options) rest.Codec {
+	if o.MaxSize == 0 {
+		o.MaxSize = 32 << 20
+	}
+	if o.MaxPartSize == 0 {
+		o.MaxPartSize = o.MaxSize
+	}
+	return rest.Codec{
+		Accepts: MultipartMediaType,
+		MaxSize: o.MaxSize,
+		Decode:  o.decode,
+	}
+}
+
+// File is an uploaded file, held in memory.
+type File struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Content  []byte
+}
+
+// Part is one part of a multipart body, read as it arrives. Reading past
+// the size limit given to EachPart fails with rest.ErrRequestTooLarge.
+type Part struct {
+	*multipart.Part
+	r io.Reader
+}
+
+func (p *Part) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+/*
+EachPart calls f with each part of r's multipart body in turn, stopping at
+the first error f returns. Each part must be read, if at all, before f
+returns. maxPartSize bounds each part, or is zero for no bound beyond that
+on the whole body. For instance, a handler can copy uploads straight to
+storage:
+
+	err := formrest.EachPart(r, 0, func(p *formrest.Part) error {
+		if p.FileName() == "" {
+			return nil
+		}
+		_, err := store.Put(p.FileName(), p)
+		return err
+	})
+
+The Endpoint must decode the request with a MultipartCodec, and have no
+Model, so that the body is left for the handler.
+*/
+func EachPart(r *http.Request, maxPartSize int64, f func(p *Part) error) error {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var body io.Reader = part
+		if maxPartSize > 0 {
+			body = rest.LimitReader(part, maxPartSize)
+		}
+		err = f(&Part{part, body})
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (o Options) decode(r *http.Request, v interface{}) error {
+	values := url.Values{}
+	files := map[string][]*File{}
+	err := EachPart(r, o.MaxPartSize, func(p *Part) error {
+		name := p.FormName()
+		if name == "" {
+			return nil
+		}
+		data, err := ioutil.ReadAll(p)
+		if err != nil {
+			return err
+		}
+		if p.FileName() != "" {
+			files[name] = append(files[name], &File{p.FileName(), p.Header, data})
+		} else {
+			values.Add(name, string(data))
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, rest.ErrRequestTooLarge) {
+			return rest.ErrRequestTooLarge
+		}
+		return err
+	}
+	return Bind(values, files, v)
+}
+
+// Unmarshal decodes a URL-encoded form into the value v points to, as Bind
+// does.
+func Unmarshal(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return err
+	}
+	return Bind(values, nil, v)
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	fileType            = reflect.TypeOf(File{})
+)
+
+/*
+Bind stores form values and uploaded files in the struct v points to. Fields
+are named by their form tag, or else their json tag, or else their Go name,
+and a tag of "-" leaves a field out. The fields of nested structs are named
+with a dot, such as "address.city", and those of embedded structs are
+promoted. Fields may be strings, booleans ("on", as checkboxes send, counts
+as true), numbers, encoding.TextUnmarshalers such as time.Time, pointers to
+any of these, slices of them for repeated values, and *File or []*File for
+uploads. Values that cannot be converted are reported as rest.ValidationErrors.
+*/
+func Bind(values url.Values, files map[string][]*File, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("formrest: Bind needs a pointer to a struct")
+	}
+	var errs rest.ValidationErrors
+	bindStruct(rv.Elem(), "", values, files, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("form")
+	if !ok {
+		tag = f.Tag.Get("json")
+	}
+	if tag == "-" {
+		return "", true
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+	return name, false
+}
+
+// isLeaf reports whether values of type t are bound from a single form
+// field rather than as a nested struct.
+func isLeaf(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() != reflect.Struct || t == fileType || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func bindStruct(v reflect.Value, prefix string, values url.Values, files map[string][]*File, errs *rest.ValidationErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, skip := fieldName(f)
+		fv := v.Field(i)
+		if skip || !fv.CanSet() {
+			continue
+		}
+		if isLeaf(f.Type) {
+			bindField(fv, join(prefix, name), values, files, errs)
+			continue
+		}
+
+		// a nested struct, whose fields are promoted if it is embedded
+		nested := join(prefix, name)
+		if f.Anonymous && name == f.Name {
+			nested = prefix
+		}
+		if fv.Kind() == reflect.Ptr {
+			if !hasPrefix(values, files, nested) {
+				continue
+			}
+			if fv.IsNil() {
+				fv.Set(reflect.New(f.Type.Elem()))
+			}
+			fv = fv.Elem()
+		}
+		bindStruct(fv, nested, values, files, errs)
+	}
+}
+
+// hasPrefix reports whether the form has any field under name.
+func hasPrefix(values url.Values, files map[string][]*File, name string) bool {
+	for k := range values {
+		if name == "" || strings.HasPrefix(k, name+".") {
+			return true
+		}
+	}
+	for k := range files {
+		if name == "" || strings.HasPrefix(k, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func bindField(v reflect.Value, name string, values url.Values, files map[string][]*File, errs *rest.ValidationErrors) {
+	t := v.Type()
+	switch {
+	case t == reflect.PtrTo(fileType):
+		if fs := files[name]; len(fs) > 0 {
+			v.Set(reflect.ValueOf(fs[0]))
+		}
+		return
+	case t == reflect.TypeOf([]*File{}):
+		if fs := files[name]; len(fs) > 0 {
+			v.Set(reflect.ValueOf(fs))
+		}
+		return
+	}
+	vs, ok := values[name]
+	if !ok {
+		return
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 && !reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		s := reflect.MakeSlice(t, len(vs), len(vs))
+		for i, item := range vs {
+			if err := setValue(s.Index(i), item); err != nil {
+				*errs = append(*errs, rest.FieldError{Field: name, Message: err.Error()})
+				return
+			}
+		}
+		v.Set(s)
+		return
+	}
+	if err := setValue(v, vs[0]); err != nil {
+		*errs = append(*errs, rest.FieldError{Field: name, Message: err.Error()})
+	}
+}
+
+// setValue converts a single form value into v.
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return errors.New("is not valid")
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return errors.New("cannot be set from a form")
+		}
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		if s == "on" {
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive whole number")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(f)
+	default:
+		return errors.New("cannot be set from a form")
+	}
+	return nil
+}
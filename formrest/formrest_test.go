@@ -0,0 +1,232 @@
+package formrest
+
+import (
+	"testing"
+
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"rest"
+)
+
+type Meta struct {
+	Source string `form:"source"`
+}
+
+type address struct {
+	City string `json:"city"`
+}
+
+type upload struct {
+	Title   string    `form:"title"`
+	Public  bool      `form:"public"`
+	Count   int       `json:"count"`
+	Weight  *float64  `form:"weight"`
+	Tags    []string  `form:"tag"`
+	When    time.Time `form:"when"`
+	Ship    address   `form:"ship"`
+	Bill    *address  `form:"bill"`
+	Skipped string    `form:"-"`
+	Photo   *File     `form:"photo"`
+	Extras  []*File   `form:"extra"`
+	Meta
+}
+
+func TestUnmarshal(t *testing.T) {
+	var u upload
+	data := "title=Yams&public=on&count=3&weight=1.5&tag=a&tag=b&when=2016-03-01T00:00:00Z" +
+		"&ship.city=Lagos&source=web&Skipped=no&unknown=1"
+	if err := Unmarshal([]byte(data), &u); err != nil {
+		t.Fatalf("Error unmarshaling: %s", err)
+	}
+	if u.Title != "Yams" || !u.Public || u.Count != 3 || u.Weight == nil || *u.Weight != 1.5 {
+		t.Errorf("Expected scalar fields, got %+v", u)
+	}
+	if len(u.Tags) != 2 || u.Tags[1] != "b" {
+		t.Errorf("Expected repeated tags, got %v", u.Tags)
+	}
+	if !u.When.Equal(time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected a time, got %v", u.When)
+	}
+	if u.Ship.City != "Lagos" || u.Bill != nil || u.Source != "web" || u.Skipped != "" {
+		t.Errorf("Expected nested and promoted fields, got %+v", u)
+	}
+
+	err := Unmarshal([]byte("count=many&public=maybe&title=ok"), &u)
+	errs, ok := err.(rest.ValidationErrors)
+	if !ok || len(errs) != 2 || errs[0].Field != "public" || errs[1].Field != "count" {
+		t.Errorf("Expected errors for public and count, got %v", err)
+	}
+	if err := Unmarshal([]byte("a=b"), &[]string{}); err == nil {
+		t.Errorf("Expected error binding to a slice")
+	}
+}
+
+func newFormEndpoint() *rest.Endpoint {
+	e := rest.NewEndpoint("uploads")
+	e.Model = upload{}
+	e.Alternates = []rest.Codec{Codec, NewMultipartCodec(Options{MaxSize: 1 << 12, MaxPartSize: 1 << 8})}
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		u := rest.Decoded(r).(*upload)
+		s := u.Title
+		if u.Photo != nil {
+			s += " " + u.Photo.Filename + ":" + string(u.Photo.Content)
+		}
+		return s + " " + strings.Join(u.Tags, ","), nil
+	}
+	return e
+}
+
+func multipartBody(fields map[string]string, files map[string]string) (string, *bytes.Buffer) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for name, content := range files {
+		fw, _ := mw.CreateFormFile(name, name+".txt")
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+	return mw.FormDataContentType(), &buf
+}
+
+func post(e *rest.Endpoint, contentType string, body *bytes.Buffer) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", "http://example.com/uploads", body)
+	r.Header.Set("Accept", "text/plain")
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestEndpoint(t *testing.T) {
+	e := newFormEndpoint()
+
+	form := url.Values{"title": {"Yams"}, "tag": {"a", "b"}}
+	w := post(e, MediaType, bytes.NewBufferString(form.Encode()))
+	if w.Code != http.StatusOK || w.Body.String() != "Yams a,b" {
+		t.Errorf("URL-encoded: expected Yams a,b, got %d %q", w.Code, w.Body.String())
+	}
+
+	ct, body := multipartBody(map[string]string{"title": "Yams", "tag": "c"}, map[string]string{"photo": "JPEG"})
+	w = post(e, ct, body)
+	if w.Code != http.StatusOK || w.Body.String() != "Yams photo.txt:JPEG c" {
+		t.Errorf("Multipart: expected Yams photo.txt:JPEG c, got %d %q", w.Code, w.Body.String())
+	}
+
+	ct, body = multipartBody(nil, map[string]string{"photo": strings.Repeat("x", 1<<9)})
+	if w = post(e, ct, body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("With a large part: expected http return code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	files := map[string]string{}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprint("file", i)] = strings.Repeat("x", 1<<8)
+	}
+	ct, body = multipartBody(nil, files)
+	// a chunked body, whose length is not known up front
+	r, _ := http.NewRequest("POST", "http://example.com/uploads", struct{ *bytes.Buffer }{body})
+	r.Header.Set("Accept", "text/plain")
+	r.Header.Set("Content-Type", ct)
+	w = httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("With a large body: expected http return code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	if w = post(e, MediaType, bytes.NewBufferString("count=many")); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("With a bad number: expected http return code %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	// decode-only codecs are never chosen for responses
+	r, _ = http.NewRequest("GET", "http://example.com/uploads", nil)
+	r.Header.Set("Accept", MediaType)
+	w = httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("Accepting a form: expected http return code %d, got %d", http.StatusNotAcceptable, w.Code)
+	}
+}
+
+func TestSignedEndpoint(t *testing.T) {
+	e := newFormEndpoint()
+	key := []byte("sekrit")
+	e.Authenticator = rest.HMACAuth{Key: func(keyID string) ([]byte, error) {
+		return key, nil
+	}}
+	sign := func(ct string, signed, sent []byte) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "http://example.com/uploads", bytes.NewReader(sent))
+		r.Header.Set("Accept", "text/plain")
+		r.Header.Set("Content-Type", ct)
+		rest.SignRequest(r, "jo", key, signed)
+		w := httptest.NewRecorder()
+		e.Handler().ServeHTTP(w, r)
+		return w
+	}
+
+	ct, body := multipartBody(map[string]string{"title": "Yams"}, nil)
+	if w := sign(ct, body.Bytes(), body.Bytes()); w.Code != http.StatusOK || w.Body.String() != "Yams " {
+		t.Errorf("Signed: expected Yams, got %d %q", w.Code, w.Body.String())
+	}
+	tampered := bytes.Replace(body.Bytes(), []byte("Yams"), []byte("Beet"), 1)
+	if w := sign(ct, body.Bytes(), tampered); w.Code != http.StatusUnauthorized {
+		t.Errorf("Tampered: expected http return code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := sign(ct, nil, tampered); w.Code != http.StatusUnauthorized {
+		t.Errorf("Signed without a body: expected http return code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestIdempotentEndpoint(t *testing.T) {
+	e := newFormEndpoint()
+	e.Idempotency = &rest.Idempotency{Store: rest.NewMemoryIdempotencyStore(time.Hour)}
+	send := func(title string) *httptest.ResponseRecorder {
+		ct, body := multipartBody(map[string]string{"title": title}, nil)
+		r, _ := http.NewRequest("POST", "http://example.com/uploads", body)
+		r.Header.Set("Accept", "text/plain")
+		r.Header.Set("Content-Type", ct)
+		r.Header.Set("Idempotency-Key", "k1")
+		w := httptest.NewRecorder()
+		e.Handler().ServeHTTP(w, r)
+		return w
+	}
+	if w := send("Yams"); w.Code != http.StatusOK {
+		t.Errorf("First: expected http return code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := send("Beets"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Different body: expected http return code %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+}
+
+func TestEachPart(t *testing.T) {
+	e := newFormEndpoint()
+	e.Model = nil
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		var names []string
+		err := EachPart(r, 4, func(p *Part) error {
+			var buf bytes.Buffer
+			if _, err := buf.ReadFrom(p); err != nil {
+				return err
+			}
+			names = append(names, p.FormName()+"="+buf.String())
+			return nil
+		})
+		return strings.Join(names, " "), err
+	}
+
+	ct, body := multipartBody(map[string]string{"title": "Yams"}, nil)
+	w := post(e, ct, body)
+	if w.Code != http.StatusOK || w.Body.String() != "title=Yams" {
+		t.Errorf("Expected title=Yams, got %d %q", w.Code, w.Body.String())
+	}
+	ct, body = multipartBody(map[string]string{"title": "Sweet yams"}, nil)
+	if w = post(e, ct, body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("With a large part: expected http return code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
@@ -0,0 +1,8 @@
+module rest
+
+go 1.23
+
+require (
+	github.com/gorilla/mux v1.8.1
+	google.golang.org/protobuf v1.36.9
+)
@@ -0,0 +1,25 @@
+/*
+Package halrest provides a bootstrapped REST service answering in HAL
+(application/hal+json), so that clients can follow links instead of building
+URLs themselves.
+
+	e := halrest.NewEndpoint("yams")
+	http.Handle("/", e.Handler())
+
+Objects are encoded as JSON with a _links member. An object with an "id"
+field gets a self link to its place in the endpoint's collection, and every
+object a link back to the collection itself. Collections are wrapped in a
+document whose _embedded member holds the items under the endpoint's Name:
+
+	{
+	  "_embedded": {"yams": [{"id": "1", "_links": {...}}]},
+	  "_links": {"self": {"href": "/yams"}},
+	  "count": 1
+	}
+
+Objects implementing rest.Relater get a link for each relationship, to the
+related objects of the endpoint it names; to-many relationships are arrays
+of links. Links are paths from the root of the server, worked out from the
+path of the request.
+*/
+package halrest
@@ -0,0 +1,110 @@
+package halrest
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+
+	"rest"
+	"rest/internal/hypermedia"
+)
+
+// MediaType is the media type of HAL documents.
+const MediaType = "application/hal+json"
+
+// Codec is a REST codec answering in HAL, the Hypertext Application
+// Language, and taking plain JSON request bodies, in which any _links and
+// _embedded members are ignored. By default it only allows request bodies of
+// up to a megabyte.
+var Codec rest.Codec = rest.Codec{
+	Accepts:   MediaType,
+	MaxSize:   1 << 20, // 1 megabyte
+	Render:    render,
+	Unmarshal: json.Unmarshal,
+}
+
+func init() {
+	rest.RegisterCodec(Codec)
+}
+
+// Link is a HAL link object.
+type Link struct {
+	Href string `json:"href"`
+}
+
+func render(r *http.Request, v interface{}) ([]byte, error) {
+	if failure, ok := v.(rest.ValidationFailure); ok {
+		return json.Marshal(failure)
+	}
+	resources, many, err := hypermedia.Resources(v)
+	if err != nil {
+		return nil, err
+	}
+	collection, item := hypermedia.Collection(r)
+	if !many {
+		self := ""
+		if item {
+			self = r.URL.Path
+		}
+		return json.Marshal(document(collection, resources[0], self))
+	}
+
+	embedded := make([]interface{}, len(resources))
+	for i, res := range resources {
+		embedded[i] = document(collection, res, "")
+	}
+	return json.Marshal(map[string]interface{}{
+		"_links":    map[string]interface{}{"self": Link{r.URL.Path}},
+		"_embedded": map[string]interface{}{path.Base(collection): embedded},
+		"count":     len(resources),
+	})
+}
+
+// document adds the links of res to its fields. Values other than objects
+// cannot carry links, and are returned as they are.
+func document(collection string, res hypermedia.Resource, self string) interface{} {
+	if res.Fields == nil {
+		return res.Value
+	}
+	if res.HasID {
+		self = hypermedia.Item(collection, res.ID)
+	}
+	links := map[string]interface{}{"collection": Link{collection}}
+	if self != "" {
+		links["self"] = Link{self}
+	}
+	for _, rel := range res.Relationships {
+		related := make([]Link, len(rel.IDs))
+		for i, id := range rel.IDs {
+			related[i] = Link{hypermedia.Related(collection, rel.Endpoint, id)}
+		}
+		switch {
+		case rel.ToMany:
+			links[rel.Name] = related
+		case len(related) > 0:
+			links[rel.Name] = related[0]
+		}
+	}
+	res.Fields["_links"] = links
+	return res.Fields
+}
+
+// NewEndpoint returns a *rest.Endpoint configured to answer in HAL.
+func NewEndpoint(name string) *rest.Endpoint {
+	return &rest.Endpoint{
+		GetCollection:  rest.UnimplementedCollectionHandler,
+		PostCollection: rest.UnimplementedCollectionHandler,
+
+		Get:    rest.UnimplementedHandler,
+		Head:   rest.UnimplementedHandler,
+		Put:    rest.UnimplementedHandler,
+		Post:   rest.UnimplementedHandler,
+		Delete: rest.UnimplementedHandler,
+
+		Codec:            Codec,
+		Name:             name,
+		StatusCodeLookup: map[error]int{},
+		Logger:           rest.IOLogger{Writer: os.Stdout},
+	}
+}
@@ -0,0 +1,112 @@
+package halrest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+
+	"rest"
+)
+
+type yam struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Farmer   string   `json:"farmer,omitempty"`
+	Recipes  []string `json:"-"`
+	Unlisted bool     `json:"-"`
+}
+
+func (y yam) Relationships() []rest.Relationship {
+	if y.Unlisted {
+		return nil
+	}
+	return []rest.Relationship{
+		{Name: "farmer", Endpoint: "farmers", IDs: []string{y.Farmer}},
+		{Name: "recipes", Endpoint: "recipes", IDs: y.Recipes, ToMany: true},
+	}
+}
+
+func serve(e *rest.Endpoint, method, url, body string) (int, interface{}) {
+	r, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	r.Header.Set("Accept", MediaType)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	var doc interface{}
+	json.Unmarshal(w.Body.Bytes(), &doc)
+	return w.Code, doc
+}
+
+func decode(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestEndpoint(t *testing.T) {
+	e := NewEndpoint("yams")
+	e.Model = yam{}
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return []yam{
+			{ID: "1", Name: "Garnet", Farmer: "jo", Recipes: []string{"pie"}},
+			{ID: "2", Name: "Jewel", Unlisted: true},
+		}, nil
+	}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return "just a yam", nil
+	}
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		y := rest.Decoded(r).(*yam)
+		y.Unlisted = true
+		return y, nil
+	}
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return map[string]string{"status": "queued"}, nil
+	}
+
+	code, doc := serve(e, "GET", "http://example.com/yams", "")
+	expected := decode(`{
+	  "_links": {"self": {"href": "/yams"}},
+	  "_embedded": {"yams": [
+	    {"id": "1", "name": "Garnet", "farmer": "jo", "_links": {
+	      "self": {"href": "/yams/1"},
+	      "collection": {"href": "/yams"},
+	      "farmer": {"href": "/farmers/jo"},
+	      "recipes": [{"href": "/recipes/pie"}]
+	    }},
+	    {"id": "2", "name": "Jewel", "_links": {
+	      "self": {"href": "/yams/2"},
+	      "collection": {"href": "/yams"}
+	    }}
+	  ]},
+	  "count": 2
+	}`)
+	if code != http.StatusOK || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Collection: expected %v, got %d %v", expected, code, doc)
+	}
+
+	code, doc = serve(e, "PUT", "http://example.com/yams/3", `{"name": "Beauregard", "_links": {}}`)
+	expected = decode(`{"id": "", "name": "Beauregard", "_links": {
+	  "self": {"href": "/yams/3"},
+	  "collection": {"href": "/yams"}
+	}}`)
+	if code != http.StatusOK || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Object: expected %v, got %d %v", expected, code, doc)
+	}
+
+	code, doc = serve(e, "POST", "http://example.com/yams", `{}`)
+	expected = decode(`{"status": "queued", "_links": {"collection": {"href": "/yams"}}}`)
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Created: expected %v, got %d %v", expected, code, doc)
+	}
+
+	if _, doc = serve(e, "GET", "http://example.com/yams/3", ""); doc != "just a yam" {
+		t.Errorf("Plain value: expected it as it is, got %v", doc)
+	}
+}
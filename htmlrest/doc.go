@@ -0,0 +1,19 @@
+/*
+Package htmlrest lets people explore an API with a web browser. Its codec
+answers requests for text/html, as browsers make, with a page showing the
+JSON form of the response, syntax highlighted, where the items of a
+collection link to their own pages. Collection pages have a form to POST a
+new object, and object pages forms to PUT and DELETE it.
+
+The page is self-contained, with no external scripts or stylesheets, so it
+works offline and under strict content security policies that allow inline
+code. Add the codec to an Endpoint that already takes JSON bodies, since
+that is what the forms send:
+
+	e := jsonrest.NewEndpoint("yams")
+	e.Alternates = append(e.Alternates, htmlrest.Codec)
+
+Clients asking for JSON still get JSON; only those preferring HTML get the
+page. Use NewCodec to have the forms send some other media type.
+*/
+package htmlrest
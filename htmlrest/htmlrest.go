@@ -0,0 +1,254 @@
+package htmlrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"rest"
+)
+
+// MediaType is the media type browsers ask for, and that Codec answers in.
+const MediaType = "text/html"
+
+// Codec renders responses as browsable HTML pages, with forms that send
+// JSON bodies.
+var Codec rest.Codec = NewCodec(Options{})
+
+func init() {
+	rest.RegisterCodec(Codec)
+}
+
+// Options configures a codec made by NewCodec.
+type Options struct {
+	// Submit is the media type of the bodies the page's forms send, which
+	// the endpoint must be able to decode. If empty, it is
+	// "application/json".
+	Submit string
+}
+
+// Error is the response body of a failed request, before it is rendered.
+type Error struct {
+	Status  int    `json:"status"`
+	Message string `json:"error"`
+}
+
+// NewCodec returns a codec rendering each response as an HTML page showing
+// its JSON form, for people exploring an API with a browser. Items of a
+// collection are linked by their "id" fields, and the page has forms for
+// creating, replacing and deleting objects. The codec only encodes, so it
+// is meant to be one of an Endpoint's Alternates.
+func NewCodec(o Options) rest.Codec {
+	if o.Submit == "" {
+		o.Submit = "application/json"
+	}
+	return rest.Codec{
+		Accepts: MediaType,
+		Render: func(r *http.Request, v interface{}) ([]byte, error) {
+			return o.render(r, v)
+		},
+		ErrorBody: errorBody,
+	}
+}
+
+func errorBody(statusCode int, err error) interface{} {
+	message := err.Error()
+	if statusCode >= 500 {
+		message = http.StatusText(statusCode)
+	}
+	return Error{Status: statusCode, Message: message}
+}
+
+type page struct {
+	Name, Method, Path, Collection string
+	Submit, Current                string
+	Item                           bool
+	Body                           template.HTML
+}
+
+func (o Options) render(r *http.Request, v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	p := page{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Collection: r.URL.Path,
+		Submit:     o.Submit,
+		Item:       r.PathValue("id") != "",
+	}
+	if p.Item {
+		p.Collection = path.Dir(r.URL.Path)
+		if r.Method == "GET" {
+			p.Current = string(data)
+		}
+	}
+	p.Name = path.Base(p.Collection)
+	linkTo := ""
+	if !p.Item {
+		linkTo = p.Collection
+	}
+	p.Body = highlight(data, linkTo)
+
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+highlight marks up indented JSON for the page's stylesheet. If collection is
+not empty and data is an array, the "id" of each object in it becomes a link
+to the item under collection.
+*/
+func highlight(data []byte, collection string) template.HTML {
+	var (
+		b     strings.Builder
+		stack []byte
+		key   string
+	)
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for j < len(data) && data[j] != '"' {
+				if data[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j++
+			token := string(data[i:j])
+			after := bytes.TrimLeft(data[j:], " \n")
+			if len(after) > 0 && after[0] == ':' {
+				key = token
+				span(&b, "key", token)
+			} else {
+				value(&b, "string", token, stack, key, collection)
+			}
+			i = j
+		case c == '{' || c == '[':
+			stack = append(stack, c)
+			b.WriteByte(c)
+			i++
+		case c == '}' || c == ']':
+			stack = stack[:len(stack)-1]
+			b.WriteByte(c)
+			i++
+		case c == ',' || c == ':' || c == ' ' || c == '\n':
+			b.WriteByte(c)
+			i++
+		default:
+			j := i
+			for j < len(data) && !strings.ContainsRune(",]}\n ", rune(data[j])) {
+				j++
+			}
+			token := string(data[i:j])
+			class := "number"
+			switch token {
+			case "true", "false":
+				class = "bool"
+			case "null":
+				class = "null"
+			}
+			value(&b, class, token, stack, key, collection)
+			i = j
+		}
+	}
+	return template.HTML(b.String())
+}
+
+func span(b *strings.Builder, class, token string) {
+	b.WriteString(`<span class="` + class + `">` + html.EscapeString(token) + `</span>`)
+}
+
+// value writes a scalar, linking it if it is the id of a collection item.
+func value(b *strings.Builder, class, token string, stack []byte, key, collection string) {
+	if collection == "" || key != `"id"` || string(stack) != "[{" || (class != "string" && class != "number") {
+		span(b, class, token)
+		return
+	}
+	id := token
+	if class == "string" {
+		if err := json.Unmarshal([]byte(token), &id); err != nil {
+			span(b, class, token)
+			return
+		}
+	}
+	href := collection + "/" + url.PathEscape(id)
+	b.WriteString(`<a href="` + html.EscapeString(href) + `">`)
+	span(b, class, token)
+	b.WriteString(`</a>`)
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+h1 { font-size: 1.4em; }
+h1 .method { color: #888; }
+pre, textarea { font-family: monospace; font-size: 0.9em; }
+pre { background: #f6f8fa; border: 1px solid #ddd; padding: 1em; overflow: auto; }
+textarea { width: 100%; box-sizing: border-box; }
+form { margin: 1em 0; }
+.key { color: #0451a5; }
+.string { color: #a31515; }
+.number { color: #098658; }
+.bool, .null { color: #0000ff; }
+a .string, a .number { text-decoration: underline; }
+</style>
+</head>
+<body>
+<nav><a href="{{.Collection}}">{{.Name}}</a></nav>
+<h1><span class="method">{{.Method}}</span> {{.Path}}</h1>
+<pre>{{.Body}}</pre>
+{{if .Item}}
+<form data-method="PUT">
+<h2>PUT</h2>
+<textarea name="body" rows="10">{{.Current}}</textarea>
+<button type="submit">Replace</button>
+</form>
+<form data-method="DELETE">
+<button type="submit">Delete</button>
+</form>
+{{else}}
+<form data-method="POST">
+<h2>POST</h2>
+<textarea name="body" rows="10">{}</textarea>
+<button type="submit">Create</button>
+</form>
+{{end}}
+<script>
+document.querySelectorAll("form[data-method]").forEach(function (form) {
+  form.addEventListener("submit", function (event) {
+    event.preventDefault();
+    var method = form.getAttribute("data-method");
+    var init = {method: method, headers: {"Accept": "text/html"}};
+    if (form.body) {
+      init.headers["Content-Type"] = {{.Submit}};
+      init.body = form.body.value;
+    }
+    fetch(location.pathname, init).then(function (response) {
+      return response.text();
+    }).then(function (text) {
+      document.open();
+      document.write(text);
+      document.close();
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
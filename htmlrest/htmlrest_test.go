@@ -0,0 +1,122 @@
+package htmlrest
+
+import (
+	"testing"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"rest"
+	"rest/jsonrest"
+)
+
+type yam struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Sweet bool     `json:"sweet"`
+	Tags  []string `json:"tags"`
+}
+
+func TestHighlight(t *testing.T) {
+	data := []byte(`[
+  {
+    "id": "1",
+    "name": "<Garnet>",
+    "weight": 1.5,
+    "sweet": true,
+    "eaten": null,
+    "parts": [{"id": "2"}]
+  },
+  {
+    "id": 3
+  }
+]`)
+	got := string(highlight(data, "/api/yams"))
+	for _, expected := range []string{
+		`<a href="/api/yams/1"><span class="string">&#34;1&#34;</span></a>`,
+		`<a href="/api/yams/3"><span class="number">3</span></a>`,
+		`<span class="key">&#34;name&#34;</span>: <span class="string">&#34;&lt;Garnet&gt;&#34;</span>`,
+		`<span class="number">1.5</span>`,
+		`<span class="bool">true</span>`,
+		`<span class="null">null</span>`,
+		`[{<span class="key">&#34;id&#34;</span>: <span class="string">&#34;2&#34;</span>}]`,
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Expected %s in:\n%s", expected, got)
+		}
+	}
+	if got := string(highlight(data, "")); strings.Contains(got, "<a ") {
+		t.Errorf("Expected no links outside collections, got:\n%s", got)
+	}
+}
+
+func get(e *rest.Endpoint, method, url, accept string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, url, nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestEndpoint(t *testing.T) {
+	e := jsonrest.NewEndpoint("yams")
+	e.Alternates = append(e.Alternates, Codec)
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return []yam{{ID: "1", Name: "Garnet"}, {ID: "2", Name: "</pre><script>"}}, nil
+	}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if id != "1" {
+			return nil, errors.New("secret database failure")
+		}
+		return yam{ID: "1", Name: "Garnet", Sweet: true}, nil
+	}
+
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	w := get(e, "GET", "http://example.com/yams", browser)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != MediaType {
+		t.Fatalf("Expected an HTML page, got %d as %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, expected := range []string{
+		`<title>yams</title>`,
+		`<a href="/yams/2">`,
+		`data-method="POST"`,
+		`"Content-Type"] = "application/json"`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Collection: expected %s in:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, "<script>\"") || strings.Contains(body, "</pre><script>") {
+		t.Errorf("Collection: expected values to be escaped, got:\n%s", body)
+	}
+	if strings.Contains(body, "http://") || strings.Contains(body, "https://") {
+		t.Errorf("Collection: expected no external assets, got:\n%s", body)
+	}
+
+	w = get(e, "GET", "http://example.com/yams/1", browser)
+	body = w.Body.String()
+	for _, expected := range []string{
+		`<nav><a href="/yams">yams</a></nav>`,
+		`data-method="PUT"`,
+		`data-method="DELETE"`,
+		`&#34;sweet&#34;: true`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Object: expected %s in:\n%s", expected, body)
+		}
+	}
+
+	w = get(e, "GET", "http://example.com/yams/2", browser)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "secret") ||
+		!strings.Contains(w.Body.String(), "Internal Server Error") {
+		t.Errorf("Failure: expected a generic 500 page, got %d:\n%s", w.Code, w.Body.String())
+	}
+
+	w = get(e, "GET", "http://example.com/yams", "application/json")
+	if w.Header().Get("Content-Type") != "application/json" || !strings.HasPrefix(w.Body.String(), `[{"id":"1"`) {
+		t.Errorf("Expected JSON clients to get JSON, got %s: %s", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
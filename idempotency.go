@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrIdempotencyKeyReused is sent when a request repeats an
+	// Idempotency-Key with a different payload. It corresponds to
+	// http.StatusUnprocessableEntity.
+	ErrIdempotencyKeyReused error = errors.New("Idempotency key reused with a different request")
+	// ErrIdempotencyKeyInFlight is sent when a request repeats an
+	// Idempotency-Key while the first request is still being handled. It
+	// corresponds to http.StatusConflict.
+	ErrIdempotencyKeyInFlight error = errors.New("Request with this idempotency key in progress")
+)
+
+// IdempotencyRecord is what an IdempotencyStore keeps for one key: a
+// fingerprint of the request and, once it has been handled, its response.
+type IdempotencyRecord struct {
+	Fingerprint string
+	// Done is false while the first request with the key is in flight.
+	Done       bool
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IdempotencyStore keeps the first response to each Idempotency-Key.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Reserve stores rec under key if the key is free. Otherwise it stores
+	// nothing and returns a copy of the record already there.
+	Reserve(key string, rec *IdempotencyRecord) (*IdempotencyRecord, error)
+	// Complete replaces the record under key with the finished one.
+	Complete(key string, rec *IdempotencyRecord) error
+	// Release frees key, so that the request may be retried.
+	Release(key string) error
+}
+
+// Idempotency makes POST requests to an Endpoint safe to retry. A request
+// carrying an Idempotency-Key header is handled once; retries with the same
+// key get the first response replayed, marked with an
+// "Idempotent-Replayed: true" header. Keys are scoped to the Endpoint and
+// the authenticated caller. Responses with a 5xx status are not kept, so
+// those requests can be retried for real.
+type Idempotency struct {
+	// Store keeps responses. If nil, a process-wide MemoryIdempotencyStore
+	// is used.
+	Store IdempotencyStore
+	// Required rejects POST requests without an Idempotency-Key with 400
+	// (Bad Request).
+	Required bool
+}
+
+var defaultIdempotencyStore = NewMemoryIdempotencyStore(24 * time.Hour)
+
+// idempotentRequest is a reservation held while a request is handled.
+type idempotentRequest struct {
+	store IdempotencyStore
+	key   string
+	rec   *IdempotencyRecord
+}
+
+// reserveIdempotent claims r's Idempotency-Key. If the key has already been
+// used for the same request, the stored response is returned for replay.
+func (e *Endpoint) reserveIdempotent(w http.ResponseWriter, r *http.Request, action Action, body []byte) (*cachedResponse, *idempotentRequest, error) {
+	if e.Idempotency == nil || (action != ActionPost && action != ActionPostCollection) {
+		return nil, nil, nil
+	}
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		if e.Idempotency.Required {
+			return nil, nil, ErrBadRequest
+		}
+		return nil, nil, nil
+	}
+	store := e.Idempotency.Store
+	if store == nil {
+		store = defaultIdempotencyStore
+	}
+	scope := e.Name
+	if p := PrincipalFrom(r); p != nil {
+		scope += "|" + p.Name
+	}
+	key = scope + "|" + key
+
+	sum := sha256.Sum256([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + string(body)))
+	rec := &IdempotencyRecord{Fingerprint: hex.EncodeToString(sum[:])}
+	existing, err := store.Reserve(key, rec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing == nil {
+		return nil, &idempotentRequest{store, key, rec}, nil
+	}
+	if existing.Fingerprint != rec.Fingerprint {
+		return nil, nil, ErrIdempotencyKeyReused
+	}
+	if !existing.Done {
+		return nil, nil, ErrIdempotencyKeyInFlight
+	}
+
+	h := w.Header()
+	for k, v := range existing.Header {
+		if _, ok := h[k]; !ok {
+			h[k] = v
+		}
+	}
+	h.Set("Idempotent-Replayed", "true")
+	return &cachedResponse{status: existing.StatusCode, body: existing.Body}, nil, nil
+}
+
+// complete stores the response to a reserved request, or frees the key if
+// the request failed on our side.
+func (req *idempotentRequest) complete(w http.ResponseWriter, statusCode int, body []byte) error {
+	if statusCode >= 500 {
+		return req.store.Release(req.key)
+	}
+	// the reserved record may be in a concurrent retry's hands, so the
+	// finished one is new
+	return req.store.Complete(req.key, &IdempotencyRecord{
+		Fingerprint: req.rec.Fingerprint,
+		Done:        true,
+		StatusCode:  statusCode,
+		Header:      w.Header().Clone(),
+		Body:        body,
+	})
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore that forgets keys
+// after a time to live.
+type MemoryIdempotencyStore struct {
+	TTL time.Duration
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	records map[string]*memoryIdempotencyRecord
+	calls   int
+}
+
+type memoryIdempotencyRecord struct {
+	rec     *IdempotencyRecord
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore keeping
+// keys for ttl.
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{TTL: ttl, records: map[string]*memoryIdempotencyRecord{}}
+}
+
+func (s *MemoryIdempotencyStore) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Reserve implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Reserve(key string, rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records == nil {
+		s.records = map[string]*memoryIdempotencyRecord{}
+	}
+	if s.calls++; s.calls%sweepEvery == 0 {
+		for k, r := range s.records {
+			if !now.Before(r.expires) {
+				delete(s.records, k)
+			}
+		}
+	}
+	if r, ok := s.records[key]; ok && now.Before(r.expires) {
+		existing := *r.rec
+		return &existing, nil
+	}
+	s.records[key] = &memoryIdempotencyRecord{rec, now.Add(s.TTL)}
+	return nil, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(key string, rec *IdempotencyRecord) error {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = &memoryIdempotencyRecord{rec, now.Add(s.TTL)}
+	return nil
+}
+
+// Release implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
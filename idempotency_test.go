@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"testing"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+func postIdempotent(e *Endpoint, key, body string) *http.Response {
+	r, _ := http.NewRequest("POST", "http://example.com/yams", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	return serveAuth(e, r).Result()
+}
+
+func TestIdempotency(t *testing.T) {
+	created := 0
+	e := newFalseEndpoint("yams")
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		created++
+		return nil, nil
+	}
+	e.Idempotency = &Idempotency{Store: NewMemoryIdempotencyStore(time.Hour)}
+
+	first := postIdempotent(e, "abc", "garnet")
+	if first.StatusCode != http.StatusOK || created != 1 {
+		t.Fatalf("Expected first request to be handled, got %d with %d created", first.StatusCode, created)
+	}
+	retry := postIdempotent(e, "abc", "garnet")
+	if retry.StatusCode != http.StatusOK || created != 1 {
+		t.Errorf("Expected retry to be replayed, got %d with %d created", retry.StatusCode, created)
+	}
+	if retry.Header.Get("Idempotent-Replayed") != "true" || retry.Header.Get("Content-Type") != "application/yams" {
+		t.Errorf("Expected replayed headers, got %v", retry.Header)
+	}
+	if first.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected first response not to be marked replayed")
+	}
+
+	if resp := postIdempotent(e, "abc", "jewel"); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Different payload: expected http return code %d, got %d", http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+	if resp := postIdempotent(e, "def", "garnet"); resp.StatusCode != http.StatusOK || created != 2 {
+		t.Errorf("New key: expected request to be handled, got %d with %d created", resp.StatusCode, created)
+	}
+	postIdempotent(e, "", "garnet")
+	postIdempotent(e, "", "garnet")
+	if created != 4 {
+		t.Errorf("Without a key: expected every request handled, got %d created", created)
+	}
+
+	// failures on our side free the key for a real retry
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		created++
+		return nil, errors.New("database on fire")
+	}
+	postIdempotent(e, "ghi", "garnet")
+	postIdempotent(e, "ghi", "garnet")
+	if created != 6 {
+		t.Errorf("After a 500: expected the retry handled, got %d created", created)
+	}
+
+	e.Idempotency.Required = true
+	if resp := postIdempotent(e, "", "garnet"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Required key: expected http return code %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	e := newFalseEndpoint("yams")
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}
+	e.Idempotency = &Idempotency{Store: NewMemoryIdempotencyStore(time.Hour)}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		postIdempotent(e, "abc", "garnet")
+	}()
+	<-started
+	if resp := postIdempotent(e, "abc", "garnet"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected http return code %d, got %d", http.StatusConflict, resp.StatusCode)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestIdempotencyConcurrentRetries(t *testing.T) {
+	var mu sync.Mutex
+	created := 0
+	e := newFalseEndpoint("yams")
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		mu.Lock()
+		created++
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	}
+	e.Idempotency = &Idempotency{Store: NewMemoryIdempotencyStore(time.Hour)}
+	handler := e.Handler()
+
+	// retries keep coming until one is replayed, so some arrive while the
+	// first response is being stored
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				r, _ := http.NewRequest("POST", "http://example.com/yams", strings.NewReader("garnet"))
+				r.Header.Set("Idempotency-Key", "abc")
+				r.Header.Set("Accept", "application/yams")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				switch w.Code {
+				case http.StatusConflict:
+					continue
+				case http.StatusOK:
+				default:
+					t.Errorf("Expected http return code %d or %d, got %d", http.StatusOK, http.StatusConflict, w.Code)
+				}
+				return
+			}
+		}()
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("Expected one request handled, got %d", created)
+	}
+}
+
+func TestMemoryIdempotencyStoreTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryIdempotencyStore(time.Minute)
+	s.Now = func() time.Time { return now }
+
+	if existing, _ := s.Reserve("abc", &IdempotencyRecord{Fingerprint: "1"}); existing != nil {
+		t.Fatalf("Expected free key, got %+v", existing)
+	}
+	if existing, _ := s.Reserve("abc", &IdempotencyRecord{Fingerprint: "2"}); existing == nil || existing.Fingerprint != "1" {
+		t.Errorf("Expected the first record, got %+v", existing)
+	}
+	now = now.Add(2 * time.Minute)
+	if existing, _ := s.Reserve("abc", &IdempotencyRecord{Fingerprint: "2"}); existing != nil {
+		t.Errorf("Expected key to expire, got %+v", existing)
+	}
+}
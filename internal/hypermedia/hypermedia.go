@@ -0,0 +1,110 @@
+/*
+Package hypermedia holds what the hypermedia codecs (rest/halrest and
+rest/jsonapirest) share: working out where the answered resources live from
+the request, and taking objects apart into their JSON fields, id and
+relationships.
+*/
+package hypermedia
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+
+	"rest"
+)
+
+// Collection returns the path of the collection r addresses, and whether r
+// addresses one of its items rather than the collection itself.
+func Collection(r *http.Request) (string, bool) {
+	if r.PathValue("id") != "" {
+		return path.Dir(r.URL.Path), true
+	}
+	return r.URL.Path, false
+}
+
+// Item returns the path of the item of collection with the given id.
+func Item(collection, id string) string {
+	return collection + "/" + url.PathEscape(id)
+}
+
+// Related returns the path of an item of the named endpoint registered
+// beside collection.
+func Related(collection, endpoint, id string) string {
+	return Item(path.Join(path.Dir(collection), endpoint), id)
+}
+
+// Resource is an object taken apart for encoding.
+type Resource struct {
+	// Value is the object as encoding/json decodes its JSON form, with
+	// numbers kept as json.Number.
+	Value interface{}
+	// Fields holds the members of Value if it is a JSON object, and is nil
+	// otherwise.
+	Fields map[string]interface{}
+	// ID is the object's "id" field, if it has one that is a number or a
+	// non-empty string.
+	ID    string
+	HasID bool
+	// Relationships is what the object reports if it is a rest.Relater.
+	Relationships []rest.Relationship
+}
+
+// Resources takes v apart, item by item if it is a slice or an array, which
+// it reports as a collection. Byte slices are single values.
+func Resources(v interface{}) (resources []Resource, collection bool, err error) {
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Type().Elem().Kind() != reflect.Uint8 {
+		resources = make([]Resource, rv.Len())
+		for i := range resources {
+			if resources[i], err = NewResource(rv.Index(i)); err != nil {
+				return nil, true, err
+			}
+		}
+		return resources, true, nil
+	}
+	res, err := NewResource(rv)
+	if err != nil {
+		return nil, false, err
+	}
+	return []Resource{res}, false, nil
+}
+
+var relaterType = reflect.TypeOf((*rest.Relater)(nil)).Elem()
+
+// NewResource takes apart the object v holds.
+func NewResource(v reflect.Value) (Resource, error) {
+	var res Resource
+	if !v.IsValid() {
+		return res, nil
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return res, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&res.Value); err != nil {
+		return res, err
+	}
+	res.Fields, _ = res.Value.(map[string]interface{})
+	switch id := res.Fields["id"].(type) {
+	case string:
+		res.ID, res.HasID = id, id != ""
+	case json.Number:
+		res.ID, res.HasID = id.String(), true
+	}
+
+	// the method set of a pointer includes that of its value, so take the
+	// address where possible
+	if v.CanAddr() && v.Addr().Type().Implements(relaterType) {
+		v = v.Addr()
+	}
+	if relater, ok := v.Interface().(rest.Relater); ok {
+		res.Relationships = relater.Relationships()
+	}
+	return res, nil
+}
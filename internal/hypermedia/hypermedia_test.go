@@ -0,0 +1,69 @@
+package hypermedia
+
+import (
+	"testing"
+
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"rest"
+)
+
+type yam struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Farmer string `json:"farmer"`
+}
+
+func (y *yam) Relationships() []rest.Relationship {
+	return []rest.Relationship{{Name: "farmer", Endpoint: "farmers", IDs: []string{y.Farmer}}}
+}
+
+func TestPaths(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://example.com/api/yams/7", nil)
+	r.SetPathValue("id", "7")
+	if collection, item := Collection(r); collection != "/api/yams" || !item {
+		t.Errorf("Expected item of /api/yams, got %s, %v", collection, item)
+	}
+	r, _ = http.NewRequest("GET", "http://example.com/api/yams", nil)
+	if collection, item := Collection(r); collection != "/api/yams" || item {
+		t.Errorf("Expected /api/yams itself, got %s, %v", collection, item)
+	}
+	if got := Item("/api/yams", "a b"); got != "/api/yams/a%20b" {
+		t.Errorf("Expected /api/yams/a%%20b, got %s", got)
+	}
+	if got := Related("/api/yams", "farmers", "3"); got != "/api/farmers/3" {
+		t.Errorf("Expected /api/farmers/3, got %s", got)
+	}
+	if got := Related("/yams", "farmers", "3"); got != "/farmers/3" {
+		t.Errorf("Expected /farmers/3, got %s", got)
+	}
+}
+
+func TestResources(t *testing.T) {
+	resources, collection, err := Resources([]yam{{ID: 1, Name: "Garnet", Farmer: "jo"}})
+	if err != nil || !collection || len(resources) != 1 {
+		t.Fatalf("Expected a collection of one, got %v, %v, %v", resources, collection, err)
+	}
+	res := resources[0]
+	if !res.HasID || res.ID != "1" || res.Fields["name"] != "Garnet" || res.Fields["id"] != json.Number("1") {
+		t.Errorf("Expected fields and id, got %+v", res)
+	}
+	expected := []rest.Relationship{{Name: "farmer", Endpoint: "farmers", IDs: []string{"jo"}}}
+	if !reflect.DeepEqual(res.Relationships, expected) {
+		t.Errorf("Expected %v, got %v", expected, res.Relationships)
+	}
+
+	resources, collection, err = Resources("yams")
+	if err != nil || collection || resources[0].Value != "yams" || resources[0].Fields != nil || resources[0].HasID {
+		t.Errorf("Expected a single plain value, got %+v, %v, %v", resources, collection, err)
+	}
+	resources, _, _ = Resources(nil)
+	if resources[0].Value != nil {
+		t.Errorf("Expected a nil value, got %v", resources[0].Value)
+	}
+	if _, _, err := Resources(func() {}); err == nil {
+		t.Errorf("Expected an error for a value without JSON form")
+	}
+}
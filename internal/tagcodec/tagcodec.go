@@ -0,0 +1,529 @@
+/*
+Package tagcodec holds what the binary codecs (rest/msgpackrest and
+rest/cborrest) share: walking Go values by reflection, honoring the same json
+struct tags as encoding/json, and assigning decoded values back into Go
+values.
+
+A format supplies a Writer that appends its encoding of each kind of value.
+Decoders parse into generic values (nil, bool, int64, uint64, float64, string,
+[]byte, time.Time, []interface{}, map[string]interface{} and
+map[interface{}]interface{}), which Assign then stores into the destination.
+*/
+package tagcodec
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Writer appends the encoding of single values to a buffer.
+type Writer interface {
+	AppendNil(b []byte) []byte
+	AppendBool(b []byte, v bool) []byte
+	AppendInt(b []byte, v int64) []byte
+	AppendUint(b []byte, v uint64) []byte
+	// AppendFloat is given the bit size of the Go value, 32 or 64.
+	AppendFloat(b []byte, v float64, bits int) []byte
+	AppendString(b []byte, v string) []byte
+	AppendBytes(b []byte, v []byte) []byte
+	AppendArrayHeader(b []byte, n int) []byte
+	AppendMapHeader(b []byte, n int) []byte
+}
+
+// Field is a struct field as seen by the codecs.
+type Field struct {
+	Name      string
+	Index     []int
+	OmitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type -> []Field
+
+// Fields returns the encoded fields of struct type t, in declaration order.
+// Names and omitempty come from json tags; fields tagged "-" and unexported
+// fields are skipped, and the fields of untagged embedded structs are
+// promoted.
+func Fields(t reflect.Type) []Field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]Field)
+	}
+	var fields []Field
+	seen := map[string]bool{}
+	collectFields(t, nil, seen, &fields)
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, seen map[string]bool, fields *[]Field) {
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+			f.Index = append(append([]int{}, index...), i)
+			embedded = append(embedded, f)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = f.Name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		omitEmpty := false
+		for _, opt := range parts[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		*fields = append(*fields, Field{name, append(append([]int{}, index...), i), omitEmpty})
+	}
+	// promoted fields lose to those declared at a shallower depth
+	for _, f := range embedded {
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		collectFields(ft, f.Index, seen, fields)
+	}
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, except that it reports false
+// instead of panicking at a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// maxDepth bounds the nesting of encoded values, which stops pointers that
+// lead back to themselves from recursing forever.
+const maxDepth = 1000
+
+// Encode appends the encoding of v to b. If deterministic is set, map
+// entries are sorted by their encoded keys, so that equal values always
+// encode to the same bytes.
+func Encode(w Writer, b []byte, v reflect.Value, deterministic bool) ([]byte, error) {
+	return encode(w, b, v, deterministic, 0)
+}
+
+func encode(w Writer, b []byte, v reflect.Value, deterministic bool, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("tagcodec: value nested more than %d deep", maxDepth)
+	}
+	if !v.IsValid() {
+		return w.AppendNil(b), nil
+	}
+	nilable := v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface
+	if v.Type().Implements(textMarshalerType) && !(nilable && v.IsNil()) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return w.AppendString(b, string(text)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return w.AppendNil(b), nil
+		}
+		return encode(w, b, v.Elem(), deterministic, depth+1)
+	case reflect.Bool:
+		return w.AppendBool(b, v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return w.AppendInt(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return w.AppendUint(b, v.Uint()), nil
+	case reflect.Float32:
+		return w.AppendFloat(b, v.Float(), 32), nil
+	case reflect.Float64:
+		return w.AppendFloat(b, v.Float(), 64), nil
+	case reflect.String:
+		return w.AppendString(b, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return w.AppendNil(b), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return w.AppendBytes(b, v.Bytes()), nil
+		}
+		fallthrough
+	case reflect.Array:
+		b = w.AppendArrayHeader(b, v.Len())
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if b, err = encode(w, b, v.Index(i), deterministic, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return w.AppendNil(b), nil
+		}
+		return encodeMap(w, b, v, deterministic, depth)
+	case reflect.Struct:
+		return encodeStruct(w, b, v, deterministic, depth)
+	}
+	return nil, fmt.Errorf("tagcodec: unsupported type %s", v.Type())
+}
+
+func encodeMap(w Writer, b []byte, v reflect.Value, deterministic bool, depth int) ([]byte, error) {
+	b = w.AppendMapHeader(b, v.Len())
+	if !deterministic {
+		iter := v.MapRange()
+		var err error
+		for iter.Next() {
+			if b, err = encode(w, b, iter.Key(), false, depth+1); err != nil {
+				return nil, err
+			}
+			if b, err = encode(w, b, iter.Value(), false, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	type entry struct{ key, value []byte }
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := encode(w, nil, iter.Key(), true, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := encode(w, nil, iter.Value(), true, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key, value})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	for _, e := range entries {
+		b = append(append(b, e.key...), e.value...)
+	}
+	return b, nil
+}
+
+func encodeStruct(w Writer, b []byte, v reflect.Value, deterministic bool, depth int) ([]byte, error) {
+	var (
+		names  []string
+		values []reflect.Value
+	)
+	for _, f := range Fields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.Index)
+		if !ok || (f.OmitEmpty && isEmpty(fv)) {
+			continue
+		}
+		names = append(names, f.Name)
+		values = append(values, fv)
+	}
+	b = w.AppendMapHeader(b, len(names))
+	var err error
+	for i, name := range names {
+		b = w.AppendString(b, name)
+		if b, err = encode(w, b, values[i], deterministic, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Unmarshal stores a decoded generic value in the value v points to.
+func Unmarshal(src interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("tagcodec: Unmarshal needs a non-nil pointer, got %T", v)
+	}
+	return Assign(rv.Elem(), src)
+}
+
+func mismatch(dst reflect.Value, src interface{}) error {
+	return fmt.Errorf("tagcodec: cannot decode %T into %s", src, dst.Type())
+}
+
+// Assign stores the generic value src in dst, converting it as
+// encoding/json would.
+func Assign(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return Assign(dst.Elem(), src)
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) && dst.Kind() != reflect.Interface {
+		dst.Set(sv)
+		return nil
+	}
+	if dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerType) {
+		if s, ok := src.(string); ok {
+			return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return mismatch(dst, src)
+		}
+		dst.Set(sv)
+		return nil
+	case reflect.Bool:
+		if v, ok := src.(bool); ok {
+			dst.SetBool(v)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch v := src.(type) {
+		case int64:
+			n = v
+		case uint64:
+			if v > math.MaxInt64 {
+				return mismatch(dst, src)
+			}
+			n = int64(v)
+		case float64:
+			if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+				return mismatch(dst, src)
+			}
+			n = int64(v)
+		default:
+			return mismatch(dst, src)
+		}
+		if dst.OverflowInt(n) {
+			return fmt.Errorf("tagcodec: %d overflows %s", n, dst.Type())
+		}
+		dst.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch v := src.(type) {
+		case int64:
+			if v < 0 {
+				return mismatch(dst, src)
+			}
+			n = uint64(v)
+		case uint64:
+			n = v
+		case float64:
+			if v != math.Trunc(v) || v < 0 || v >= math.MaxUint64 {
+				return mismatch(dst, src)
+			}
+			n = uint64(v)
+		default:
+			return mismatch(dst, src)
+		}
+		if dst.OverflowUint(n) {
+			return fmt.Errorf("tagcodec: %d overflows %s", n, dst.Type())
+		}
+		dst.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch v := src.(type) {
+		case float64:
+			dst.SetFloat(v)
+		case int64:
+			dst.SetFloat(float64(v))
+		case uint64:
+			dst.SetFloat(float64(v))
+		default:
+			return mismatch(dst, src)
+		}
+		return nil
+	case reflect.String:
+		switch v := src.(type) {
+		case string:
+			dst.SetString(v)
+			return nil
+		case []byte:
+			dst.SetString(string(v))
+			return nil
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			switch v := src.(type) {
+			case []byte:
+				dst.SetBytes(append([]byte{}, v...))
+				return nil
+			case string:
+				dst.SetBytes([]byte(v))
+				return nil
+			}
+		}
+		items, ok := src.([]interface{})
+		if !ok {
+			return mismatch(dst, src)
+		}
+		s := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := Assign(s.Index(i), item); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+		return nil
+	case reflect.Array:
+		items, ok := src.([]interface{})
+		if !ok {
+			return mismatch(dst, src)
+		}
+		for i := 0; i < dst.Len(); i++ {
+			var item interface{}
+			if i < len(items) {
+				item = items[i]
+			}
+			if err := Assign(dst.Index(i), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		return assignMap(dst, src)
+	case reflect.Struct:
+		return assignStruct(dst, src)
+	}
+	return mismatch(dst, src)
+}
+
+// entries returns the key/value pairs of a decoded map.
+func entries(src interface{}) ([][2]interface{}, bool) {
+	var pairs [][2]interface{}
+	switch m := src.(type) {
+	case map[string]interface{}:
+		for k, v := range m {
+			pairs = append(pairs, [2]interface{}{k, v})
+		}
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			pairs = append(pairs, [2]interface{}{k, v})
+		}
+	default:
+		return nil, false
+	}
+	return pairs, true
+}
+
+func assignMap(dst reflect.Value, src interface{}) error {
+	pairs, ok := entries(src)
+	if !ok {
+		return mismatch(dst, src)
+	}
+	t := dst.Type()
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(t, len(pairs)))
+	}
+	for _, pair := range pairs {
+		key := reflect.New(t.Key()).Elem()
+		if err := Assign(key, pair[0]); err != nil {
+			return err
+		}
+		value := reflect.New(t.Elem()).Elem()
+		if err := Assign(value, pair[1]); err != nil {
+			return err
+		}
+		dst.SetMapIndex(key, value)
+	}
+	return nil
+}
+
+func assignStruct(dst reflect.Value, src interface{}) error {
+	pairs, ok := entries(src)
+	if !ok {
+		return mismatch(dst, src)
+	}
+	fields := Fields(dst.Type())
+	for _, pair := range pairs {
+		name, ok := pair[0].(string)
+		if !ok {
+			continue
+		}
+		// exact matches win, as in encoding/json; unknown keys are ignored
+		var field *Field
+		for i := range fields {
+			if fields[i].Name == name {
+				field = &fields[i]
+				break
+			}
+			if field == nil && strings.EqualFold(fields[i].Name, name) {
+				field = &fields[i]
+			}
+		}
+		if field == nil {
+			continue
+		}
+		fv := dst
+		for i, x := range field.Index {
+			if i > 0 && fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					// as in encoding/json, which cannot reach the
+					// fields of such a struct either
+					if !fv.CanSet() {
+						return fmt.Errorf("tagcodec: cannot set embedded pointer to unexported struct %s", fv.Type().Elem())
+					}
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(x)
+		}
+		if err := Assign(fv, pair[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
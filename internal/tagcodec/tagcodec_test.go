@@ -0,0 +1,158 @@
+package tagcodec
+
+import (
+	"testing"
+
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// textWriter writes a readable trace of the values it is given.
+type textWriter struct{}
+
+func (textWriter) AppendNil(b []byte) []byte            { return append(b, "nil "...) }
+func (textWriter) AppendBool(b []byte, v bool) []byte   { return append(b, fmt.Sprintf("%t ", v)...) }
+func (textWriter) AppendInt(b []byte, v int64) []byte   { return append(b, fmt.Sprintf("i%d ", v)...) }
+func (textWriter) AppendUint(b []byte, v uint64) []byte { return append(b, fmt.Sprintf("u%d ", v)...) }
+func (textWriter) AppendString(b []byte, v string) []byte {
+	return append(b, fmt.Sprintf("%q ", v)...)
+}
+func (textWriter) AppendBytes(b []byte, v []byte) []byte { return append(b, fmt.Sprintf("%x ", v)...) }
+func (textWriter) AppendArrayHeader(b []byte, n int) []byte {
+	return append(b, fmt.Sprintf("[%d] ", n)...)
+}
+func (textWriter) AppendMapHeader(b []byte, n int) []byte {
+	return append(b, fmt.Sprintf("{%d} ", n)...)
+}
+func (textWriter) AppendFloat(b []byte, v float64, bits int) []byte {
+	return append(b, fmt.Sprintf("f%d:%g ", bits, v)...)
+}
+
+type Base struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Extra struct {
+	Note string
+}
+
+type testT struct {
+	Base
+	*Extra
+	Name    string    `json:"title"`
+	Hidden  string    `json:"-"`
+	Empty   []int     `json:"empty,omitempty"`
+	When    time.Time `json:"when"`
+	private int
+}
+
+type extra struct {
+	Note string
+}
+
+type withUnexported struct {
+	*extra
+}
+
+type node struct {
+	Next *node
+}
+
+func TestFields(t *testing.T) {
+	var names []string
+	for _, f := range Fields(reflect.TypeOf(testT{})) {
+		names = append(names, f.Name)
+	}
+	expected := []string{"title", "empty", "when", "id", "name", "Note"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected fields %v, got %v", expected, names)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	v := testT{
+		Base: Base{ID: 1, Name: "base"},
+		Name: "yam",
+		When: time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	data, err := Encode(textWriter{}, nil, reflect.ValueOf(v), false)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	// Extra is a nil pointer, so its field is left out
+	expected := `{4} "title" "yam" "when" "2016-03-01T00:00:00Z" "id" i1 "name" "base" `
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	data, _ = Encode(textWriter{}, nil, reflect.ValueOf(map[string]interface{}{"b": []byte{1}, "a": float32(1.5), "c": nil}), true)
+	if expected := `{3} "a" f32:1.5 "b" 01 "c" nil `; string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	if _, err := Encode(textWriter{}, nil, reflect.ValueOf(make(chan int)), false); err == nil {
+		t.Errorf("Expected error encoding a channel")
+	}
+
+	loop := &node{}
+	loop.Next = loop
+	if _, err := Encode(textWriter{}, nil, reflect.ValueOf(loop), false); err == nil {
+		t.Errorf("Expected error encoding a value that contains itself")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	src := map[string]interface{}{
+		"ID":     int64(7),
+		"name":   "base",
+		"title":  "yam",
+		"Hidden": "no",
+		"empty":  []interface{}{uint64(1), float64(2)},
+		"when":   "2016-03-01T00:00:00Z",
+		"Note":   "a note",
+		"other":  true,
+	}
+	var v testT
+	if err := Unmarshal(src, &v); err != nil {
+		t.Fatalf("Error unmarshaling: %s", err)
+	}
+	expected := testT{
+		Base:  Base{ID: 7, Name: "base"},
+		Extra: &Extra{Note: "a note"},
+		Name:  "yam",
+		Empty: []int{1, 2},
+		When:  time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, v)
+	}
+
+	var m map[int]string
+	if err := Unmarshal(map[interface{}]interface{}{int64(1): "one"}, &m); err != nil || m[1] != "one" {
+		t.Errorf("Expected map with integer keys, got %v (%v)", m, err)
+	}
+
+	for _, test := range []struct {
+		src interface{}
+		dst interface{}
+	}{
+		{int64(300), new(int8)},
+		{int64(-1), new(uint)},
+		{1.5, new(int)},
+		{"yam", new(int)},
+		{[]interface{}{"a"}, new([]int)},
+		{true, new(string)},
+	} {
+		if err := Unmarshal(test.src, test.dst); err == nil {
+			t.Errorf("Expected error assigning %#v to %T", test.src, test.dst)
+		}
+	}
+	if err := Unmarshal(int64(1), 1); err == nil {
+		t.Errorf("Expected error unmarshaling into a non-pointer")
+	}
+	if err := Unmarshal(map[string]interface{}{"Note": "a note"}, &withUnexported{}); err == nil {
+		t.Errorf("Expected error unmarshaling through a nil unexported embedded pointer")
+	}
+}
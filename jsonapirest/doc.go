@@ -0,0 +1,27 @@
+/*
+Package jsonapirest provides a bootstrapped REST service speaking JSON:API
+(application/vnd.api+json).
+
+	e := jsonapirest.NewEndpoint("yams")
+	http.Handle("/", e.Handler())
+
+Handlers return plain Go values, which are encoded as JSON and then
+reshaped into resource objects: the "id" field becomes the resource's id,
+the endpoint's Name its type, and the other fields its attributes. Each
+resource gets a self link, and documents a self link to the requested path.
+Values other than objects are sent as the "value" member of the document's
+meta.
+
+Objects implementing rest.Relater get a relationship for each one they
+report, identifying the related resources by the Endpoint named in it, with
+a related link for to-one relationships. Their fields of the same names are
+left out of the attributes.
+
+Request bodies are JSON:API documents too, flattened back into plain JSON
+before being decoded into the endpoint's Model (see Unmarshal), and
+collections with a Batch take documents whose data is an array. Resources
+of a type other than the endpoint's Name are refused with 409 (Conflict). Failed
+requests are answered with an errors document; validation failures point
+each error at its attribute.
+*/
+package jsonapirest
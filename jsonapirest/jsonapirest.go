@@ -0,0 +1,317 @@
+package jsonapirest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"rest"
+	"rest/internal/hypermedia"
+)
+
+// MediaType is the media type of JSON:API documents.
+const MediaType = "application/vnd.api+json"
+
+// ErrNoData is returned by Unmarshal for documents without primary data.
+var ErrNoData error = errors.New("Document has no data")
+
+// ErrTypeMismatch is returned when the resource object sent to an Endpoint
+// made by NewEndpoint has a type other than the Endpoint's Name. It
+// corresponds to http.StatusConflict.
+var ErrTypeMismatch error = errors.New("Resource type does not match the collection")
+
+// Codec is a REST codec reading and writing JSON:API documents. By default
+// it only allows request bodies of up to a megabyte.
+var Codec rest.Codec = rest.Codec{
+	Accepts:    MediaType,
+	MaxSize:    1 << 20, // 1 megabyte
+	Render:     render,
+	Unmarshal:  Unmarshal,
+	SplitArray: splitArray,
+	ErrorBody:  errorBody,
+}
+
+func init() {
+	rest.RegisterCodec(Codec)
+}
+
+// Errors is the document sent for failed requests.
+type Errors struct {
+	Errors []Error `json:"errors"`
+}
+
+// Error is a JSON:API error object.
+type Error struct {
+	Status string  `json:"status"`
+	Title  string  `json:"title"`
+	Detail string  `json:"detail,omitempty"`
+	Source *Source `json:"source,omitempty"`
+}
+
+// Source points to the part of a request document an Error is about.
+type Source struct {
+	Pointer string `json:"pointer"`
+}
+
+func errorBody(statusCode int, err error) interface{} {
+	e := Error{Status: strconv.Itoa(statusCode), Title: http.StatusText(statusCode)}
+	// 5xx details are internal
+	if statusCode < 500 {
+		e.Detail = err.Error()
+	}
+	return Errors{[]Error{e}}
+}
+
+// validationErrors points each field error at its attribute.
+func validationErrors(failure rest.ValidationFailure) Errors {
+	status := strconv.Itoa(http.StatusUnprocessableEntity)
+	errs := make([]Error, len(failure.Errors))
+	for i, fe := range failure.Errors {
+		errs[i] = Error{Status: status, Title: http.StatusText(http.StatusUnprocessableEntity), Detail: fe.Message}
+		if fe.Field != "" {
+			errs[i].Detail = fe.Field + " " + fe.Message
+			errs[i].Source = &Source{"/data/attributes/" + strings.Replace(fe.Field, ".", "/", -1)}
+		}
+	}
+	return Errors{errs}
+}
+
+func render(r *http.Request, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case Errors:
+		return json.Marshal(v)
+	case rest.ValidationFailure:
+		return json.Marshal(validationErrors(v))
+	}
+	resources, many, err := hypermedia.Resources(v)
+	if err != nil {
+		return nil, err
+	}
+	collection, item := hypermedia.Collection(r)
+	doc := map[string]interface{}{
+		"links": map[string]string{"self": r.URL.Path},
+	}
+
+	// only objects can be resources; anything else goes in meta
+	values := make([]interface{}, len(resources))
+	objects := true
+	for i, res := range resources {
+		values[i] = res.Value
+		objects = objects && res.Fields != nil
+	}
+	switch {
+	case many && objects:
+		data := make([]interface{}, len(resources))
+		for i, res := range resources {
+			data[i] = resourceObject(collection, res, "")
+		}
+		doc["data"] = data
+	case many:
+		doc["meta"] = map[string]interface{}{"value": values}
+	case objects:
+		id := ""
+		if item {
+			id = r.PathValue("id")
+		}
+		doc["data"] = resourceObject(collection, resources[0], id)
+	case values[0] == nil:
+		doc["data"] = nil
+	default:
+		doc["meta"] = map[string]interface{}{"value": values[0]}
+	}
+	return json.Marshal(doc)
+}
+
+// resourceObject builds the resource object for res, an item of
+// collection, taking id for it if it has none of its own.
+func resourceObject(collection string, res hypermedia.Resource, id string) map[string]interface{} {
+	if res.HasID {
+		id = res.ID
+	}
+	obj := map[string]interface{}{"type": path.Base(collection)}
+	if id != "" {
+		obj["id"] = id
+		obj["links"] = map[string]string{"self": hypermedia.Item(collection, id)}
+	}
+
+	// relationships and attributes share a namespace, so fields standing
+	// for a relationship are left out of the attributes
+	relationships := map[string]interface{}{}
+	for _, rel := range res.Relationships {
+		identifiers := make([]interface{}, len(rel.IDs))
+		for i, id := range rel.IDs {
+			identifiers[i] = map[string]string{"type": rel.Endpoint, "id": id}
+		}
+		relationship := map[string]interface{}{"data": identifiers}
+		if !rel.ToMany {
+			relationship["data"] = nil
+			if len(identifiers) > 0 {
+				relationship["data"] = identifiers[0]
+				relationship["links"] = map[string]string{"related": hypermedia.Related(collection, rel.Endpoint, rel.IDs[0])}
+			}
+		}
+		relationships[rel.Name] = relationship
+	}
+	attributes := map[string]interface{}{}
+	for k, v := range res.Fields {
+		if _, ok := relationships[k]; !ok && k != "id" {
+			attributes[k] = v
+		}
+	}
+	if len(attributes) > 0 {
+		obj["attributes"] = attributes
+	}
+	if len(relationships) > 0 {
+		obj["relationships"] = relationships
+	}
+	return obj
+}
+
+type document struct {
+	Data json.RawMessage `json:"data"`
+}
+
+type resource struct {
+	Type          string                     `json:"type"`
+	ID            *string                    `json:"id"`
+	Attributes    map[string]json.RawMessage `json:"attributes"`
+	Relationships map[string]struct {
+		Data json.RawMessage `json:"data"`
+	} `json:"relationships"`
+}
+
+type identifier struct {
+	ID string `json:"id"`
+}
+
+/*
+Unmarshal decodes the resource object that is the primary data of a JSON:API
+document into v. Its id and attributes are taken as the fields of the same
+names, and each relationship as a field holding the related id, or a slice of
+ids for to-many relationships, so that a resource such as
+
+	{"data": {"type": "yams", "id": "1",
+	  "attributes": {"name": "Garnet"},
+	  "relationships": {"farmer": {"data": {"type": "farmers", "id": "jo"}}}}}
+
+decodes like the JSON object
+
+	{"id": "1", "name": "Garnet", "farmer": "jo"}
+
+Unmarshal accepts resources of any type; Endpoints made by NewEndpoint only
+accept resources whose type is their Name, and answer others with
+ErrTypeMismatch.
+*/
+func Unmarshal(data []byte, v interface{}) error {
+	return unmarshal(data, v, "")
+}
+
+// unmarshal is Unmarshal, refusing resources of a type other than typ
+// unless typ is empty.
+func unmarshal(data []byte, v interface{}, typ string) error {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Data) == 0 || string(doc.Data) == "null" {
+		return ErrNoData
+	}
+	var res resource
+	if err := json.Unmarshal(doc.Data, &res); err != nil {
+		return err
+	}
+	if typ != "" && res.Type != typ {
+		return ErrTypeMismatch
+	}
+	fields := map[string]json.RawMessage{}
+	for k, v := range res.Attributes {
+		fields[k] = v
+	}
+	for name, rel := range res.Relationships {
+		relData := bytes.TrimSpace(rel.Data)
+		if len(relData) == 0 {
+			// links or meta only
+			continue
+		}
+		var ids interface{}
+		switch relData[0] {
+		case '[':
+			var identifiers []identifier
+			if err := json.Unmarshal(rel.Data, &identifiers); err != nil {
+				return err
+			}
+			list := make([]string, len(identifiers))
+			for i, ident := range identifiers {
+				list[i] = ident.ID
+			}
+			ids = list
+		case '{':
+			var ident identifier
+			if err := json.Unmarshal(rel.Data, &ident); err != nil {
+				return err
+			}
+			ids = ident.ID
+		}
+		raw, err := json.Marshal(ids)
+		if err != nil {
+			return err
+		}
+		fields[name] = raw
+	}
+	if res.ID != nil {
+		raw, _ := json.Marshal(*res.ID)
+		fields["id"] = raw
+	}
+	flat, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(flat, v)
+}
+
+// splitArray splits a document whose primary data is an array into one
+// document per resource object.
+func splitArray(data []byte) ([][]byte, bool) {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, false
+	}
+	var items []json.RawMessage
+	if len(doc.Data) == 0 || doc.Data[0] != '[' || json.Unmarshal(doc.Data, &items) != nil {
+		return nil, false
+	}
+	split := make([][]byte, len(items))
+	for i, item := range items {
+		split[i], _ = json.Marshal(document{item})
+	}
+	return split, true
+}
+
+// NewEndpoint returns a *rest.Endpoint configured to speak JSON:API, taking
+// only resources of type name.
+func NewEndpoint(name string) *rest.Endpoint {
+	codec := Codec
+	codec.Unmarshal = func(data []byte, v interface{}) error {
+		return unmarshal(data, v, name)
+	}
+	return &rest.Endpoint{
+		GetCollection:  rest.UnimplementedCollectionHandler,
+		PostCollection: rest.UnimplementedCollectionHandler,
+
+		Get:    rest.UnimplementedHandler,
+		Head:   rest.UnimplementedHandler,
+		Put:    rest.UnimplementedHandler,
+		Post:   rest.UnimplementedHandler,
+		Delete: rest.UnimplementedHandler,
+
+		Codec:            codec,
+		Name:             name,
+		StatusCodeLookup: map[error]int{ErrTypeMismatch: http.StatusConflict},
+		Logger:           rest.IOLogger{Writer: os.Stdout},
+	}
+}
@@ -0,0 +1,158 @@
+package jsonapirest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+
+	"rest"
+)
+
+type yam struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name" validate:"required"`
+	Farmer  string   `json:"farmer,omitempty"`
+	Recipes []string `json:"recipes,omitempty"`
+}
+
+func (y yam) Relationships() []rest.Relationship {
+	return []rest.Relationship{
+		{Name: "farmer", Endpoint: "farmers", IDs: []string{y.Farmer}},
+		{Name: "recipes", Endpoint: "recipes", IDs: y.Recipes, ToMany: true},
+	}
+}
+
+func serve(h http.Handler, method, url, body string) (int, interface{}) {
+	r, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	r.Header.Set("Accept", MediaType)
+	r.Header.Set("Content-Type", MediaType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var doc interface{}
+	json.Unmarshal(w.Body.Bytes(), &doc)
+	return w.Code, doc
+}
+
+func decode(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestUnmarshal(t *testing.T) {
+	var y yam
+	err := Unmarshal([]byte(`{"data": {"type": "yams", "id": "1",
+	  "attributes": {"name": "Garnet", "farmer": "ignored"},
+	  "relationships": {
+	    "farmer": {"data": {"type": "farmers", "id": "jo"}},
+	    "recipes": {"data": [{"type": "recipes", "id": "pie"}, {"type": "recipes", "id": "mash"}]},
+	    "eaters": {"links": {"related": "/eaters"}}
+	  }}}`), &y)
+	expected := yam{ID: "1", Name: "Garnet", Farmer: "jo", Recipes: []string{"pie", "mash"}}
+	if err != nil || !reflect.DeepEqual(y, expected) {
+		t.Errorf("Expected %+v, got %+v (%v)", expected, y, err)
+	}
+	if err := unmarshal([]byte(`{"data": {"type": "farmers", "attributes": {"name": "Jo"}}}`), &y, "yams"); err != ErrTypeMismatch {
+		t.Errorf("Expected %v, got %v", ErrTypeMismatch, err)
+	}
+	for _, data := range []string{`{}`, `{"data": null}`, `{"data": 1}`, `[`} {
+		if err := Unmarshal([]byte(data), &y); err == nil {
+			t.Errorf("Expected an error for %s", data)
+		}
+	}
+}
+
+func TestSplitArray(t *testing.T) {
+	items, ok := splitArray([]byte(`{"data": [{"type": "yams", "id": "1"}, {"type": "yams"}]}`))
+	if !ok || len(items) != 2 || string(items[0]) != `{"data":{"type":"yams","id":"1"}}` {
+		t.Errorf("Expected two documents, got %q, %v", items, ok)
+	}
+	if _, ok := splitArray([]byte(`{"data": {"type": "yams"}}`)); ok {
+		t.Errorf("Expected a single resource not to split")
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	e := NewEndpoint("yams")
+	e.Model = yam{}
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return []yam{{ID: "1", Name: "Garnet", Farmer: "jo", Recipes: []string{"pie"}}}, nil
+	}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if id == "2" {
+			return nil, rest.ErrNotFound
+		}
+		return []string{"not", "objects"}, nil
+	}
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		y := rest.Decoded(r).(*yam)
+		return map[string]string{"name": y.Name}, nil
+	}
+	e.StatusCodeLookup[rest.ErrNotFound] = http.StatusNotFound
+	api := rest.NewAPI("/api")
+	api.Register(e)
+	h := api.Handler()
+
+	code, doc := serve(h, "GET", "http://example.com/api/yams", "")
+	expected := decode(`{
+	  "links": {"self": "/api/yams"},
+	  "data": [{
+	    "type": "yams", "id": "1",
+	    "attributes": {"name": "Garnet"},
+	    "relationships": {
+	      "farmer": {"data": {"type": "farmers", "id": "jo"}, "links": {"related": "/api/farmers/jo"}},
+	      "recipes": {"data": [{"type": "recipes", "id": "pie"}]}
+	    },
+	    "links": {"self": "/api/yams/1"}
+	  }]
+	}`)
+	if code != http.StatusOK || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Collection: expected %v, got %d %v", expected, code, doc)
+	}
+
+	// the id comes from the path when the object has none
+	code, doc = serve(h, "PUT", "http://example.com/api/yams/3",
+		`{"data": {"type": "yams", "id": "3", "attributes": {"name": "Jewel"}}}`)
+	expected = decode(`{
+	  "links": {"self": "/api/yams/3"},
+	  "data": {"type": "yams", "id": "3", "attributes": {"name": "Jewel"}, "links": {"self": "/api/yams/3"}}
+	}`)
+	if code != http.StatusOK || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Object: expected %v, got %d %v", expected, code, doc)
+	}
+
+	code, doc = serve(h, "GET", "http://example.com/api/yams/3", "")
+	expected = decode(`{"links": {"self": "/api/yams/3"}, "meta": {"value": ["not", "objects"]}}`)
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Plain value: expected %v, got %d %v", expected, code, doc)
+	}
+
+	code, doc = serve(h, "GET", "http://example.com/api/yams/2", "")
+	expected = decode(`{"errors": [{"status": "404", "title": "Not Found", "detail": "Not found"}]}`)
+	if code != http.StatusNotFound || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Missing: expected %v, got %d %v", expected, code, doc)
+	}
+
+	code, doc = serve(h, "PUT", "http://example.com/api/yams/3", `{"data": {"type": "yams", "attributes": {}}}`)
+	expected = decode(`{"errors": [{"status": "422", "title": "Unprocessable Entity",
+	  "detail": "name is required", "source": {"pointer": "/data/attributes/name"}}]}`)
+	if code != http.StatusUnprocessableEntity || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Invalid: expected %v, got %d %v", expected, code, doc)
+	}
+
+	if code, _ = serve(h, "PUT", "http://example.com/api/yams/3", `{"name": "Jewel"}`); code != http.StatusBadRequest {
+		t.Errorf("Plain JSON: expected http return code %d, got %d", http.StatusBadRequest, code)
+	}
+
+	code, doc = serve(h, "PUT", "http://example.com/api/yams/3", `{"data": {"type": "farmers", "attributes": {"name": "Jo"}}}`)
+	expected = decode(`{"errors": [{"status": "409", "title": "Conflict", "detail": "Resource type does not match the collection"}]}`)
+	if code != http.StatusConflict || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Wrong type: expected %v, got %d %v", expected, code, doc)
+	}
+}
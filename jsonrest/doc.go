@@ -24,5 +24,13 @@ mapping error codes on e.StatusCodeLookup as follows:
   
   e.StatusCodeLookup[fancydb.ErrFancyDBIsBusted] = http.StatusServiceUnavailable
 
+Clients sending "Accept: application/x-ndjson" get newline-delimited JSON
+instead. Collection handlers can then return a channel or an iterator
+function, and each item is sent as its own line as soon as it is ready:
+
+  e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+    return fancydb.Scan(r.Context()), nil // a chan *Yam
+  }
+
 */
 package jsonrest
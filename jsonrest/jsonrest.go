@@ -4,6 +4,7 @@ import (
   "rest"
   "os"
   "encoding/json"
+  "bytes"
 )
 
 var (
@@ -13,11 +14,39 @@ var (
     Accepts: "application/json",
     MaxSize: 1<<10, // 1 megabyte
     Marshal: json.Marshal,
+    Unmarshal: json.Unmarshal,
+    SplitArray: splitArray,
   }
 )
 
-// NewJSONEndpoint returns a *rest.Endpoint configured to use JSON.
+func init() {
+  rest.RegisterCodec(Codec)
+  rest.RegisterCodec(NDJSONCodec)
+}
+
+// splitArray splits a JSON array into its raw elements.
+func splitArray(data []byte) ([][]byte, bool) {
+  data = bytes.TrimSpace(data)
+  if len(data) == 0 || data[0] != '[' {
+    return nil, false
+  }
+  var items []json.RawMessage
+  if err := json.Unmarshal(data, &items); err != nil {
+    return nil, false
+  }
+  split := make([][]byte, len(items))
+  for i, item := range items {
+    split[i] = item
+  }
+  return split, true
+}
+
+// NewJSONEndpoint returns a *rest.Endpoint configured to use JSON, and
+// newline-delimited JSON for clients asking for it. Both accept request
+// bodies up to Codec.MaxSize.
 func NewEndpoint(name string) *rest.Endpoint {
+  ndjson := NDJSONCodec
+  ndjson.MaxSize = Codec.MaxSize
   return &rest.Endpoint{
     GetCollection: rest.UnimplementedCollectionHandler,
     PostCollection: rest.UnimplementedCollectionHandler,
@@ -29,6 +58,7 @@ func NewEndpoint(name string) *rest.Endpoint {
     Delete: rest.UnimplementedHandler,
 
     Codec: Codec,
+    Alternates: []rest.Codec{ndjson},
     Name: name,
     StatusCodeLookup: map[error]int{},
     Logger: rest.IOLogger{os.Stdout},
@@ -97,3 +97,18 @@ func TestNewEndpoint(t *testing.T) {
     t.Errorf("Expected testResponseObject.YamCount to equal %d, got %d", 3, testResponseObject.YamCount)
   }
 }
+
+func TestSplitArray(t *testing.T) {
+  items, ok := Codec.SplitArray([]byte(` [{"yams": "a"}, 2, "three"]`))
+  if !ok || len(items) != 3 {
+    t.Fatalf("Expected 3 items, got %d (ok %t)", len(items), ok)
+  }
+  if string(items[0]) != `{"yams": "a"}` || string(items[2]) != `"three"` {
+    t.Errorf("Expected raw elements, got %q", items)
+  }
+  for _, body := range []string{`{"yams": "a"}`, `null`, `[1, 2`} {
+    if _, ok := Codec.SplitArray([]byte(body)); ok {
+      t.Errorf("Expected %s not to split", body)
+    }
+  }
+}
@@ -0,0 +1,77 @@
+package jsonrest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"rest"
+)
+
+// NDJSONMediaType is the content type of newline-delimited JSON, also
+// known as JSON Lines.
+const NDJSONMediaType = "application/x-ndjson"
+
+// NDJSONCodec answers with one JSON value per line. Collections stream: a
+// collection handler may return a slice, a channel or an iterator function
+// (see rest.Each), and each item is written and flushed to the client as
+// its own line as soon as it is ready, so that memory use stays flat
+// however long the collection. Single objects come out as a single line.
+// Request bodies hold one JSON value, or one per line for the items of a
+// bulk POST.
+var NDJSONCodec rest.Codec = rest.Codec{
+	Accepts:    NDJSONMediaType,
+	MaxSize:    1 << 20, // 1 megabyte
+	Marshal:    marshalLines,
+	Unmarshal:  json.Unmarshal,
+	SplitArray: splitLines,
+	Stream:     streamLines,
+}
+
+// streamLines writes v as JSON lines, flushing after each.
+func streamLines(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	ok, err := rest.Each(v, func(item interface{}) error {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if !ok {
+		return enc.Encode(v)
+	}
+	return err
+}
+
+func marshalLines(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := streamLines(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// splitLines splits a body into its non-blank lines, which must each hold
+// valid JSON.
+func splitLines(data []byte) ([][]byte, bool) {
+	var items [][]byte
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, len(data)+1)
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, false
+		}
+		items = append(items, line)
+	}
+	return items, s.Err() == nil && len(items) > 0
+}
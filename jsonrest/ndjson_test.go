@@ -0,0 +1,108 @@
+package jsonrest
+
+import (
+	"testing"
+
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"rest"
+)
+
+func TestNDJSON(t *testing.T) {
+	e := NewEndpoint("yams")
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return func(yield func(testT) bool) {
+			for i := 1; i <= 3; i++ {
+				if !yield(testT{Yams: strings.Repeat("YAMS", i), YamCount: i}) {
+					return
+				}
+			}
+		}, nil
+	}
+	handler := e.Handler()
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/yams", nil)
+	r.Header.Set("Accept", NDJSONMediaType)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != NDJSONMediaType {
+		t.Fatalf("Expected %d and %s, got %d and %s", http.StatusOK, NDJSONMediaType, w.Code, w.Header().Get("Content-Type"))
+	}
+	if !w.Flushed {
+		t.Errorf("Expected lines to be flushed")
+	}
+	s := bufio.NewScanner(w.Body)
+	count := 0
+	for s.Scan() {
+		var item testT
+		if err := json.Unmarshal(s.Bytes(), &item); err != nil {
+			t.Fatalf("Error decoding line %q: %s", s.Text(), err)
+		}
+		if count++; item.YamCount != count {
+			t.Errorf("Expected yam count %d, got %d", count, item.YamCount)
+		}
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 lines, got %d", count)
+	}
+
+	// the same iterator is collected into an array for plain JSON
+	w = httptest.NewRecorder()
+	r.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(w, r)
+	var items []testT
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil || len(items) != 3 {
+		t.Errorf("Expected a JSON array of 3, got %s (%v)", w.Body.String(), err)
+	}
+}
+
+func TestNDJSONMaxSize(t *testing.T) {
+	e := NewEndpoint("yams")
+	e.Logger = rest.IOLogger{Writer: ioutil.Discard}
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	body := strings.Repeat(`{"yams":"YAMS"}`+"\n", 100)
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/yams", strings.NewReader(body))
+	r.Header.Set("Content-Type", NDJSONMediaType)
+	r.Header.Set("Accept", "application/json")
+	e.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected http return code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestMarshalLines(t *testing.T) {
+	for _, test := range []struct {
+		v        interface{}
+		expected string
+	}{
+		{testT{Yams: "YAMS"}, `{"yams":"YAMS","has_yams":false,"yam_count":0}` + "\n"},
+		{[]int{1, 2}, "1\n2\n"},
+		{[]int{}, ""},
+		{rest.ValidationFailure{}, `{"errors":null}` + "\n"},
+	} {
+		data, err := NDJSONCodec.Marshal(test.v)
+		if err != nil || string(data) != test.expected {
+			t.Errorf("%#v: expected %q, got %q (%v)", test.v, test.expected, data, err)
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	items, ok := NDJSONCodec.SplitArray([]byte("{\"yams\":\"a\"}\n\n  2\r\n\"three\""))
+	if !ok || len(items) != 3 || string(items[1]) != "2" {
+		t.Errorf("Expected 3 lines, got %q (ok %t)", items, ok)
+	}
+	for _, bad := range []string{"", "\n", "{\"yams\":\n\"a\"}"} {
+		if _, ok := NDJSONCodec.SplitArray([]byte(bad)); ok {
+			t.Errorf("Expected %q not to split", bad)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package rest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errJWTMalformed  = errors.New("malformed JWT")
+	errJWTAlgorithm  = errors.New("unsupported JWT algorithm")
+	errJWTKey        = errors.New("no key for JWT")
+	errJWTSignature  = errors.New("invalid JWT signature")
+	errJWTExpired    = errors.New("JWT has expired")
+	errJWTNotYet     = errors.New("JWT is not valid yet")
+	errJWTIssuer     = errors.New("JWT issuer mismatch")
+	errJWTAudience   = errors.New("JWT audience mismatch")
+	errJWKSMalformed = errors.New("malformed JWKS")
+)
+
+type jwtAlgorithm struct {
+	hash  crypto.Hash
+	kind  string
+	curve elliptic.Curve
+}
+
+// jwtAlgorithms maps the supported "alg" header values to their hash and the
+// kind of key they need, which stops a token from choosing, say, HMAC with a
+// public RSA key as the secret. The ES algorithms are each tied to a curve.
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"HS256": {crypto.SHA256, "oct", nil},
+	"HS384": {crypto.SHA384, "oct", nil},
+	"HS512": {crypto.SHA512, "oct", nil},
+	"RS256": {crypto.SHA256, "RSA", nil},
+	"RS384": {crypto.SHA384, "RSA", nil},
+	"RS512": {crypto.SHA512, "RSA", nil},
+	"ES256": {crypto.SHA256, "EC", elliptic.P256()},
+	"ES384": {crypto.SHA384, "EC", elliptic.P384()},
+	"ES512": {crypto.SHA512, "EC", elliptic.P521()},
+}
+
+// JWTAuth authenticates requests carrying a JSON Web Token as a bearer
+// token. It verifies the signature and the exp, nbf, iss and aud claims. The
+// resulting Principal is named after the "sub" claim, takes its Scopes from
+// the "scope" (space separated) or "scp" claim and its Roles from the
+// "roles" claim, and carries every claim in Claims.
+type JWTAuth struct {
+	Realm string
+	// Keys holds verification keys by key id ("kid"): a []byte secret for
+	// the HS algorithms, an *rsa.PublicKey for RS and an *ecdsa.PublicKey
+	// for ES. A key stored under "" is used for tokens without a kid.
+	Keys map[string]interface{}
+	// JWKS, if not nil, is consulted for keys not found in Keys.
+	JWKS *JWKS
+	// Issuer, if set, must equal the "iss" claim.
+	Issuer string
+	// Audience, if set, must appear in the "aud" claim.
+	Audience string
+	// Leeway allows for clock skew when checking exp and nbf.
+	Leeway time.Duration
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// Challenge implements Authenticator.
+func (j JWTAuth) Challenge() string {
+	return quoteRealm("Bearer", j.Realm)
+}
+
+// Authenticate implements Authenticator.
+func (j JWTAuth) Authenticate(r *http.Request, body []byte) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	claims, err := j.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Principal{Claims: claims}
+	p.Name, _ = claims["sub"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = stringList(claims["scp"])
+	}
+	p.Roles = stringList(claims["roles"])
+	return p, nil
+}
+
+// stringList converts a claim holding a string or a list of strings.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Verify checks a compact serialized JWT and returns its claims.
+func (j JWTAuth) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errJWTMalformed
+	}
+	alg, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return nil, errJWTAlgorithm
+	}
+	key, ok := j.Keys[header.Kid]
+	if !ok && j.JWKS != nil {
+		key, ok = j.JWKS.Key(header.Kid)
+	}
+	if !ok {
+		return nil, errJWTKey
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+	if err := verifyJWTSignature(alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errJWTMalformed
+	}
+	now := time.Now()
+	if j.Now != nil {
+		now = j.Now()
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(j.Leeway)) {
+		return nil, errJWTExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-j.Leeway)) {
+		return nil, errJWTNotYet
+	}
+	if j.Issuer != "" && claims["iss"] != j.Issuer {
+		return nil, errJWTIssuer
+	}
+	if j.Audience != "" && !containsString(stringList(claims["aud"]), j.Audience) {
+		return nil, errJWTAudience
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func verifyJWTSignature(alg jwtAlgorithm, key interface{}, signed string, sig []byte) error {
+	hash, kind := alg.hash, alg.kind
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case []byte:
+		if kind != "oct" {
+			return errJWTAlgorithm
+		}
+		mac := hmac.New(hash.New, key)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return errJWTSignature
+		}
+	case *rsa.PublicKey:
+		if kind != "RSA" {
+			return errJWTAlgorithm
+		}
+		if rsa.VerifyPKCS1v15(key, hash, digest, sig) != nil {
+			return errJWTSignature
+		}
+	case *ecdsa.PublicKey:
+		if kind != "EC" || key.Curve.Params().Name != alg.curve.Params().Name {
+			return errJWTAlgorithm
+		}
+		// JWS carries the raw r and s values, each padded to the curve size
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errJWTSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errJWTSignature
+		}
+	default:
+		return errJWTKey
+	}
+	return nil
+}
+
+// JWKS is a set of verification keys in JSON Web Key Set format, keyed by
+// key id. RSA, EC (P-256, P-384 and P-521) and symmetric ("oct") keys are
+// understood; others are skipped.
+type JWKS struct {
+	mu   sync.RWMutex
+	keys map[string]interface{}
+	url  string
+}
+
+// ParseJWKS parses a JSON Web Key Set document.
+func ParseJWKS(data []byte) (*JWKS, error) {
+	keys, err := parseJWKSKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	return &JWKS{keys: keys}, nil
+}
+
+// LoadJWKSFile reads a JSON Web Key Set from a file.
+func LoadJWKSFile(path string) (*JWKS, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// jwksClient fetches key sets, giving up on issuers that do not answer.
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// maxJWKSSize bounds the key sets FetchJWKS downloads.
+var maxJWKSSize int64 = 1 << 20 // 1 megabyte
+
+// FetchJWKS downloads a JSON Web Key Set from url, giving up after ten
+// seconds, or on key sets larger than a megabyte. Call Refresh to download it again, for instance after the issuer
+// rotates its keys.
+func FetchJWKS(url string) (*JWKS, error) {
+	j := &JWKS{url: url}
+	if err := j.Refresh(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Refresh downloads the key set again from the URL it was fetched from. It
+// does nothing for key sets that were not fetched with FetchJWKS.
+func (j *JWKS) Refresh() error {
+	if j.url == "" {
+		return nil
+	}
+	resp, err := jwksClient.Get(j.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rest: fetching JWKS from %s: %s", j.url, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxJWKSSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > maxJWKSSize {
+		return fmt.Errorf("rest: fetching JWKS from %s: larger than %d bytes", j.url, maxJWKSSize)
+	}
+	keys, err := parseJWKSKeys(data)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+	return nil
+}
+
+// Key returns the key with the given id.
+func (j *JWKS) Key(kid string) (interface{}, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func parseJWKSKeys(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errJWKSMalformed
+	}
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errJWKSMalformed
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// publicKey returns the verification key described by k, or nil for key
+// types it does not understand.
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errJWKSMalformed
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errJWKSMalformed
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, errJWKSMalformed
+		}
+		return secret, nil
+	}
+	return nil, nil
+}
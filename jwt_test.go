@@ -0,0 +1,230 @@
+package rest
+
+import (
+	"testing"
+
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+)
+
+// signJWT builds a compact JWT, signing it with key according to alg.
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	h := crypto.SHA256.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(crypto.SHA256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest); err != nil {
+			t.Fatalf("Error signing JWT with RSA: %s", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			t.Fatalf("Error signing JWT with ECDSA: %s", err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func b64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating RSA key: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating ECDSA key: %s", err)
+	}
+	secret := []byte("sekrit")
+	now := time.Unix(1700000000, 0)
+
+	j := JWTAuth{
+		Keys: map[string]interface{}{
+			"hs":  secret,
+			"rsa": &rsaKey.PublicKey,
+			"ec":  &ecKey.PublicKey,
+		},
+		Issuer:   "https://issuer.example.com",
+		Audience: "yams",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	}
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "jo",
+			"iss": "https://issuer.example.com",
+			"aud": []string{"yams", "beets"},
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	for _, test := range []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"HS256", signJWT(t, "HS256", "hs", secret, claims(nil)), nil},
+		{"RS256", signJWT(t, "RS256", "rsa", rsaKey, claims(nil)), nil},
+		{"ES256", signJWT(t, "ES256", "ec", ecKey, claims(nil)), nil},
+		{"wrong secret", signJWT(t, "HS256", "hs", []byte("guess"), claims(nil)), errJWTSignature},
+		{"unknown kid", signJWT(t, "HS256", "nope", secret, claims(nil)), errJWTKey},
+		{"alg confusion", signJWT(t, "HS256", "rsa", secret, claims(nil)), errJWTAlgorithm},
+		{"wrong curve", signJWT(t, "ES384", "ec", ecKey, claims(nil)), errJWTAlgorithm},
+		{"alg none", signJWT(t, "none", "hs", secret, claims(nil)), errJWTAlgorithm},
+		{"expired", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()})), errJWTExpired},
+		{"within leeway", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()})), nil},
+		{"not yet", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})), errJWTNotYet},
+		{"wrong issuer", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"iss": "mallory"})), errJWTIssuer},
+		{"wrong audience", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"aud": "beets"})), errJWTAudience},
+		{"malformed", "not.a.jwt", errJWTMalformed},
+	} {
+		if _, err := j.Verify(test.token); err != test.err {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	set, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+			{"kty": "oct", "kid": "hs", "k": base64.RawURLEncoding.EncodeToString([]byte("sekrit"))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rsaKey.N), "e": "AQAB"},
+		},
+	})
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(path, set, 0600); err != nil {
+		t.Fatalf("Error writing JWKS file: %s", err)
+	}
+	fromFile, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatalf("Error loading JWKS file: %s", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(set)
+	}))
+	defer server.Close()
+	fromURL, err := FetchJWKS(server.URL)
+	if err != nil {
+		t.Fatalf("Error fetching JWKS: %s", err)
+	}
+
+	claims := map[string]interface{}{"sub": "jo"}
+	for name, jwks := range map[string]*JWKS{"file": fromFile, "url": fromURL} {
+		j := JWTAuth{JWKS: jwks}
+		for _, token := range []string{
+			signJWT(t, "RS256", "rsa", rsaKey, claims),
+			signJWT(t, "ES256", "ec", ecKey, claims),
+			signJWT(t, "HS256", "hs", []byte("sekrit"), claims),
+		} {
+			if _, err := j.Verify(token); err != nil {
+				t.Errorf("JWKS from %s: expected token to verify, got %s", name, err)
+			}
+		}
+		if _, ok := jwks.Key("enc"); ok {
+			t.Errorf("JWKS from %s: expected encryption key to be skipped", name)
+		}
+	}
+
+	// an issuer that never answers is given up on
+	stall := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stall
+	}))
+	defer slow.Close()
+	defer close(stall)
+	timeout := jwksClient.Timeout
+	jwksClient.Timeout = 50 * time.Millisecond
+	defer func() { jwksClient.Timeout = timeout }()
+	if _, err := FetchJWKS(slow.URL); err == nil {
+		t.Errorf("Expected fetching from a stalled issuer to time out")
+	}
+
+	// and so is an oversized key set
+	maxSize := maxJWKSSize
+	maxJWKSSize = int64(len(set)) - 1
+	defer func() { maxJWKSSize = maxSize }()
+	if _, err := FetchJWKS(server.URL); err == nil {
+		t.Errorf("Expected fetching an oversized key set to fail")
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	secret := []byte("sekrit")
+	e := newFalseEndpoint("yams")
+	e.Authenticator = JWTAuth{Keys: map[string]interface{}{"": secret}}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		p := PrincipalFrom(r)
+		if p == nil || p.Name != "jo" {
+			t.Fatalf("Expected principal jo, got %+v", p)
+		}
+		if len(p.Scopes) != 2 || p.Scopes[0] != "yams:read" || p.Scopes[1] != "yams:write" {
+			t.Errorf("Expected scopes from scope claim, got %v", p.Scopes)
+		}
+		if len(p.Roles) != 1 || p.Roles[0] != "farmer" {
+			t.Errorf("Expected roles from roles claim, got %v", p.Roles)
+		}
+		if p.Claims["favorite"] != "garnet" {
+			t.Errorf("Expected claims to be exposed, got %v", p.Claims)
+		}
+		return nil, nil
+	}
+
+	token := signJWT(t, "HS256", "", secret, map[string]interface{}{
+		"sub":      "jo",
+		"scope":    "yams:read yams:write",
+		"roles":    []string{"farmer"},
+		"favorite": "garnet",
+	})
+	r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if w := serveAuth(e, r); w.Code != http.StatusOK {
+		t.Errorf("Valid JWT: expected http return code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	r, _ = http.NewRequest("GET", "http://example.com/yams/1", nil)
+	r.Header.Set("Authorization", "Bearer "+token+"x")
+	w := serveAuth(e, r)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("Tampered JWT: expected 401 with Bearer challenge, got %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
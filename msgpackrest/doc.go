@@ -0,0 +1,18 @@
+/*
+Package msgpackrest provides a bootstrapped MessagePack-REST service
+implementation for Go's net/http package, in the same way rest/jsonrest does
+for JSON. MessagePack is a compact binary format suited to traffic between
+services, where JSON costs CPU and bandwidth for no benefit.
+
+	e := msgpackrest.NewEndpoint("yams")
+	http.Handle("/", e.Handler())
+
+The encoder is built in, so there is nothing else to install. Structs are
+encoded as maps keyed by field name and honor the same json tags as
+encoding/json, so one type can serve both a JSON and a MessagePack endpoint.
+Set Options.Deterministic when equal values must encode to equal bytes, for
+instance when responses are hashed or signed:
+
+	e.Codec = msgpackrest.NewCodec(msgpackrest.Options{Deterministic: true})
+*/
+package msgpackrest
@@ -0,0 +1,427 @@
+package msgpackrest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"time"
+
+	"rest"
+	"rest/internal/tagcodec"
+)
+
+// MediaType is the content type of MessagePack bodies.
+const MediaType = "application/msgpack"
+
+// maxDepth bounds the nesting of decoded arrays and maps.
+const maxDepth = 1000
+
+var (
+	errTruncated = errors.New("msgpackrest: unexpected end of data")
+	errTooDeep   = errors.New("msgpackrest: nesting too deep")
+)
+
+// Codec is a REST codec set up for MessagePack requests and responses. By
+// default it only allows request bodies of up to a megabyte.
+var Codec rest.Codec = NewCodec(Options{})
+
+func init() {
+	rest.RegisterCodec(Codec)
+}
+
+// Options control how values are encoded.
+type Options struct {
+	// Deterministic sorts map entries by their encoded keys, so that equal
+	// values always encode to the same bytes. Struct fields always come out
+	// in declaration order.
+	Deterministic bool
+}
+
+// Marshal returns the MessagePack encoding of v. Structs become maps keyed
+// by field name, honoring json tags as encoding/json does, and values
+// implementing encoding.TextMarshaler (such as time.Time) become strings.
+func Marshal(v interface{}) ([]byte, error) {
+	return Options{}.Marshal(v)
+}
+
+// Marshal returns the MessagePack encoding of v.
+func (o Options) Marshal(v interface{}) ([]byte, error) {
+	return tagcodec.Encode(writer{}, nil, reflect.ValueOf(v), o.Deterministic)
+}
+
+// Unmarshal decodes MessagePack data into the value v points to, matching
+// map keys to struct fields as encoding/json does.
+func Unmarshal(data []byte, v interface{}) error {
+	d := decoder{data: data}
+	src, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(data) {
+		return fmt.Errorf("msgpackrest: %d bytes of trailing data", len(data)-d.pos)
+	}
+	return tagcodec.Unmarshal(src, v)
+}
+
+// NewCodec returns a MessagePack codec encoding with the given options.
+func NewCodec(o Options) rest.Codec {
+	return rest.Codec{
+		Accepts:    MediaType,
+		MaxSize:    1 << 20, // 1 megabyte
+		Marshal:    o.Marshal,
+		Unmarshal:  Unmarshal,
+		SplitArray: splitArray,
+	}
+}
+
+// NewEndpoint returns a *rest.Endpoint configured to use MessagePack.
+func NewEndpoint(name string) *rest.Endpoint {
+	return &rest.Endpoint{
+		GetCollection:  rest.UnimplementedCollectionHandler,
+		PostCollection: rest.UnimplementedCollectionHandler,
+
+		Get:    rest.UnimplementedHandler,
+		Head:   rest.UnimplementedHandler,
+		Put:    rest.UnimplementedHandler,
+		Post:   rest.UnimplementedHandler,
+		Delete: rest.UnimplementedHandler,
+
+		Codec:            Codec,
+		Name:             name,
+		StatusCodeLookup: map[error]int{},
+		Logger:           rest.IOLogger{Writer: os.Stdout},
+	}
+}
+
+// splitArray splits an encoded array into its encoded items.
+func splitArray(data []byte) ([][]byte, bool) {
+	d := decoder{data: data}
+	n, ok := d.arrayHeader()
+	if !ok || n > len(data)-d.pos {
+		return nil, false
+	}
+	items := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		start := d.pos
+		if _, err := d.value(1); err != nil {
+			return nil, false
+		}
+		items = append(items, data[start:d.pos])
+	}
+	return items, d.pos == len(data)
+}
+
+// writer implements tagcodec.Writer for MessagePack.
+type writer struct{}
+
+func (writer) AppendNil(b []byte) []byte { return append(b, 0xc0) }
+
+func (writer) AppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func (w writer) AppendInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return w.AppendUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+}
+
+func (writer) AppendUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 0x80:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+}
+
+func (writer) AppendFloat(b []byte, v float64, bits int) []byte {
+	if bits == 32 {
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(float32(v)))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+// appendLength appends a header for the str, bin, array and map families,
+// which use a fixed form below fixMax (if any) and then 8, 16 or 32 bit
+// lengths.
+func appendLength(b []byte, n int, fix byte, fixMax int, c8, c16, c32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case c8 != 0 && n <= math.MaxUint8:
+		return append(b, c8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, c16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, c32), uint32(n))
+}
+
+func (writer) AppendString(b []byte, v string) []byte {
+	return append(appendLength(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb), v...)
+}
+
+func (writer) AppendBytes(b []byte, v []byte) []byte {
+	return append(appendLength(b, len(v), 0, 0, 0xc4, 0xc5, 0xc6), v...)
+}
+
+func (writer) AppendArrayHeader(b []byte, n int) []byte {
+	return appendLength(b, n, 0x90, 16, 0, 0xdc, 0xdd)
+}
+
+func (writer) AppendMapHeader(b []byte, n int) []byte {
+	return appendLength(b, n, 0x80, 16, 0, 0xde, 0xdf)
+}
+
+// decoder parses MessagePack into tagcodec's generic values.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *decoder) arrayHeader() (int, bool) {
+	if d.pos >= len(d.data) {
+		return 0, false
+	}
+	c := d.data[d.pos]
+	d.pos++
+	var n uint64
+	var err error
+	switch {
+	case c&0xf0 == 0x90:
+		n = uint64(c & 0x0f)
+	case c == 0xdc:
+		n, err = d.uint(2)
+	case c == 0xdd:
+		n, err = d.uint(4)
+	default:
+		return 0, false
+	}
+	return int(n), err == nil
+}
+
+// length reads an n-byte length and checks that that many items of at least
+// one byte each could follow.
+func (d *decoder) length(n int) (int, error) {
+	l, err := d.uint(n)
+	if err != nil {
+		return 0, err
+	}
+	if l > uint64(len(d.data)-d.pos) {
+		return 0, errTruncated
+	}
+	return int(l), nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return d.dict(int(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// sign extend from the encoded width
+		shift := 64 - 8*uint(size)
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.next(n)
+		return append([]byte{}, raw...), err
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.dict(n, depth)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	}
+	return nil, fmt.Errorf("msgpackrest: invalid type byte 0x%02x", c)
+}
+
+func (d *decoder) str(n int) (interface{}, error) {
+	b, err := d.next(n)
+	return string(b), err
+}
+
+func (d *decoder) array(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, nil
+}
+
+func (d *decoder) dict(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	keys, values := make([]interface{}, n), make([]interface{}, n)
+	allStrings := true
+	for i := 0; i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.(string); !ok {
+			allStrings = false
+		}
+		keys[i], values[i] = k, v
+	}
+	if allStrings {
+		m := make(map[string]interface{}, n)
+		for i, k := range keys {
+			m[k.(string)] = values[i]
+		}
+		return m, nil
+	}
+	m := make(map[interface{}]interface{}, n)
+	for i, k := range keys {
+		if k != nil && !reflect.TypeOf(k).Comparable() {
+			return nil, fmt.Errorf("msgpackrest: unusable map key of type %T", k)
+		}
+		m[k] = values[i]
+	}
+	return m, nil
+}
+
+// ext decodes an extension value. Only the timestamp extension (type -1) is
+// understood.
+func (d *decoder) ext(n int) (interface{}, error) {
+	t, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(t[0]) != -1 {
+		return nil, fmt.Errorf("msgpackrest: unsupported extension type %d", int8(t[0]))
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&0x3ffffffff), int64(v>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(nsec)).UTC(), nil
+	}
+	return nil, errors.New("msgpackrest: malformed timestamp")
+}
@@ -0,0 +1,185 @@
+package msgpackrest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"time"
+
+	"rest"
+)
+
+type testT struct {
+	Yams     string            `json:"yams"`
+	HasYams  bool              `json:"has_yams"`
+	YamCount int               `json:"yam_count"`
+	Weight   float64           `json:"weight,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Notes    map[string]string `json:"notes,omitempty"`
+	Harvest  time.Time         `json:"harvest"`
+	Secret   string            `json:"-"`
+}
+
+func TestEncoding(t *testing.T) {
+	for _, test := range []struct {
+		v        interface{}
+		expected string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{0, "00"},
+		{127, "7f"},
+		{128, "cc80"},
+		{-1, "ff"},
+		{-33, "d0df"},
+		{-129, "d1ff7f"},
+		{70000, "ce00011170"},
+		{uint64(math.MaxUint64), "cfffffffffffffffff"},
+		{float32(1.5), "ca3fc00000"},
+		{1.5, "cb3ff8000000000000"},
+		{"yam", "a379616d"},
+		{strings.Repeat("y", 32), "d920" + strings.Repeat("79", 32)},
+		{[]byte{1, 2}, "c4020102"},
+		{[]int{1, 2}, "920102"},
+		{struct {
+			A int `json:"a"`
+			B int `json:"b,omitempty"`
+		}{A: 1}, "81a16101"},
+	} {
+		data, err := Marshal(test.v)
+		if err != nil {
+			t.Fatalf("Error marshaling %#v: %s", test.v, err)
+		}
+		if got := hex.EncodeToString(data); got != test.expected {
+			t.Errorf("%#v: expected %s, got %s", test.v, test.expected, got)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := testT{
+		Yams:     "YAMSYAMSYAMS",
+		HasYams:  true,
+		YamCount: -3,
+		Weight:   1.25,
+		Tags:     []string{"orange", "sweet"},
+		Notes:    map[string]string{"b": "2", "a": "1"},
+		Harvest:  time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC),
+		Secret:   "hidden",
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Error marshaling: %s", err)
+	}
+	var out testT
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatalf("Error unmarshaling: %s", err)
+	}
+	in.Secret = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Expected %+v, got %+v", in, out)
+	}
+
+	var generic map[string]interface{}
+	if err := Unmarshal(data, &generic); err != nil {
+		t.Fatalf("Error unmarshaling into a map: %s", err)
+	}
+	if generic["yams"] != "YAMSYAMSYAMS" || generic["yam_count"] != int64(-3) {
+		t.Errorf("Expected generic values, got %v", generic)
+	}
+
+	for _, bad := range []string{"", "92", "dc", "c1", "a3796", "c0c0"} {
+		data, _ := hex.DecodeString(bad)
+		var v interface{}
+		if err := Unmarshal(data, &v); err == nil {
+			t.Errorf("Expected error decoding %q", bad)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	m := map[string]int{}
+	for _, k := range strings.Split("the quick brown fox jumps over lazy dogs", " ") {
+		m[k] = len(k)
+	}
+	o := Options{Deterministic: true}
+	first, _ := o.Marshal(m)
+	for i := 0; i < 20; i++ {
+		if data, _ := o.Marshal(m); !bytes.Equal(data, first) {
+			t.Fatalf("Expected identical encodings, got %x and %x", first, data)
+		}
+	}
+	if data, _ := o.Marshal(map[string]int{"b": 2, "a": 1}); hex.EncodeToString(data) != "82a16101a16202" {
+		t.Errorf("Expected keys in order, got %x", data)
+	}
+}
+
+func TestNewEndpoint(t *testing.T) {
+	e := NewEndpoint("yams")
+	e.Model = testT{}
+	e.Post = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		yam := *rest.Decoded(r).(*testT)
+		yam.YamCount = strings.Count(yam.Yams, "YAMS")
+		yam.HasYams = yam.YamCount > 0
+		return yam, nil
+	}
+	handler := e.Handler()
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/yams/1", nil)
+	r.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("With invalid Accept: expected http return code %d, got %d", http.StatusNotAcceptable, w.Code)
+	}
+
+	data, _ := Marshal(testT{Yams: "YAMSYAMSYAMS"})
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "http://example.com/yams/1", bytes.NewReader(data))
+	r.Header.Set("Accept", MediaType)
+	r.Header.Set("Content-Type", MediaType)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("With a MessagePack body: expected http return code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Content-Type") != MediaType {
+		t.Errorf("Expected Content-Type %s, got %s", MediaType, w.Header().Get("Content-Type"))
+	}
+	var resp testT
+	if err := Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response body: %s", err)
+	}
+	if !resp.HasYams || resp.YamCount != 3 {
+		t.Errorf("Expected 3 yams, got %+v", resp)
+	}
+}
+
+func TestSplitArray(t *testing.T) {
+	data, _ := Marshal([]interface{}{testT{Yams: "a"}, 2, "three"})
+	items, ok := Codec.SplitArray(data)
+	if !ok || len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d (ok %t)", len(items), ok)
+	}
+	var first testT
+	if err := Unmarshal(items[0], &first); err != nil || first.Yams != "a" {
+		t.Errorf("Expected first item to decode, got %+v (%v)", first, err)
+	}
+	if data, _ := Marshal(testT{}); func() bool { _, ok := Codec.SplitArray(data); return ok }() {
+		t.Errorf("Expected a map not to split")
+	}
+	for _, data := range [][]byte{
+		{0xdc, 0xff, 0xff, 0xc0},
+		{0xdd, 0xff, 0xff, 0xff, 0xff, 0xc0},
+		{0x93, 0xc0},
+	} {
+		if _, ok := Codec.SplitArray(data); ok {
+			t.Errorf("Expected truncated array % x not to split", data)
+		}
+	}
+}
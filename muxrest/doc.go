@@ -0,0 +1,15 @@
+/*
+Package muxrest registers rest Endpoints on a Gorilla mux.Router, for
+applications that already route with github.com/gorilla/mux.
+
+The rest package itself only needs net/http. To keep using Gorilla, register
+an Endpoint through this package instead of calling e.Router:
+
+  r := mux.NewRouter()
+  muxrest.Router(jsonrest.NewEndpoint("yams"), r)
+  http.Handle("/", r)
+
+Path parameters matched by Gorilla are copied onto the request with
+SetPathValue, so handlers see the same id they would under http.ServeMux.
+*/
+package muxrest
@@ -0,0 +1,56 @@
+package muxrest
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"rest"
+)
+
+// Mux adapts a mux.Router to rest.Mux.
+type Mux struct {
+	Router *mux.Router
+}
+
+var wildcard = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\.\.\.\}`)
+
+// Handle registers handler for an http.ServeMux style pattern. A leading
+// method ("GET /yams") becomes a method matcher, "{name...}" wildcards match
+// the rest of the path and a trailing slash matches the whole subtree.
+func (m Mux) Handle(pattern string, handler http.Handler) {
+	var method string
+	if i := strings.Index(pattern, " "); i >= 0 {
+		method, pattern = pattern[:i], strings.TrimSpace(pattern[i+1:])
+	}
+	pattern = wildcard.ReplaceAllString(pattern, "{$1:.*}")
+
+	var route *mux.Route
+	if strings.HasSuffix(pattern, "/") {
+		route = m.Router.PathPrefix(pattern)
+	} else {
+		route = m.Router.Path(pattern)
+	}
+	if method == "GET" {
+		route = route.Methods("GET", "HEAD")
+	} else if method != "" {
+		route = route.Methods(method)
+	}
+	route.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range mux.Vars(r) {
+			r.SetPathValue(k, v)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// Router registers e on r, which is also returned. If the calling function
+// passes nil for r, Router will create a new mux.Router.
+func Router(e *rest.Endpoint, r *mux.Router) *mux.Router {
+	if r == nil {
+		r = mux.NewRouter()
+	}
+	e.Register(Mux{r})
+	return r
+}
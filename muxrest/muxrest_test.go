@@ -0,0 +1,64 @@
+package muxrest
+
+import (
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+	"rest"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRouter(t *testing.T) {
+	e := rest.NewEndpoint("yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if id != "sweetpotato" {
+			t.Errorf("Expected id sweetpotato, got %s", id)
+		}
+		return nil, nil
+	}
+	r := Router(e, nil)
+
+	for _, test := range []struct {
+		method, accept, url string
+		code                int
+	}{
+		{"GET", "text/plain", "http://example.com/yams/sweetpotato", http.StatusOK},
+		{"GET", "text/plain", "http://example.com/yams", http.StatusNotImplemented},
+		{"POST", "application/xml", "http://example.com/yams", http.StatusNotAcceptable},
+		{"PUT", "text/plain", "http://example.com/yams", http.StatusMethodNotAllowed},
+		{"TRACE", "text/plain", "http://example.com/yams/sweetpotato", http.StatusMethodNotAllowed},
+		{"GET", "text/plain", "http://example.com/beets", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.method, test.url, nil)
+		req.Header.Set("Accept", test.accept)
+		r.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s %s: expected http return code %d, got %d", test.method, test.url, test.code, w.Code)
+		}
+	}
+}
+
+func TestHandlePattern(t *testing.T) {
+	r := mux.NewRouter()
+	m := Mux{r}
+	m.Handle("GET /files/{path...}", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.PathValue("path")))
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com/files/a/b/c", nil)
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "a/b/c" {
+		t.Errorf("Expected wildcard path value a/b/c, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "http://example.com/files/a", nil)
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected POST not to match a GET pattern")
+	}
+}
@@ -0,0 +1,19 @@
+/*
+Package protorest provides a bootstrapped REST service implementation for
+Go's net/http package that speaks Protocol Buffers, in the same way
+rest/jsonrest does for JSON. It depends on google.golang.org/protobuf.
+
+	e := protorest.NewEndpoint("yams")
+	e.Model = &pb.Yam{}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return &pb.Yam{Id: id}, nil
+	}
+	http.Handle("/", e.Handler())
+
+Handlers return proto.Message values, and request bodies are decoded into a
+new message of the Model's type, which handlers fetch with rest.Decoded.
+Clients sending "Accept: application/x-protobuf" get the binary encoding;
+clients asking for "application/json" get the protobuf JSON mapping from the
+same Endpoint, and may post JSON bodies too.
+*/
+package protorest
@@ -0,0 +1,144 @@
+package protorest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"rest"
+)
+
+// MediaType is the content type of protobuf bodies.
+const MediaType = "application/x-protobuf"
+
+// ErrNotMessage is returned when a request body is decoded into a value
+// that is not a proto.Message.
+var ErrNotMessage error = errors.New("protorest: value is not a proto.Message")
+
+var (
+	// Codec is a REST codec set up for protobuf requests and responses. By
+	// default it only allows request bodies of up to a megabyte.
+	Codec rest.Codec = rest.Codec{
+		Accepts:   MediaType,
+		MaxSize:   1 << 20, // 1 megabyte
+		Marshal:   Marshal,
+		Unmarshal: Unmarshal,
+	}
+	// JSONCodec answers requests for JSON with the protobuf JSON mapping, so
+	// that one Endpoint can serve both. Unknown fields in request bodies are
+	// ignored, as encoding/json would.
+	JSONCodec rest.Codec = rest.Codec{
+		Accepts:    "application/json",
+		MaxSize:    1 << 20, // 1 megabyte
+		Marshal:    MarshalJSON,
+		Unmarshal:  UnmarshalJSON,
+		SplitArray: splitArray,
+	}
+)
+
+func init() {
+	rest.RegisterCodec(Codec)
+}
+
+// message returns v as a proto.Message. Other values, such as a
+// rest.ValidationFailure, are converted to a google.protobuf.Value through
+// their JSON encoding.
+func message(v interface{}) (proto.Message, error) {
+	if m, ok := v.(proto.Message); ok {
+		return m, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	value := &structpb.Value{}
+	if err := protojson.Unmarshal(data, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Marshal returns the protobuf encoding of v, which should be a
+// proto.Message. Collection handlers return a message with a repeated field,
+// since protobuf has no top-level arrays. A nil v encodes to an empty body.
+func Marshal(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	m, err := message(v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal decodes protobuf data into v, which must be a proto.Message.
+func Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotMessage
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// MarshalJSON returns the protobuf JSON encoding of v. Values that are not
+// messages are encoded with encoding/json.
+func MarshalJSON(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes JSON data into v using the protobuf JSON mapping if
+// v is a proto.Message, and encoding/json otherwise.
+func UnmarshalJSON(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// splitArray splits a JSON array into its raw elements.
+func splitArray(data []byte) ([][]byte, bool) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		return nil, false
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, false
+	}
+	split := make([][]byte, len(items))
+	for i, item := range items {
+		split[i] = item
+	}
+	return split, true
+}
+
+// NewEndpoint returns a *rest.Endpoint configured to use protobuf, falling
+// back to JSON for requests that ask for it. Set the Endpoint's Model to the
+// message type request bodies decode into, for instance &pb.Yam{}.
+func NewEndpoint(name string) *rest.Endpoint {
+	return &rest.Endpoint{
+		GetCollection:  rest.UnimplementedCollectionHandler,
+		PostCollection: rest.UnimplementedCollectionHandler,
+
+		Get:    rest.UnimplementedHandler,
+		Head:   rest.UnimplementedHandler,
+		Put:    rest.UnimplementedHandler,
+		Post:   rest.UnimplementedHandler,
+		Delete: rest.UnimplementedHandler,
+
+		Codec:            Codec,
+		Alternates:       []rest.Codec{JSONCodec},
+		Name:             name,
+		StatusCodeLookup: map[error]int{},
+		Logger:           rest.IOLogger{Writer: os.Stdout},
+	}
+}
@@ -0,0 +1,122 @@
+package protorest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"rest"
+)
+
+func TestMarshal(t *testing.T) {
+	data, err := Marshal(wrapperspb.String("YAMSYAMSYAMS"))
+	if err != nil {
+		t.Fatalf("Error marshaling: %s", err)
+	}
+	var s wrapperspb.StringValue
+	if err := Unmarshal(data, &s); err != nil || s.Value != "YAMSYAMSYAMS" {
+		t.Errorf("Expected YAMSYAMSYAMS, got %q (%v)", s.Value, err)
+	}
+
+	// other values are sent as a google.protobuf.Value
+	data, err = Marshal(rest.ValidationFailure{Errors: rest.ValidationErrors{{Field: "yams", Message: "is required"}}})
+	if err != nil {
+		t.Fatalf("Error marshaling a ValidationFailure: %s", err)
+	}
+	var v structpb.Value
+	if err := proto.Unmarshal(data, &v); err != nil {
+		t.Fatalf("Error unmarshaling a ValidationFailure: %s", err)
+	}
+	errs := v.GetStructValue().GetFields()["errors"].GetListValue().GetValues()
+	if len(errs) != 1 || errs[0].GetStructValue().GetFields()["field"].GetStringValue() != "yams" {
+		t.Errorf("Expected the field error, got %v", &v)
+	}
+
+	if data, err := Marshal(nil); err != nil || len(data) != 0 {
+		t.Errorf("Expected an empty body for nil, got %x (%v)", data, err)
+	}
+	var notMessage struct{}
+	if err := Unmarshal(nil, &notMessage); err != ErrNotMessage {
+		t.Errorf("Expected ErrNotMessage, got %v", err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := MarshalJSON(wrapperspb.Int64(3))
+	if err != nil || string(data) != `"3"` {
+		t.Errorf("Expected the protobuf JSON mapping, got %s (%v)", data, err)
+	}
+	data, err = MarshalJSON(map[string]int{"yams": 3})
+	if err != nil || string(data) != `{"yams":3}` {
+		t.Errorf("Expected plain JSON, got %s (%v)", data, err)
+	}
+	var s structpb.Struct
+	if err := UnmarshalJSON([]byte(`{"yams":"YAMS"}`), &s); err != nil || s.Fields["yams"].GetStringValue() != "YAMS" {
+		t.Errorf("Expected a decoded Struct, got %v (%v)", &s, err)
+	}
+}
+
+func TestNewEndpoint(t *testing.T) {
+	e := NewEndpoint("yams")
+	e.Model = &structpb.Struct{}
+	e.Post = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		in := rest.Decoded(r).(*structpb.Struct)
+		yams := in.Fields["yams"].GetStringValue()
+		return structpb.NewStruct(map[string]interface{}{"id": id, "yams": yams + yams})
+	}
+	handler := e.Handler()
+
+	post := func(accept, contentType string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "http://example.com/yams/1", bytes.NewReader(body))
+		r.Header.Set("Accept", accept)
+		r.Header.Set("Content-Type", contentType)
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	in, _ := structpb.NewStruct(map[string]interface{}{"yams": "YAMS"})
+	data, _ := proto.Marshal(in)
+	w := post(MediaType, MediaType, data)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != MediaType {
+		t.Fatalf("With protobuf: expected %d and %s, got %d and %s", http.StatusOK, MediaType, w.Code, w.Header().Get("Content-Type"))
+	}
+	var out structpb.Struct
+	if err := proto.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("Error decoding response: %s", err)
+	}
+	if out.Fields["yams"].GetStringValue() != "YAMSYAMS" || out.Fields["id"].GetStringValue() != "1" {
+		t.Errorf("Expected YAMSYAMS for 1, got %v", &out)
+	}
+
+	// a protobuf body with a JSON response
+	w = post("application/json", MediaType, data)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("With JSON: expected %d and application/json, got %d and %s", http.StatusOK, w.Code, w.Header().Get("Content-Type"))
+	}
+	var m map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil || m["yams"] != "YAMSYAMS" {
+		t.Errorf("Expected YAMSYAMS, got %s (%v)", w.Body.String(), err)
+	}
+
+	// and the other way around
+	w = post(MediaType, "application/json", []byte(`{"yams":"Y","extra":1}`))
+	out.Reset()
+	if err := proto.Unmarshal(w.Body.Bytes(), &out); err != nil || out.Fields["yams"].GetStringValue() != "YY" {
+		t.Errorf("Expected YY, got %v (%v)", &out, err)
+	}
+
+	if w := post("application/yams", MediaType, data); w.Code != http.StatusNotAcceptable {
+		t.Errorf("With invalid Accept: expected http return code %d, got %d", http.StatusNotAcceptable, w.Code)
+	}
+	if w := post(MediaType, MediaType, []byte{0xff}); w.Code != http.StatusBadRequest {
+		t.Errorf("With a corrupt body: expected http return code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
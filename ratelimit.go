@@ -0,0 +1,302 @@
+package rest
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrTooManyRequests is sent when a client has used up its rate limit. It
+// corresponds to http.StatusTooManyRequests.
+var ErrTooManyRequests error = errors.New("Too many requests")
+
+// errRateLimitUnset is returned by the stores for a limit or window that is
+// not positive, which no rate could be worked out from.
+var errRateLimitUnset = errors.New("rest: rate limit needs a positive limit and window")
+
+// RateLimitStatus is the outcome of counting one request against a limit.
+type RateLimitStatus struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the quota is fully restored.
+	Reset time.Duration
+	// RetryAfter is how long a denied client should wait before trying
+	// again.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts requests. Implementations must be safe for
+// concurrent use; a store shared between processes lets several servers
+// enforce one limit.
+type RateLimitStore interface {
+	// Take counts one request against key, allowing limit requests per
+	// window.
+	Take(key string, limit int, window time.Duration) (RateLimitStatus, error)
+}
+
+// KeyFunc picks the client a request is counted against.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP counts requests by the client's IP address, as seen in
+// r.RemoteAddr. Behind a proxy, wrap the handler in middleware that sets
+// RemoteAddr from a trusted forwarding header.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByPrincipal counts requests by authenticated caller, falling back to
+// the IP address for anonymous requests.
+func KeyByPrincipal(r *http.Request) string {
+	if p := PrincipalFrom(r); p != nil {
+		return "principal:" + p.Name
+	}
+	return "ip:" + KeyByIP(r)
+}
+
+// KeyByHeader counts requests by the value of a header such as
+// "X-API-Key", falling back to the IP address when it is absent.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(name); v != "" {
+			return "header:" + v
+		}
+		return "ip:" + KeyByIP(r)
+	}
+}
+
+// RateLimit allows Limit requests per Window for each client. A RateLimit
+// without a positive Limit and Window limits nothing.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+	// Key picks the client. If nil, KeyByIP is used. Requests are counted
+	// before their body is read, and so before authentication, unless Key is
+	// KeyByPrincipal; other Keys find no Principal on the request.
+	Key KeyFunc
+	// Store counts requests. If nil, a process-wide TokenBucketStore is
+	// used.
+	Store RateLimitStore
+}
+
+var defaultRateLimitStore = NewTokenBucketStore()
+
+// rateLimit returns the limit for action and the scope its counters are
+// kept under, or nil if the action is not limited.
+func (e *Endpoint) rateLimit(action Action) (*RateLimit, string) {
+	if rl, ok := e.MethodRateLimits[action]; ok {
+		return rl, e.Name + ":" + string(action)
+	}
+	return e.RateLimit, e.Name
+}
+
+// limitsByPrincipal reports whether the rate limit for action is kept per
+// authenticated caller, and so can only be applied after authentication.
+func (e *Endpoint) limitsByPrincipal(action Action) bool {
+	rl, _ := e.rateLimit(action)
+	return rl != nil && rl.Key != nil && reflect.ValueOf(rl.Key).Pointer() == reflect.ValueOf(KeyByPrincipal).Pointer()
+}
+
+// limit counts r against the endpoint's rate limit for action and sets the
+// RateLimit headers. Store failures are logged and the request let through.
+func (e *Endpoint) limit(w http.ResponseWriter, r *http.Request, action Action, log Logger) error {
+	rl, scope := e.rateLimit(action)
+	if rl == nil || rl.Limit <= 0 || rl.Window <= 0 {
+		return nil
+	}
+	key, store := rl.Key, rl.Store
+	if key == nil {
+		key = KeyByIP
+	}
+	if store == nil {
+		store = defaultRateLimitStore
+	}
+	status, err := store.Take(scope+"|"+key(r), rl.Limit, rl.Window)
+	if err != nil {
+		log.Errorf("Rate limit store failed: %s", err)
+		return nil
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(status.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(status.Reset)))
+	if !status.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(status.RetryAfter)))
+		return ErrTooManyRequests
+	}
+	return nil
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// sweepEvery is how many calls a memory store takes between sweeps of idle
+// counters.
+const sweepEvery = 1024
+
+// TokenBucketStore is an in-memory RateLimitStore. Each client has a bucket
+// of Limit tokens that refills evenly over Window, so short bursts up to the
+// limit are allowed.
+type TokenBucketStore struct {
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	calls   int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// NewTokenBucketStore returns an empty TokenBucketStore.
+func NewTokenBucketStore() *TokenBucketStore {
+	return &TokenBucketStore{buckets: map[string]*tokenBucket{}}
+}
+
+// Take implements RateLimitStore.
+func (s *TokenBucketStore) Take(key string, limit int, window time.Duration) (RateLimitStatus, error) {
+	if limit <= 0 || window <= 0 {
+		return RateLimitStatus{}, errRateLimitUnset
+	}
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets == nil {
+		s.buckets = map[string]*tokenBucket{}
+	}
+	s.sweep(now)
+
+	rate := float64(limit) / window.Seconds() // tokens per second
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit), last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	status := RateLimitStatus{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		status.Allowed = true
+	} else {
+		status.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	status.Remaining = int(b.tokens)
+	status.Reset = time.Duration((float64(limit) - b.tokens) / rate * float64(time.Second))
+	b.full = now.Add(status.Reset)
+	return status, nil
+}
+
+// sweep forgets buckets that have refilled completely. Callers hold s.mu.
+func (s *TokenBucketStore) sweep(now time.Time) {
+	if s.calls++; s.calls%sweepEvery != 0 {
+		return
+	}
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// SlidingWindowStore is an in-memory RateLimitStore that allows at most
+// Limit requests in any Window. It approximates the sliding window by
+// weighting the previous fixed window's count by how much of it still
+// overlaps the sliding one.
+type SlidingWindowStore struct {
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*slidingWindow
+	calls   int
+}
+
+type slidingWindow struct {
+	start         time.Time
+	previous, cur int
+	window        time.Duration
+}
+
+// NewSlidingWindowStore returns an empty SlidingWindowStore.
+func NewSlidingWindowStore() *SlidingWindowStore {
+	return &SlidingWindowStore{windows: map[string]*slidingWindow{}}
+}
+
+// Take implements RateLimitStore.
+func (s *SlidingWindowStore) Take(key string, limit int, window time.Duration) (RateLimitStatus, error) {
+	if limit <= 0 || window <= 0 {
+		return RateLimitStatus{}, errRateLimitUnset
+	}
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.windows == nil {
+		s.windows = map[string]*slidingWindow{}
+	}
+	s.sweep(now)
+
+	start := now.Truncate(window)
+	sw, ok := s.windows[key]
+	if !ok {
+		sw = &slidingWindow{start: start, window: window}
+		s.windows[key] = sw
+	}
+	switch elapsed := start.Sub(sw.start); {
+	case elapsed == window:
+		sw.previous, sw.cur = sw.cur, 0
+	case elapsed > window:
+		sw.previous, sw.cur = 0, 0
+	}
+	sw.start = start
+
+	overlap := 1 - float64(now.Sub(start))/float64(window)
+	used := int(math.Floor(float64(sw.previous)*overlap)) + sw.cur
+
+	status := RateLimitStatus{Limit: limit, Reset: start.Add(window).Sub(now)}
+	if used < limit {
+		sw.cur++
+		used++
+		status.Allowed = true
+	} else {
+		status.RetryAfter = status.Reset
+	}
+	if status.Remaining = limit - used; status.Remaining < 0 {
+		status.Remaining = 0
+	}
+	return status, nil
+}
+
+// sweep forgets counters whose windows have both passed. Callers hold s.mu.
+func (s *SlidingWindowStore) sweep(now time.Time) {
+	if s.calls++; s.calls%sweepEvery != 0 {
+		return
+	}
+	for key, sw := range s.windows {
+		if now.Sub(sw.start) >= 2*sw.window {
+			delete(s.windows, key)
+		}
+	}
+}
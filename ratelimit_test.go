@@ -0,0 +1,200 @@
+package rest
+
+import (
+	"testing"
+
+	"net/http"
+	"strings"
+	"time"
+)
+
+func TestTokenBucketStore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewTokenBucketStore()
+	s.Now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		status, _ := s.Take("jo", 3, 3*time.Second)
+		if !status.Allowed || status.Remaining != 2-i {
+			t.Fatalf("Request %d: expected allowed with %d remaining, got %+v", i, 2-i, status)
+		}
+	}
+	status, _ := s.Take("jo", 3, 3*time.Second)
+	if status.Allowed || status.RetryAfter != time.Second {
+		t.Errorf("Expected denial with 1s retry, got %+v", status)
+	}
+	if status, _ := s.Take("sam", 3, 3*time.Second); !status.Allowed {
+		t.Errorf("Expected separate bucket per key, got %+v", status)
+	}
+
+	now = now.Add(time.Second)
+	if status, _ := s.Take("jo", 3, 3*time.Second); !status.Allowed {
+		t.Errorf("Expected a token after refill, got %+v", status)
+	}
+}
+
+func TestSlidingWindowStore(t *testing.T) {
+	now := time.Unix(1699999980, 0) // on a minute boundary
+	s := NewSlidingWindowStore()
+	s.Now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		if status, _ := s.Take("jo", 4, time.Minute); !status.Allowed {
+			t.Fatalf("Request %d: expected allowed, got %+v", i, status)
+		}
+	}
+	status, _ := s.Take("jo", 4, time.Minute)
+	if status.Allowed || status.Remaining != 0 || status.RetryAfter != time.Minute {
+		t.Errorf("Expected denial until the window ends, got %+v", status)
+	}
+
+	// a quarter into the next window, three quarters of the old count remain
+	now = now.Add(75 * time.Second)
+	if status, _ := s.Take("jo", 4, time.Minute); !status.Allowed || status.Remaining != 0 {
+		t.Errorf("Expected one request allowed, got %+v", status)
+	}
+	if status, _ := s.Take("jo", 4, time.Minute); status.Allowed {
+		t.Errorf("Expected denial, got %+v", status)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if status, _ := s.Take("jo", 4, time.Minute); !status.Allowed || status.Remaining != 3 {
+		t.Errorf("Expected a fresh window, got %+v", status)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	e := newFalseEndpoint("yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.Delete = e.Get
+	e.RateLimit = &RateLimit{Limit: 2, Window: time.Minute, Store: NewTokenBucketStore()}
+	e.MethodRateLimits = map[Action]*RateLimit{ActionDelete: nil}
+
+	get := func(addr string) *http.Response {
+		r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+		r.RemoteAddr = addr
+		return serveAuth(e, r).Result()
+	}
+	for i, remaining := range []string{"1", "0"} {
+		resp := get("10.0.0.1:1234")
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Remaining") != remaining {
+			t.Errorf("Request %d: expected 200 with %s remaining, got %d %q", i, remaining,
+				resp.StatusCode, resp.Header.Get("RateLimit-Remaining"))
+		}
+	}
+	resp := get("10.0.0.1:5678")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected http return code %d, got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") != "30" || resp.Header.Get("RateLimit-Limit") != "2" {
+		t.Errorf("Expected Retry-After 30 and RateLimit-Limit 2, got %q and %q",
+			resp.Header.Get("Retry-After"), resp.Header.Get("RateLimit-Limit"))
+	}
+	if resp := get("10.0.0.2:1234"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Other client: expected http return code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	r, _ := http.NewRequest("DELETE", "http://example.com/yams/1", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	if w := serveAuth(e, r); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("Unlimited action: expected 200 without headers, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestRateLimitUnset(t *testing.T) {
+	for _, s := range []RateLimitStore{NewTokenBucketStore(), NewSlidingWindowStore()} {
+		for _, rl := range []RateLimit{{Limit: 2}, {Window: time.Minute}, {Limit: -1, Window: time.Minute}} {
+			if _, err := s.Take("jo", rl.Limit, rl.Window); err != errRateLimitUnset {
+				t.Errorf("%T with limit %d per %s: expected %v, got %v", s, rl.Limit, rl.Window, errRateLimitUnset, err)
+			}
+		}
+	}
+
+	e := newFalseEndpoint("yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.RateLimit = &RateLimit{Limit: 2, Store: NewTokenBucketStore()}
+	for i := 0; i < 3; i++ {
+		r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		if w := serveAuth(e, r); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("Request %d: expected 200 without headers, got %d %v", i, w.Code, w.Header())
+		}
+	}
+}
+
+func TestRateLimitByPrincipal(t *testing.T) {
+	e := newFalseEndpoint("yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.Authenticator = BearerAuth{Verify: func(token string) (*Principal, error) {
+		if token == "jo" || token == "sam" {
+			return &Principal{Name: token}, nil
+		}
+		return nil, ErrUnauthorized
+	}}
+	e.RateLimit = &RateLimit{Limit: 1, Window: time.Minute, Key: KeyByPrincipal, Store: NewSlidingWindowStore()}
+
+	for _, test := range []struct {
+		token string
+		code  int
+	}{
+		{"jo", http.StatusOK},
+		{"jo", http.StatusTooManyRequests},
+		{"sam", http.StatusOK},
+		{"mallory", http.StatusUnauthorized},
+		{"mallory", http.StatusTooManyRequests},
+	} {
+		r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("Authorization", "Bearer "+test.token)
+		if w := serveAuth(e, r); w.Code != test.code {
+			t.Errorf("As %s: expected http return code %d, got %d", test.token, test.code, w.Code)
+		}
+	}
+}
+
+// countingReader counts the reads of a request body.
+type countingReader struct {
+	*strings.Reader
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads++
+	return c.Reader.Read(p)
+}
+
+func TestRateLimitBeforeBody(t *testing.T) {
+	verified := 0
+	e := newFalseEndpoint("yams")
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.Authenticator = BearerAuth{Verify: func(token string) (*Principal, error) {
+		verified++
+		return &Principal{Name: token}, nil
+	}}
+	e.RateLimit = &RateLimit{Limit: 1, Window: time.Minute, Store: NewTokenBucketStore()}
+
+	for i, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		body := &countingReader{Reader: strings.NewReader("mashed")}
+		r, _ := http.NewRequest("PUT", "http://example.com/yams/1", body)
+		r.ContentLength = int64(body.Len())
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("Authorization", "Bearer jo")
+		if w := serveAuth(e, r); w.Code != code {
+			t.Errorf("Request %d: expected http return code %d, got %d", i, code, w.Code)
+		}
+		if code == http.StatusTooManyRequests && body.reads != 0 {
+			t.Errorf("Expected the limited request's body to be left unread, got %d reads", body.reads)
+		}
+	}
+	if verified != 1 {
+		t.Errorf("Expected only the allowed request to be authenticated, got %d", verified)
+	}
+}
@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"strings"
+	"sync"
+)
+
+// registry holds the codecs and aliases registered for the process.
+var registry = struct {
+	sync.RWMutex
+	codecs  map[string]Codec
+	aliases map[string]string
+}{
+	codecs: map[string]Codec{},
+	aliases: map[string]string{
+		"text/json":             "application/json",
+		"text/x-json":           "application/json",
+		"text/xml":              "application/xml",
+		"application/x-msgpack": "application/msgpack",
+		"application/protobuf":  "application/x-protobuf",
+		"text/x-csv":            "text/csv",
+	},
+}
+
+/*
+RegisterCodec makes c available to every Endpoint in the process under its
+media type, c.Accepts, replacing any codec registered for that type before.
+The codec packages register theirs when imported, so that
+
+	import _ "rest/jsonrest"
+
+	e := rest.NewEndpoint("yams")
+	e.MediaTypes = []string{"application/json"}
+
+has the endpoint answer in JSON. RegisterCodec is meant to be called from
+init functions; it panics if c has no media type.
+*/
+func RegisterCodec(c Codec) {
+	if c.Accepts == "" {
+		panic("rest: RegisterCodec with no media type")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	registry.codecs[strings.ToLower(c.Accepts)] = c
+}
+
+// RegisterAlias makes alias another name for mediaType, wherever media types
+// are matched: in Accept and Content-Type headers as well as in lookups. For
+// instance, "text/json" is registered as an alias for "application/json".
+func RegisterAlias(alias, mediaType string) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.aliases[strings.ToLower(alias)] = strings.ToLower(mediaType)
+}
+
+/*
+LookupCodec returns the codec registered for mediaType, following aliases.
+Failing that, a type with a structured syntax suffix gets the codec for the
+suffix's own type, so that "application/vnd.yams+json" finds the codec for
+"application/json", and "application/atom+xml" the one for
+"application/xml". The codec returned has its Accepts set to mediaType.
+*/
+func LookupCodec(mediaType string) (Codec, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t := strings.ToLower(mediaType)
+	c, ok := registry.codecs[t]
+	if !ok {
+		c, ok = registry.codecs[canonicalType(t)]
+	}
+	if s := suffixType(t); !ok && s != "" {
+		c, ok = registry.codecs[canonicalType(s)]
+	}
+	if ok {
+		c.Accepts = mediaType
+	}
+	return c, ok
+}
+
+// canonicalType returns the media type the lower-cased t is an alias for,
+// or t itself. The caller holds the registry lock.
+func canonicalType(t string) string {
+	if canonical, ok := registry.aliases[t]; ok {
+		return canonical
+	}
+	return t
+}
+
+// suffixType returns the media type named by the structured syntax suffix
+// of t, such as "application/json" for "application/hal+json", or the empty
+// string if t has no suffix.
+func suffixType(t string) string {
+	i := strings.LastIndex(t, "+")
+	if i < 0 || strings.Contains(t[i:], "/") {
+		return ""
+	}
+	return "application/" + t[i+1:]
+}
+
+// Media type matches, from worst to best.
+const (
+	noMatch = iota
+	anyMatch
+	rangeMatch
+	suffixMatch
+	aliasMatch
+	exactMatch
+)
+
+// mediaTypeMatch rates how well a codec for offered serves content of media
+// type t: exactly, through an alias, through the structured syntax suffix of
+// t, through a media range such as "text/*" or "*/*", or not at all.
+func mediaTypeMatch(t, offered string) int {
+	t, offered = strings.ToLower(t), strings.ToLower(offered)
+	if t == offered {
+		return exactMatch
+	}
+	if t == "*/*" {
+		return anyMatch
+	}
+	if strings.HasSuffix(t, "/*") && strings.HasPrefix(offered, t[:len(t)-1]) {
+		return rangeMatch
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	canonical := canonicalType(offered)
+	if canonicalType(t) == canonical {
+		return aliasMatch
+	}
+	if s := suffixType(t); s != "" && canonicalType(s) == canonical {
+		return suffixMatch
+	}
+	return noMatch
+}
+
+// codecs returns every codec the endpoint can use, in order of preference:
+// Codec, then Alternates, then those registered for MediaTypes.
+func (e *Endpoint) codecs() []*Codec {
+	codecs := make([]*Codec, 0, 1+len(e.Alternates)+len(e.MediaTypes))
+	codecs = append(codecs, &e.Codec)
+	for i := range e.Alternates {
+		codecs = append(codecs, &e.Alternates[i])
+	}
+	for _, t := range e.MediaTypes {
+		if c, ok := LookupCodec(t); ok {
+			codecs = append(codecs, &c)
+		}
+	}
+	return codecs
+}
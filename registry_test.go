@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Accepts:   "application/json",
+		MaxSize:   1 << 10,
+		Marshal:   json.Marshal,
+		Unmarshal: json.Unmarshal,
+	})
+}
+
+func TestLookupCodec(t *testing.T) {
+	for _, test := range []struct {
+		mediaType string
+		found     bool
+	}{
+		{"application/json", true},
+		{"Application/JSON", true},
+		{"text/json", true},
+		{"application/vnd.yams+json", true},
+		{"application/yams+xml", false},
+		{"application/yams", false},
+	} {
+		c, ok := LookupCodec(test.mediaType)
+		if ok != test.found {
+			t.Errorf("%s: expected found %v, got %v", test.mediaType, test.found, ok)
+			continue
+		}
+		if ok && (c.Accepts != test.mediaType || c.Marshal == nil) {
+			t.Errorf("%s: expected the JSON codec answering as %s, got %s", test.mediaType, test.mediaType, c.Accepts)
+		}
+	}
+
+	RegisterAlias("application/x-yams", "application/json")
+	if _, ok := LookupCodec("application/x-yams"); !ok {
+		t.Errorf("Expected a registered alias to be found")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected registering a codec with no media type to panic")
+		}
+	}()
+	RegisterCodec(Codec{})
+}
+
+func TestMediaTypeMatch(t *testing.T) {
+	for _, test := range []struct {
+		t, offered string
+		expected   int
+	}{
+		{"application/json", "application/json", exactMatch},
+		{"text/json", "application/json", aliasMatch},
+		{"application/json", "text/json", aliasMatch},
+		{"application/hal+json", "application/json", suffixMatch},
+		{"application/json", "application/hal+json", noMatch},
+		{"application/hal+json", "application/xml", noMatch},
+		{"application/*", "application/json", rangeMatch},
+		{"text/*", "application/json", noMatch},
+		{"*/*", "application/json", anyMatch},
+	} {
+		if got := mediaTypeMatch(test.t, test.offered); got != test.expected {
+			t.Errorf("%s for %s: expected %d, got %d", test.t, test.offered, test.expected, got)
+		}
+	}
+}
+
+func TestMediaTypes(t *testing.T) {
+	e := newFalseEndpoint("yams")
+	e.MediaTypes = []string{"application/vnd.yams+json", "application/json", "application/unregistered"}
+	e.Model = struct {
+		Yams string `json:"yams"`
+	}{}
+	e.Post = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return Decoded(r), nil
+	}
+	handler := e.Handler()
+
+	for _, test := range []struct {
+		accept, contentType, body string
+		code                      int
+		expectedType, expected    string
+	}{
+		{"application/json", "application/json", `{"yams":"y"}`, http.StatusOK, "application/json", `{"yams":"y"}`},
+		{"text/json", "text/json", `{"yams":"y"}`, http.StatusOK, "application/json", `{"yams":"y"}`},
+		{"application/vnd.yams+json", "", "", http.StatusOK, "application/vnd.yams+json", `{"yams":""}`},
+		// other +json types are answered in plain JSON
+		{"application/hal+json", "application/merge-patch+json", `{"yams":"y"}`, http.StatusOK, "application/json", `{"yams":"y"}`},
+		{"application/json;q=0, application/hal+json", "", "", http.StatusNotAcceptable, "", ""},
+		{"application/yams", "application/json", `{"yams":"y"}`, http.StatusOK, "application/yams", "YAMSYAMSYAMS"},
+		{"application/unregistered", "", "", http.StatusNotAcceptable, "", ""},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "http://example.com/yams/1", bytes.NewBufferString(test.body))
+		r.Header.Set("Accept", test.accept)
+		r.Header.Set("Content-Type", test.contentType)
+		handler.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Accept %q: expected http return code %d, got %d", test.accept, test.code, w.Code)
+			continue
+		}
+		if test.expectedType == "" {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.expectedType {
+			t.Errorf("Accept %q: expected Content-Type %s, got %s", test.accept, test.expectedType, ct)
+		}
+		if body := w.Body.String(); body != test.expected {
+			t.Errorf("Accept %q: expected body %s, got %s", test.accept, test.expected, body)
+		}
+	}
+}
+
+func TestAcceptRanges(t *testing.T) {
+	e := newFalseEndpoint("yams")
+	e.MediaTypes = []string{"application/json"}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	handler := e.Handler()
+
+	for _, test := range []struct {
+		accept       string
+		code         int
+		expectedType string
+	}{
+		{"*/*", http.StatusOK, "application/yams"},
+		{"application/*", http.StatusOK, "application/yams"},
+		{"", http.StatusOK, "application/yams"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", http.StatusOK, "application/yams"},
+		{"text/*", http.StatusNotAcceptable, ""},
+		// named types outrank ranges, whatever their order
+		{"*/*;q=0.5, application/json", http.StatusOK, "application/json"},
+		{"application/*, application/yams;q=0", http.StatusOK, "application/json"},
+		{"application/json;q=0, */*;q=0", http.StatusNotAcceptable, ""},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		handler.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Accept %q: expected http return code %d, got %d", test.accept, test.code, w.Code)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); test.expectedType != "" && ct != test.expectedType {
+			t.Errorf("Accept %q: expected Content-Type %s, got %s", test.accept, test.expectedType, ct)
+		}
+	}
+}
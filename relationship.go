@@ -0,0 +1,22 @@
+package rest
+
+// Relationship ties an object a handler returns to objects served by another
+// Endpoint, for hypermedia codecs such as rest/halrest and rest/jsonapirest
+// to link. Related objects are addressed by the Name of their Endpoint, which
+// should be registered beside the answering one, and by their ids.
+type Relationship struct {
+	// Name identifies the relationship within the object, such as "farmer".
+	Name string
+	// Endpoint is the Name of the Endpoint serving the related objects.
+	Endpoint string
+	// IDs holds the ids of the related objects.
+	IDs []string
+	// ToMany marks relationships that may hold any number of objects, so
+	// that they are listed as such even when they hold one or none.
+	ToMany bool
+}
+
+// Relater is implemented by objects that have relationships to others.
+type Relater interface {
+	Relationships() []Relationship
+}
@@ -1,14 +1,16 @@
 package rest
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-  "os"
-
-	"github.com/gorilla/mux"
+	"os"
+	"reflect"
+	"strconv"
 )
 
 // Logger is an App Engine-compatible logging interface.
@@ -74,14 +76,62 @@ type Codec struct {
 	// Marshal is the function the package will call to encode a returned object
 	// into a response body. For instance, jsonrest calls json.Marshal.
 	Marshal func(v interface{}) ([]byte, error)
+	// Unmarshal is the function the package will call to decode a request body
+	// into an Endpoint's Model. For instance, jsonrest calls json.Unmarshal. It
+	// may be nil if no Endpoint using the codec sets a Model. Its errors are
+	// answered with ErrBadRequest, unless the Endpoint's StatusCodeLookup
+	// maps them.
+	Unmarshal func(data []byte, v interface{}) error
+	// SplitArray, if not nil, splits a request body holding an array into
+	// its encoded items, reporting false for any other body. Endpoints with
+	// a Batch use it to take arrays posted to the collection.
+	SplitArray func(data []byte) ([][]byte, bool)
+	// ErrorBody, if not nil, builds the response body for a failed request
+	// whose handler returned no object, from the status code and the error.
+	// For instance, xmlrest answers with an <error> element.
+	ErrorBody func(statusCode int, err error) interface{}
+	// Stream, if not nil, encodes the successful responses to GET requests
+	// instead of Marshal, writing to the client as it goes so that large
+	// collections need not be held in memory. The writer implements
+	// http.Flusher for pushing out what has been written so far. Streamed
+	// responses have no Content-Length and are not kept in a ResponseCache.
+	Stream func(w io.Writer, v interface{}) error
+	// Header, if not nil, holds headers added to every successful response
+	// the codec encodes, such as a Content-Disposition.
+	Header http.Header
+	// Decode, if not nil, decodes request bodies into the Endpoint's Model
+	// instead of Unmarshal, reading r.Body itself as it arrives; reading
+	// past MaxSize fails with ErrRequestTooLarge. rest then leaves the body
+	// unread, so handlers get a nil body and may stream r.Body themselves
+	// if there is no Model. Bodies are still read in full first, up to
+	// MaxSize, for Authenticators that may check them, such as HMACAuth,
+	// and for requests fingerprinted by Idempotency. A ValidationErrors it
+	// returns is reported like one from Validate.
+	Decode func(r *http.Request, v interface{}) error
+	// Render, if not nil, encodes responses instead of Marshal, for codecs
+	// whose output depends on the request being answered, such as ones
+	// linking to other resources. Marshal may then be nil.
+	Render func(r *http.Request, v interface{}) ([]byte, error)
+}
+
+// marshal encodes v, the response to r, with Render if the codec has one,
+// or else with Marshal.
+func (c *Codec) marshal(r *http.Request, v interface{}) ([]byte, error) {
+	if c.Render != nil {
+		return c.Render(r, v)
+	}
+	return c.Marshal(v)
 }
 
 var (
 	// ErrNotImplemented is the error that stub REST handlers always return. It
 	// corresponds to http.StatusNotImplemented.
 	ErrNotImplemented error = errors.New("Method not implemented")
-  // ErrNotFound corresponds to http.StatusNotFound.
-  ErrNotFound error = errors.New("Not found")
+	// ErrNotFound corresponds to http.StatusNotFound.
+	ErrNotFound error = errors.New("Not found")
+	// ErrBadRequest is sent when a request body cannot be decoded into the
+	// Endpoint's Model. It corresponds to http.StatusBadRequest.
+	ErrBadRequest error = errors.New("Bad request")
 )
 
 /*
@@ -143,12 +193,22 @@ type Endpoint struct {
 	Delete Handler
 
 	Codec Codec
+	// Alternates lists more codecs the endpoint can answer in. Each request
+	// is answered with the codec its Accept header rates highest, Codec
+	// winning ties, and its body is decoded by the codec matching its
+	// Content-Type, if any, or else by the one answering.
+	Alternates []Codec
+	// MediaTypes names more media types the endpoint answers in and
+	// decodes, served by the codecs registered for them (see RegisterCodec
+	// and LookupCodec), after Codec and Alternates. Types with no codec
+	// registered are ignored.
+	MediaTypes []string
 	// Name will be used to set the HTTP URL handlers for this REST object. For
 	// instance, if Name is "yams", then Endpoint.Handler will return an http.Handler
 	// that responds to "/yams" for collection actions and "/yams/{id}" for object actions.
-  // the "id" URL parameter will be passed through to the relevant method handler,
-  // so for instance a request to /yams/sweetpotato will have "sweetpotato" in 
-  // the id argument.
+	// the "id" URL parameter will be passed through to the relevant method handler,
+	// so for instance a request to /yams/sweetpotato will have "sweetpotato" in
+	// the id argument.
 	Name string
 	// StatusCodeLookup maps error object to HTTP status codes.
 	// NB: if rest can't look up an error an Endpoint returns in this map, it will
@@ -157,191 +217,508 @@ type Endpoint struct {
 	StatusCodeLookup map[error]int
 	// Logger is the Logger object rest uses to record events in the REST lifecycle.
 	Logger Logger
-  
-  // If not nil, rest.Endpoint will call this method to get a logger for the
-  // specific request rather than use the default logger. Useful for App Engine apps.
-  RequestLogger func(r *http.Request) Logger
+
+	// If not nil, rest.Endpoint will call this method to get a logger for the
+	// specific request rather than use the default logger. Useful for App Engine apps.
+	RequestLogger func(r *http.Request) Logger
+
+	// Tracer receives a span for each request and for each of its phases.
+	// If nil, no spans are recorded.
+	Tracer Tracer
+
+	// Model, if not nil, is a value of the type POST and PUT bodies decode
+	// into, for instance Yam{}. rest then decodes each such body into a new
+	// value of that type using Codec.Unmarshal, and checks it with Validate
+	// before calling the handler. Bodies that fail to decode get 400 (Bad
+	// Request), and bodies that fail validation get 422 (Unprocessable
+	// Entity). Handlers can fetch the decoded value with Decoded.
+	Model interface{}
+
+	// Authenticator, if not nil, identifies the caller of every request
+	// before its handler runs. Requests it rejects get 401 (Unauthorized)
+	// along with its challenge. Handlers can fetch the caller with
+	// PrincipalFrom.
+	Authenticator Authenticator
+	// MethodAuthenticators overrides Authenticator for particular actions.
+	// An entry set to nil makes that action public.
+	MethodAuthenticators map[Action]Authenticator
+	// Policies holds authorization rules by action, checked after
+	// authentication. Callers a policy denies get 403 (Forbidden) before the
+	// handler runs.
+	Policies map[Action]Policy
+
+	// RateLimit, if not nil, limits how often each client may call the
+	// endpoint. Clients over the limit get 429 (Too Many Requests) with a
+	// Retry-After header.
+	RateLimit *RateLimit
+	// MethodRateLimits overrides RateLimit for particular actions, which
+	// are then counted separately. An entry set to nil leaves that action
+	// unlimited.
+	MethodRateLimits map[Action]*RateLimit
+
+	// Compression, if not nil, compresses responses for clients that accept
+	// it.
+	Compression *Compression
+
+	// CachePolicy, if not nil, sets the Cache-Control header of successful
+	// responses to GET and HEAD requests. MethodCachePolicies overrides it
+	// for particular actions; an entry set to nil sends no Cache-Control for
+	// that action.
+	CachePolicy         *CachePolicy
+	MethodCachePolicies map[Action]*CachePolicy
+	// Cache, if not nil, keeps responses to GET requests for reuse as the
+	// cache policy allows.
+	Cache *ResponseCache
+
+	// Idempotency, if not nil, lets clients retry POST requests safely by
+	// sending an Idempotency-Key header.
+	Idempotency *Idempotency
+
+	// Batch, if not nil, enables bulk creates, updates and deletes on the
+	// collection.
+	Batch *Batch
+
+	// Blobs marks the endpoint's objects as files, such as images, whose Get
+	// and Head handlers return a *Blob. Reads of them are then answered
+	// whatever the Accept header says, and failed ones are encoded by Codec.
+	Blobs bool
+}
+
+type decodedKey struct{}
+
+// Decoded returns a pointer to the value rest decoded the body of r into,
+// or nil if the Endpoint has no Model or the request is not a POST or PUT.
+func Decoded(r *http.Request) interface{} {
+	return r.Context().Value(decodedKey{})
+}
+
+// decode unmarshals data, the body of r, into a new value of the endpoint's
+// Model type and validates it. An empty body decodes to the zero value.
+// Codecs with a Decode function read r.Body instead, unless stream is false,
+// as for the items of a bulk request, which are each only in data.
+func (e *Endpoint) decode(r *http.Request, data []byte, stream bool) (interface{}, error) {
+	t := reflect.TypeOf(e.Model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if err := checkModelRules(t); err != nil {
+		return nil, err
+	}
+	v := reflect.New(t).Interface()
+	codec := e.requestCodec(r)
+	var err error
+	switch {
+	case codec.Decode != nil && stream:
+		err = codec.Decode(r, v)
+	case len(data) == 0:
+	case codec.Unmarshal == nil:
+		return nil, errors.New("rest: Endpoint has a Model but its Codec has no Unmarshal")
+	default:
+		err = codec.Unmarshal(data, v)
+	}
+	switch err.(type) {
+	case nil:
+	case ValidationErrors:
+		return nil, err
+	default:
+		// errors the Endpoint maps to a status of their own keep it
+		if _, ok := e.StatusCodeLookup[err]; !ok && err != ErrRequestTooLarge {
+			err = ErrBadRequest
+		}
+		return nil, err
+	}
+	return v, Validate(v)
+}
+
+// dispatch calls the handler for the request's method.
+func (e *Endpoint) dispatch(r *http.Request, id string, data []byte) (interface{}, error) {
+	if id == "" { // collection
+		switch r.Method {
+		case "GET":
+			return e.GetCollection(r, data)
+		case "POST":
+			return e.PostCollection(r, data)
+		}
+		return nil, ErrNotImplemented
+	}
+	// supported methods: HEAD, GET, POST, PUT, DELETE
+	switch r.Method {
+	case "HEAD":
+		return e.Head(r, id, data)
+	case "GET":
+		return e.Get(r, id, data)
+	case "POST":
+		return e.Post(r, id, data)
+	case "PUT":
+		return e.Put(r, id, data)
+	case "DELETE":
+		return e.Delete(r, id, data)
+	}
+	return nil, ErrNotImplemented
+}
+
+// statusCode returns the HTTP status code to send for err.
+func (e *Endpoint) statusCode(err error) int {
+	if _, ok := err.(ValidationErrors); ok {
+		return http.StatusUnprocessableEntity
+	}
+	switch err {
+	case nil:
+		return http.StatusOK
+	case ErrNotImplemented:
+		return http.StatusNotImplemented
+	}
+	if statusCode, ok := e.StatusCodeLookup[err]; ok {
+		return statusCode
+	}
+	if statusCode, ok := defaultStatusCodes[err]; ok {
+		return statusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// defaultStatusCodes holds the status codes for errors rest itself returns,
+// unless an Endpoint's StatusCodeLookup says otherwise.
+var defaultStatusCodes = map[error]int{
+	ErrBadRequest:      http.StatusBadRequest,
+	ErrRequestTooLarge: http.StatusRequestEntityTooLarge,
+	ErrUnauthorized:    http.StatusUnauthorized,
+	ErrForbidden:       http.StatusForbidden,
+
+	ErrTooManyRequests: http.StatusTooManyRequests,
+
+	ErrIdempotencyKeyReused:   http.StatusUnprocessableEntity,
+	ErrIdempotencyKeyInFlight: http.StatusConflict,
 }
 
 // NewEndpoint returns a initialized endpoint ready for use. Note that all requests
 // will return 501 (Not Implemented) until proper handlers are set.
 func NewEndpoint(name string) *Endpoint {
-  return &Endpoint{
-    GetCollection: UnimplementedCollectionHandler,
-    PostCollection: UnimplementedCollectionHandler,
-
-    Head: UnimplementedHandler,
-    Get: UnimplementedHandler,
-    Put: UnimplementedHandler,
-    Post: UnimplementedHandler,
-    Delete: UnimplementedHandler,
-
-    Name: name,
-    Codec: Codec {
-      Accepts: "text/plain",
-      MaxSize: 1<<10, // 1 megabyte
-      Marshal: func(v interface{}) ([]byte, error) {
-        return []byte(fmt.Sprintf("%+v", v)), nil
-      },
-    },
-    StatusCodeLookup: map[error]int{
-      ErrNotFound: http.StatusNotFound,
-    },
-    Logger: IOLogger{os.Stdout},
-  }
+	return &Endpoint{
+		GetCollection:  UnimplementedCollectionHandler,
+		PostCollection: UnimplementedCollectionHandler,
+
+		Head:   UnimplementedHandler,
+		Get:    UnimplementedHandler,
+		Put:    UnimplementedHandler,
+		Post:   UnimplementedHandler,
+		Delete: UnimplementedHandler,
+
+		Name: name,
+		Codec: Codec{
+			Accepts: "text/plain",
+			MaxSize: 1 << 10, // 1 megabyte
+			Marshal: func(v interface{}) ([]byte, error) {
+				return []byte(fmt.Sprintf("%+v", v)), nil
+			},
+		},
+		StatusCodeLookup: map[error]int{
+			ErrNotFound: http.StatusNotFound,
+		},
+		Logger: IOLogger{os.Stdout},
+	}
 }
 
 func (e *Endpoint) handlerGen() func(w http.ResponseWriter, r *http.Request) {
-  return func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
 		var (
 			rv   interface{}
 			data []byte
 			err  error
 
-      statusCode int
-      ok bool
-      log Logger
+			statusCode int
+			log        Logger
 		)
-    // get the logger
-    if e.RequestLogger != nil {
-      log = e.RequestLogger(r)
-    } else {
-      log = e.Logger
-    }
+		// get the logger
+		if e.RequestLogger != nil {
+			log = e.RequestLogger(r)
+		} else {
+			log = e.Logger
+		}
 
-		// we return the content type set by the codec
-		w.Header().Set("Content-Type", e.Codec.Accepts)
+		// start the request span, continuing the caller's trace if it sent one
+		tracer := e.Tracer
+		if tracer == nil {
+			tracer = NopTracer{}
+		}
+		parent, _ := ParseTraceparent(r.Header.Get("traceparent"))
+		span := tracer.Start(parent, "rest.request")
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("rest.endpoint", e.Name)
+		r = r.WithContext(ContextWithSpan(r.Context(), span))
+
+		// we return the content type set by the negotiated codec
+		codec, in := e.responseCodec(r), e.requestCodec(r)
+		w.Header().Set("Content-Type", codec.Accepts)
+		addVary(w.Header(), "Accept")
+		if e.Compression != nil && e.Compression.compressible(codec.Accepts) {
+			addVary(w.Header(), "Accept-Encoding")
+		}
 
-		// recover the object id (mux stashes it away for us)
-		id := mux.Vars(r)["id"]
+		// recover the object id (the router stashes it away for us)
+		id := r.PathValue("id")
 		if id != "" {
 			log.Debugf("id: %s", id)
+			span.SetAttribute("rest.id", id)
+		}
+
+		// count the client against the rate limit before reading anything
+		// it sent, unless the limit is kept per principal, which has to wait
+		// for authentication
+		action := actionFor(r, id)
+		byPrincipal := e.limitsByPrincipal(action)
+		var limitErr error
+		if !byPrincipal {
+			limitErr = e.limit(w, r, action, log)
 		}
 
 		// decode body phase
+		phase := tracer.Start(span.Context(), "rest.read")
 		// respect size limit
-		if r.ContentLength > e.Codec.MaxSize {
+		if r.ContentLength > in.MaxSize {
 			http.Error(w, "", http.StatusRequestEntityTooLarge)
-			log.Errorf("Request body too large: max %d bytes, was %d", e.Codec.MaxSize, r.ContentLength)
+			log.Errorf("Request body too large: max %d bytes, was %d", in.MaxSize, r.ContentLength)
+			phase.End()
+			span.SetAttribute("http.status_code", http.StatusRequestEntityTooLarge)
 			return
 		}
 
-		// slurp the data from the request
-		if r.ContentLength > 0 {
-			data, err = ioutil.ReadAll(r.Body)
+		// slurp the data from the request, decompressing it if need be; raw
+		// keeps the body as sent, which is what authenticators sign. Codecs
+		// that decode requests themselves read the body as it arrives,
+		// unless something must see it whole first, or it may hold the items
+		// of a bulk request. Limited clients' bodies are left unread.
+		var raw []byte
+		switch {
+		case limitErr != nil:
+		case in.Decode != nil && (e.buffersBody(action) || (e.Batch != nil && id == "" && in.Unmarshal != nil)):
+			if raw, data, err = e.readBody(r); err == nil {
+				r = r.WithContext(r.Context())
+				r.Body = ioutil.NopCloser(bytes.NewReader(data))
+				r.Header = r.Header.Clone()
+				r.Header.Del("Content-Encoding")
+			}
+		case in.Decode != nil:
+			r, err = e.streamBody(r)
+		case r.ContentLength > 0:
+			raw, data, err = e.readBody(r)
+		}
+		if err != nil {
+			code := http.StatusInternalServerError
+			switch err {
+			case ErrRequestTooLarge:
+				code = http.StatusRequestEntityTooLarge
+			case ErrUnsupportedEncoding:
+				code = http.StatusUnsupportedMediaType
+			case ErrBadRequest:
+				code = http.StatusBadRequest
+			}
+			http.Error(w, "", code)
+			log.Errorf("Error reading request body: %s", err)
+			phase.RecordError(err)
+			phase.End()
+			span.RecordError(err)
+			span.SetAttribute("http.status_code", code)
+			return
+		}
+		phase.SetAttribute("rest.body_size", len(data))
+		phase.End()
+
+		// authenticate and authorize the caller before the body is decoded or
+		// handled
+		var authenticator Authenticator
+		if limitErr == nil {
+			r, authenticator, err = e.authenticate(r, action, raw, log)
+		}
+		// failed logins count against limits kept per principal too
+		if byPrincipal {
+			limitErr = e.limit(w, r, action, log)
+		}
+		if limitErr != nil {
+			err = limitErr
+		}
+		if err == nil && !bulk(action, id) {
+			err = e.authorize(r, action, id)
+		}
+		if err != nil && authenticator != nil && e.statusCode(err) == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", authenticator.Challenge())
+		}
+
+		// serve repeated reads from the response cache, and give handlers a
+		// place to say when their object last changed
+		var cached *cachedResponse
+		if err == nil {
+			cached = e.cached(r, action)
+		}
+		r, meta := withResponseMeta(r)
+
+		// replay retried POSTs, and hold the key of a new one until its
+		// response is stored
+		var idem *idempotentRequest
+		if err == nil && cached == nil {
+			cached, idem, err = e.reserveIdempotent(w, r, action, data)
+		}
+		defer func() {
+			if idem != nil {
+				idem.store.Release(idem.key)
+			}
+		}()
+
+		// a bulk request runs the handler once per item
+		var (
+			items   []batchItem
+			batched bool
+		)
+		if err == nil && cached == nil {
+			items, batched, err = e.batchItems(r, id, data)
+		}
+
+		// decode and validate the body against the model, if there is one
+		if err == nil && cached == nil && !batched && e.Model != nil && (r.Method == "POST" || r.Method == "PUT") {
+			phase = tracer.Start(span.Context(), "rest.decode")
+			var model interface{}
+			model, err = e.decode(r, data, true)
+			if fieldErrs, ok := err.(ValidationErrors); ok {
+				rv = ValidationFailure{fieldErrs}
+			}
 			if err != nil {
-				http.Error(w, "", http.StatusInternalServerError)
-				log.Errorf("Error reading request body: %s", err)
-				return
+				phase.RecordError(err)
 			}
+			phase.End()
+			r = r.WithContext(context.WithValue(r.Context(), decodedKey{}, model))
 		}
-		if id == "" { // collection
-			switch r.Method {
-			case "GET":
-				rv, err = e.GetCollection(r, data)
-			case "POST":
-				rv, err = e.PostCollection(r, data)
-			default:
-				err = ErrNotImplemented
+
+		if err == nil && cached == nil {
+			phase = tracer.Start(span.Context(), "rest.handle")
+			if batched {
+				rv = e.runBatch(r, action, items)
+			} else {
+				rv, err = e.dispatch(r, id, data)
 			}
-		} else {
-			// supported methods: HEAD, GET, POST, PUT, DELETE
-			switch r.Method {
-			case "HEAD":
-				rv, err = e.Head(r, id, data)
-			case "GET":
-				rv, err = e.Get(r, id, data)
-			case "POST":
-				rv, err = e.Post(r, id, data)
-			case "PUT":
-				rv, err = e.Put(r, id, data)
-			case "DELETE":
-				rv, err = e.Delete(r, id, data)
-			default:
-				err = ErrNotImplemented
+			if err != nil {
+				phase.RecordError(err)
 			}
+			phase.End()
+		}
+
+		// files are sent as they are, with their own caching headers
+		if blob, ok := rv.(*Blob); ok && err == nil && cached == nil && (r.Method == "GET" || r.Method == "HEAD") {
+			e.cacheResponse(w, r, action, &cachedResponse{}, false)
+			phase = tracer.Start(span.Context(), "rest.write")
+			var n int
+			statusCode, n = writeBlob(w, r, blob)
+			span.SetAttribute("http.status_code", statusCode)
+			phase.SetAttribute("rest.body_size", n)
+			phase.End()
+			return
 		}
 
-		// marshal the returned object
-    data, marshalErr := e.Codec.Marshal(rv)
+		// marshal the returned object, or the codec's description of the
+		// error; successful reads may be streamed instead, once the headers
+		// are settled
+		if err != nil && rv == nil && codec.ErrorBody != nil {
+			rv = codec.ErrorBody(e.statusCode(err), err)
+		}
+		stream := codec.Stream != nil && err == nil && cached == nil && !batched && r.Method == "GET"
+		phase = tracer.Start(span.Context(), "rest.marshal")
+		var marshalErr error
+		if cached != nil {
+			data = cached.body
+		} else if !stream {
+			data, marshalErr = codec.marshal(r, collect(rv))
+		}
 		if marshalErr != nil {
 			http.Error(w, "", http.StatusInternalServerError)
 			log.Errorf("Error marshaling return value: %s", marshalErr)
+			phase.RecordError(marshalErr)
+			phase.End()
+			span.RecordError(marshalErr)
+			span.SetAttribute("http.status_code", http.StatusInternalServerError)
 			return
 		}
+		phase.End()
 
-    // write the marshaled object to w
-    switch(err) {
-    case nil:
-      statusCode = http.StatusOK
-    case ErrNotImplemented:
-      statusCode = http.StatusNotImplemented
-    default:
+		// write the marshaled object to w
+		statusCode = e.statusCode(err)
+		if batched && err == nil {
+			statusCode = http.StatusMultiStatus
+		}
+		if cached != nil {
+			statusCode = cached.status
+		}
+		if err != nil && err != ErrNotImplemented {
 			log.Errorf("Error returned during REST: id %s, method %s, error %s", id, r.Method, err)
-			statusCode, ok = e.StatusCodeLookup[err]
-			if !ok {
-				statusCode = http.StatusInternalServerError
+		}
+		if err != nil {
+			span.RecordError(err)
+		}
+		if idem != nil {
+			if idemErr := idem.complete(w, statusCode, data); idemErr != nil {
+				log.Errorf("Error storing idempotent response: %s", idemErr)
 			}
+			idem = nil
 		}
-    w.Header().Set("X-Handled-By", "github.com/goldibex/rest")
-		w.WriteHeader(statusCode)
-    w.Write(data)
-	}
-}
 
-func notAcceptableHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "", http.StatusNotAcceptable)
-}
+		// set caching headers, and skip the body if the client's copy is
+		// still good
+		if err == nil {
+			entry := cached
+			if entry == nil {
+				entry = &cachedResponse{status: statusCode, body: data, lastModified: meta.lastModified}
+			}
+			e.cacheResponse(w, r, action, entry, cached == nil && !stream)
+			if notModified(r, entry.lastModified) {
+				if stream {
+					discard(rv)
+				}
+				statusCode, data, stream = http.StatusNotModified, nil, false
+			}
+		}
+		span.SetAttribute("http.status_code", statusCode)
 
-func notAllowedHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "", http.StatusMethodNotAllowed)
-}
+		// the codec's own headers describe the bodies it encodes, not
+		// failures
+		if statusCode >= 200 && statusCode < 300 {
+			for k, v := range codec.Header {
+				w.Header()[k] = v
+			}
+		}
 
-// Router builds a Gorilla router that will handle requests RESTfully using the endpoint.
-// If the calling function passes nil for r, Router will create a new mux.Router.
-func (e *Endpoint) Router(r *mux.Router) *mux.Router {
-  if r == nil {
-		r = mux.NewRouter()
+		phase = tracer.Start(span.Context(), "rest.write")
+		if stream {
+			w.Header().Set("X-Handled-By", "github.com/goldibex/rest")
+			n, streamErr := e.writeStream(w, r, statusCode, codec, rv)
+			if streamErr != nil {
+				// the status has gone out already; all we can do is stop
+				log.Errorf("Error streaming response: %s", streamErr)
+				phase.RecordError(streamErr)
+				span.RecordError(streamErr)
+			}
+			phase.SetAttribute("rest.body_size", n)
+			phase.End()
+			return
+		}
+		data, compressErr := e.compress(w, r, statusCode, data)
+		if compressErr != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			log.Errorf("Error compressing response: %s", compressErr)
+			phase.RecordError(compressErr)
+			phase.End()
+			span.RecordError(compressErr)
+			span.SetAttribute("http.status_code", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Handled-By", "github.com/goldibex/rest")
+		if statusCode != http.StatusNotModified {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		w.WriteHeader(statusCode)
+		n, writeErr := w.Write(data)
+		if writeErr != nil {
+			phase.RecordError(writeErr)
+		}
+		phase.SetAttribute("rest.body_size", n)
+		phase.End()
 	}
-	eHandler := e.handlerGen()
-
-	// collection path
-	r.Path("/"+e.Name).
-		Methods("GET", "POST").
-		Headers("Accept", e.Codec.Accepts).
-		HandlerFunc(eHandler)
-
-	// collection path with wrong accept (triggers 406)
-	r.Path("/"+e.Name).
-		Methods("GET", "POST").
-		HandlerFunc(notAcceptableHandler)
-
-	// collection path with wrong method (triggers 405)
-	r.Path("/"+e.Name).
-		Methods("HEAD", "PUT", "DELETE", "OPTIONS", "TRACE", "CONNECT").
-		HandlerFunc(notAllowedHandler)
-
-	// object path
-  r.Path("/"+e.Name+"/{id:[A-Za-z0-9-]+}").
-		Methods("HEAD", "GET", "POST", "PUT", "DELETE").
-		Headers("Accept", e.Codec.Accepts).
-		HandlerFunc(eHandler)
-
-	// object path with wrong accept (triggers 406)
-  r.Path("/"+e.Name+"/{id:[A-Za-z0-9-]+}").
-		Methods("HEAD", "GET", "POST", "PUT", "DELETE").
-		HandlerFunc(notAcceptableHandler)
-
-	// object path with wrong method (triggers 405)
-  r.Path("/"+e.Name+"/{id:[A-Za-z0-9-]+}").
-		Methods("OPTIONS", "TRACE", "CONNECT").
-		HandlerFunc(notAllowedHandler)
-
-	return r
-}
-
-// Handler creates an http.Handler ready for use with the http package, in case
-// using the Gorilla mux package is undesirable.
-func (e *Endpoint) Handler() http.Handler {
-	return e.Router(nil)
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -151,3 +152,76 @@ func TestNewEndpoint(t *testing.T) {
     http.StatusNotImplemented, w.Code)
   }
 }
+
+func TestAlternates(t *testing.T) {
+	e := newFalseEndpoint("yams")
+	e.Alternates = []Codec{{
+		Accepts:   "application/json",
+		MaxSize:   1 << 4,
+		Marshal:   json.Marshal,
+		Unmarshal: json.Unmarshal,
+	}}
+	e.Model = struct {
+		Yams string `json:"yams"`
+	}{}
+	e.Post = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return Decoded(r), nil
+	}
+	handler := e.Handler()
+
+	for _, test := range []struct {
+		accept, contentType, body string
+		code                      int
+		expectedType, expected    string
+	}{
+		{"application/json", "application/json", `{"yams":"y"}`, http.StatusOK, "application/json", `{"yams":"y"}`},
+		{"application/yams;q=0.5, application/json", "", "", http.StatusOK, "application/json", `{"yams":""}`},
+		{"application/json, application/yams", "", "", http.StatusOK, "application/yams", "YAMSYAMSYAMS"},
+		// the body is decoded by the codec matching its type
+		{"application/yams", "application/json", `{"yams":"y"}`, http.StatusOK, "application/yams", "YAMSYAMSYAMS"},
+		{"application/yams", "application/json", `{"yams":`, http.StatusBadRequest, "", ""},
+		{"application/json", "application/json", `{"yams":"yamsyamsyams"}`, http.StatusRequestEntityTooLarge, "", ""},
+		{"text/plain", "", "", http.StatusNotAcceptable, "", ""},
+		{"application/json;q=0", "", "", http.StatusNotAcceptable, "", ""},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "http://example.com/yams/1", bytes.NewBufferString(test.body))
+		r.Header.Set("Accept", test.accept)
+		r.Header.Set("Content-Type", test.contentType)
+		handler.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Accept %q, Content-Type %q: expected http return code %d, got %d", test.accept, test.contentType, test.code, w.Code)
+			continue
+		}
+		if test.expectedType == "" {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.expectedType {
+			t.Errorf("Accept %q: expected Content-Type %s, got %s", test.accept, test.expectedType, ct)
+		}
+		if body := w.Body.String(); body != test.expected {
+			t.Errorf("Accept %q: expected body %s, got %s", test.accept, test.expected, body)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	e := newFalseEndpoint("yams")
+	e.Alternates = []Codec{{
+		Accepts: "text/html",
+		Render: func(r *http.Request, v interface{}) ([]byte, error) {
+			return []byte(r.Method + " " + r.URL.Path + " " + r.PathValue("id")), nil
+		},
+	}}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return "garnet", nil
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+	r.Header.Set("Accept", "text/html")
+	e.Handler().ServeHTTP(w, r)
+	if body := w.Body.String(); w.Code != http.StatusOK || body != "GET /yams/1 1" {
+		t.Errorf("Expected the request to be rendered, got %d %q", w.Code, body)
+	}
+}
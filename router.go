@@ -0,0 +1,188 @@
+package rest
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Mux is implemented by routers an Endpoint can register its paths on.
+// Patterns use http.ServeMux syntax, such as "/yams/{id}", and handlers read
+// path parameters with r.PathValue. *http.ServeMux implements Mux directly;
+// adapters for other routers (see rest/muxrest for Gorilla) translate the
+// pattern and call r.SetPathValue before invoking the handler.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// prefixMux registers every pattern under a common path prefix.
+type prefixMux struct {
+	Mux
+	prefix string
+}
+
+func (p prefixMux) Handle(pattern string, handler http.Handler) {
+	p.Mux.Handle(p.prefix+pattern, handler)
+}
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+var (
+	collectionMethods = []string{"GET", "POST"}
+	batchMethods      = []string{"GET", "POST", "PUT", "DELETE"}
+	objectMethods     = []string{"HEAD", "GET", "POST", "PUT", "DELETE"}
+)
+
+// Register adds the endpoint's collection path ("/Name") and object path
+// ("/Name/{id}") to m. An Endpoint with a Batch also takes PUT and DELETE on
+// its collection path.
+func (e *Endpoint) Register(m Mux) {
+	eHandler := e.handlerGen()
+
+	methods := collectionMethods
+	if e.Batch != nil {
+		methods = batchMethods
+	}
+	m.Handle("/"+e.Name, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.route(w, r, methods, eHandler)
+	}))
+	m.Handle("/"+e.Name+"/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !idPattern.MatchString(r.PathValue("id")) {
+			http.NotFound(w, r)
+			return
+		}
+		e.route(w, r, objectMethods, eHandler)
+	}))
+}
+
+// route answers 405 for methods outside allowed and 406 for requests that
+// accept none of the endpoint's codecs, other than reads of blobs, and
+// otherwise hands off to h.
+func (e *Endpoint) route(w http.ResponseWriter, r *http.Request, allowed []string, h http.HandlerFunc) {
+	if !containsString(allowed, r.Method) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	codec := e.negotiate(r.Header.Get("Accept"))
+	if codec == nil && e.Blobs && r.PathValue("id") != "" && (r.Method == "GET" || r.Method == "HEAD") {
+		// blobs come in their own media types
+		codec = &e.Codec
+	}
+	if codec == nil {
+		http.Error(w, "", http.StatusNotAcceptable)
+		return
+	}
+	if codec != &e.Codec {
+		r = r.WithContext(context.WithValue(r.Context(), codecKey{}, codec))
+	}
+	h(w, r)
+}
+
+type codecKey struct{}
+
+// negotiate returns the codec the Accept header rates highest, or nil if it
+// accepts none of them. Among codecs rated the same, the one matching the
+// accepted type most closely wins, and then Codec, the earlier Alternates and
+// the earlier MediaTypes. Codecs without a Marshal or Render function only
+// decode requests.
+func (e *Endpoint) negotiate(accept string) *Codec {
+	best, bestQ, bestMatch := (*Codec)(nil), 0.0, noMatch
+	for _, c := range e.codecs() {
+		if c.Marshal == nil && c.Render == nil {
+			continue
+		}
+		q, match := acceptQuality(accept, c.Accepts)
+		if q > bestQ || (q > 0 && q == bestQ && match > bestMatch) {
+			best, bestQ, bestMatch = c, q, match
+		}
+	}
+	return best
+}
+
+// responseCodec returns the codec negotiated for the response to r.
+func (e *Endpoint) responseCodec(r *http.Request) *Codec {
+	if c, ok := r.Context().Value(codecKey{}).(*Codec); ok {
+		return c
+	}
+	return &e.Codec
+}
+
+// requestCodec returns the codec to decode the body of r with: the one
+// matching its Content-Type most closely, or else the one answering it.
+func (e *Endpoint) requestCodec(r *http.Request) *Codec {
+	if len(e.Alternates) > 0 || len(e.MediaTypes) > 0 {
+		if t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+			best, bestMatch := (*Codec)(nil), noMatch
+			for _, c := range e.codecs() {
+				if match := mediaTypeMatch(t, c.Accepts); match > bestMatch {
+					best, bestMatch = c, match
+				}
+			}
+			if best != nil {
+				return best
+			}
+		}
+	}
+	return e.responseCodec(r)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptQuality returns the q value the Accept header gives mediaType, and
+// how closely the listed type matches it (see mediaTypeMatch), or zero for
+// both if it lists no match. The closest match decides the q value, so that
+// "application/json;q=0" refuses JSON even alongside types with a +json
+// suffix. Other parameters are ignored, a missing or malformed q value
+// counts as 1, and a missing Accept header accepts anything.
+func acceptQuality(accept, mediaType string) (float64, int) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+	best, bestMatch := 0.0, noMatch
+	for _, part := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		match := mediaTypeMatch(t, mediaType)
+		if match == noMatch || match < bestMatch {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+				q = f
+			}
+		}
+		if match > bestMatch || q > best {
+			best, bestMatch = q, match
+		}
+	}
+	return best, bestMatch
+}
+
+// Router registers the endpoint on m, which is also returned. If the calling
+// function passes nil for m, Router will create a new http.ServeMux.
+func (e *Endpoint) Router(m *http.ServeMux) *http.ServeMux {
+	if m == nil {
+		m = http.NewServeMux()
+	}
+	e.Register(m)
+	return m
+}
+
+// Handler creates an http.Handler ready for use with the http package.
+func (e *Endpoint) Handler() http.Handler {
+	return e.Router(nil)
+}
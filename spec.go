@@ -0,0 +1,476 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypeHints tells a Spec which Go types an Endpoint reads and writes, so that
+// it can describe request and response bodies. Either field may be nil, in
+// which case the body is described as an arbitrary value.
+type TypeHints struct {
+	// Request is a value of the type handlers expect as the body of PUT and
+	// POST requests, for instance Yam{}.
+	Request interface{}
+	// Response is a value of the type handlers return for a single object.
+	// GetCollection is described as returning a list of these.
+	Response interface{}
+}
+
+type specEndpoint struct {
+	endpoint *Endpoint
+	hints    TypeHints
+}
+
+// Spec builds an OpenAPI 3.1 document describing a set of Endpoints. Only
+// the REST methods an Endpoint actually implements are included; methods
+// still set to UnimplementedHandler or UnimplementedCollectionHandler are
+// left out. Each operation lists the failures its Endpoint may answer with:
+// those in StatusCodeLookup, and 401, 403, 422 and 429 where the Endpoint's
+// authentication, Policies, Model and rate limits apply.
+type Spec struct {
+	Title       string
+	Version     string
+	Description string
+	// Servers lists base URLs at which the API is served, e.g.
+	// "https://api.example.com".
+	Servers []string
+
+	endpoints []specEndpoint
+}
+
+// NewSpec returns an empty Spec with the given title and API version.
+func NewSpec(title, version string) *Spec {
+	return &Spec{Title: title, Version: version}
+}
+
+// Add registers an Endpoint with the Spec. hints may be nil.
+func (s *Spec) Add(e *Endpoint, hints *TypeHints) *Spec {
+	se := specEndpoint{endpoint: e}
+	if hints != nil {
+		se.hints = *hints
+	}
+	s.endpoints = append(s.endpoints, se)
+	return s
+}
+
+// Document returns the OpenAPI document as a tree of maps and slices, ready
+// to be encoded.
+func (s *Spec) Document() map[string]interface{} {
+	info := map[string]interface{}{
+		"title":   s.Title,
+		"version": s.Version,
+	}
+	if s.Description != "" {
+		info["description"] = s.Description
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info":    info,
+	}
+	if len(s.Servers) > 0 {
+		servers := []interface{}{}
+		for _, url := range s.Servers {
+			servers = append(servers, map[string]interface{}{"url": url})
+		}
+		doc["servers"] = servers
+	}
+
+	g := &schemaGen{names: map[reflect.Type]string{}, schemas: map[string]interface{}{}}
+	paths := map[string]interface{}{}
+	for _, se := range s.endpoints {
+		s.addPaths(paths, g, se)
+	}
+	doc["paths"] = paths
+	if len(g.schemas) > 0 {
+		doc["components"] = map[string]interface{}{"schemas": g.schemas}
+	}
+	return doc
+}
+
+// JSON returns the OpenAPI document encoded as JSON.
+func (s *Spec) JSON() ([]byte, error) {
+	return json.MarshalIndent(s.Document(), "", "  ")
+}
+
+// YAML returns the OpenAPI document encoded as YAML.
+func (s *Spec) YAML() ([]byte, error) {
+	var b bytes.Buffer
+	writeYAML(&b, s.Document(), 0)
+	return b.Bytes(), nil
+}
+
+// Handler returns an http.Handler that serves the document. It answers with
+// YAML if the request path ends in ".yaml" or ".yml" or the Accept header
+// asks for YAML, and with JSON otherwise.
+func (s *Spec) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			data []byte
+			err  error
+		)
+		if strings.HasSuffix(r.URL.Path, ".yaml") || strings.HasSuffix(r.URL.Path, ".yml") ||
+			strings.Contains(r.Header.Get("Accept"), "yaml") {
+			w.Header().Set("Content-Type", "application/yaml")
+			data, err = s.YAML()
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			data, err = s.JSON()
+		}
+		if err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	})
+}
+
+// Router registers the document on m at path, e.g. "/openapi.json", and
+// returns m. If the calling function passes nil for m, Router will create a
+// new http.ServeMux.
+func (s *Spec) Router(m *http.ServeMux, path string) *http.ServeMux {
+	if m == nil {
+		m = http.NewServeMux()
+	}
+	m.Handle("GET "+path, s.Handler())
+	return m
+}
+
+func isImplemented(f interface{}, stub interface{}) bool {
+	v := reflect.ValueOf(f)
+	if !v.IsValid() || v.IsNil() {
+		return false
+	}
+	return v.Pointer() != reflect.ValueOf(stub).Pointer()
+}
+
+func (s *Spec) addPaths(paths map[string]interface{}, g *schemaGen, se specEndpoint) {
+	e := se.endpoint
+	var request, response interface{} = map[string]interface{}{}, map[string]interface{}{}
+	if se.hints.Request != nil {
+		request = g.schema(reflect.TypeOf(se.hints.Request))
+	}
+	if se.hints.Response != nil {
+		response = g.schema(reflect.TypeOf(se.hints.Response))
+	}
+	list := map[string]interface{}{"type": "array", "items": response}
+
+	collection := map[string]interface{}{}
+	if isImplemented(e.GetCollection, UnimplementedCollectionHandler) {
+		collection["get"] = s.operation(e, ActionGetCollection, nil, list)
+	}
+	if isImplemented(e.PostCollection, UnimplementedCollectionHandler) {
+		collection["post"] = s.operation(e, ActionPostCollection, request, response)
+	}
+	if len(collection) > 0 {
+		paths["/"+e.Name] = collection
+	}
+
+	item := map[string]interface{}{}
+	for _, m := range []struct {
+		method  string
+		action  Action
+		handler Handler
+		body    bool
+	}{
+		{"head", ActionHead, e.Head, false},
+		{"get", ActionGet, e.Get, false},
+		{"put", ActionPut, e.Put, true},
+		{"post", ActionPost, e.Post, true},
+		{"delete", ActionDelete, e.Delete, false},
+	} {
+		if !isImplemented(m.handler, UnimplementedHandler) {
+			continue
+		}
+		var body interface{}
+		if m.body {
+			body = request
+		}
+		item[m.method] = s.operation(e, m.action, body, response)
+	}
+	if len(item) > 0 {
+		item["parameters"] = []interface{}{
+			map[string]interface{}{
+				"name":     "id",
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string", "pattern": "^[A-Za-z0-9-]+$"},
+			},
+		}
+		paths["/"+e.Name+"/{id}"] = item
+	}
+}
+
+// specContent describes schema in each of the endpoint's media types.
+func specContent(e *Endpoint, schema interface{}) map[string]interface{} {
+	content := map[string]interface{}{}
+	for _, c := range e.codecs() {
+		if c.Accepts != "" {
+			content[c.Accepts] = map[string]interface{}{"schema": schema}
+		}
+	}
+	return content
+}
+
+// operation describes action, listing the failures the Endpoint's own
+// configuration may answer it with.
+func (s *Spec) operation(e *Endpoint, action Action, request, response interface{}) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": e.Name + "." + strings.ToLower(string(action[:1])) + string(action[1:]),
+		"tags":        []interface{}{e.Name},
+	}
+	if request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"content": specContent(e, request),
+		}
+	}
+
+	ok := map[string]interface{}{"description": http.StatusText(http.StatusOK)}
+	// responses to HEAD have no body
+	if action != ActionHead {
+		ok["content"] = specContent(e, response)
+	}
+	responses := map[string]interface{}{
+		"200": ok,
+		"500": map[string]interface{}{"description": http.StatusText(http.StatusInternalServerError)},
+	}
+	failures := []int{}
+	if request != nil {
+		failures = append(failures, http.StatusRequestEntityTooLarge)
+	}
+	pol, hasPolicy := e.Policies[action]
+	if e.authenticator(action) != nil || (hasPolicy && !pol.Public) {
+		failures = append(failures, http.StatusUnauthorized)
+	}
+	if hasPolicy && !pol.Public {
+		failures = append(failures, http.StatusForbidden)
+	}
+	if e.Model != nil && request != nil {
+		failures = append(failures, http.StatusUnprocessableEntity)
+	}
+	if rl, _ := e.rateLimit(action); rl != nil && rl.Limit > 0 && rl.Window > 0 {
+		failures = append(failures, http.StatusTooManyRequests)
+	}
+	for _, code := range failures {
+		responses[strconv.Itoa(code)] = map[string]interface{}{"description": http.StatusText(code)}
+	}
+	// several errors may share one status code; describe them all
+	errs := map[int][]string{}
+	for err, code := range e.StatusCodeLookup {
+		if err == nil || code == http.StatusOK {
+			continue
+		}
+		errs[code] = append(errs[code], err.Error())
+	}
+	for code, messages := range errs {
+		sort.Strings(messages)
+		responses[strconv.Itoa(code)] = map[string]interface{}{"description": strings.Join(messages, "; ")}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// schemaGen converts Go types to JSON Schema. Named struct types are placed
+// in components/schemas and referenced, which also takes care of recursive
+// types.
+type schemaGen struct {
+	names   map[reflect.Type]string
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = t.Name()
+			for i := 2; g.schemas[name] != nil; i++ {
+				name = t.Name() + strconv.Itoa(i)
+			}
+			g.names[t] = name
+			// reserve the name before recursing so self references resolve
+			g.schemas[name] = map[string]interface{}{}
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []interface{}{}
+	g.fields(t, properties, &required)
+	obj := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+func (g *schemaGen) fields(t reflect.Type, properties map[string]interface{}, required *[]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitempty, skip := jsonFieldName(f)
+		if skip {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// embedded structs without a name of their own are flattened, as
+		// encoding/json does
+		if f.Anonymous && ft.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			g.fields(ft, properties, required)
+			continue
+		}
+		properties[name] = g.schema(f.Type)
+		if !omitempty && f.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// jsonFieldName returns the name encoding/json would use for f.
+func jsonFieldName(f reflect.StructField) (name string, omitempty, skip bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false, true
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name = f.Name
+	parts := strings.Split(tag, ",")
+	if parts[0] != "" {
+		name = parts[0]
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, false
+}
+
+var (
+	yamlPlain    = regexp.MustCompile(`^[A-Za-z_/$][A-Za-z0-9_./$-]*$`)
+	yamlReserved = map[string]bool{
+		"true": true, "false": true, "null": true, "yes": true, "no": true,
+		"on": true, "off": true, "y": true, "n": true, "~": true,
+	}
+)
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		if yamlPlain.MatchString(v) && !yamlReserved[strings.ToLower(v)] {
+			return v
+		}
+		quoted, _ := json.Marshal(v)
+		return string(quoted)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// writeYAML emits the block-style YAML form of a document built from maps,
+// slices and scalars. Map keys are sorted so the output is stable.
+func writeYAML(b *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b.WriteString(pad + yamlScalar(k) + ":")
+			writeYAMLValue(b, v[k], indent)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+				// put the first key of a map on the same line as its dash
+				var sub bytes.Buffer
+				writeYAML(&sub, m, indent+2)
+				b.WriteString(pad + "- ")
+				b.Write(sub.Bytes()[indent+2:])
+				continue
+			}
+			b.WriteString(pad + "-")
+			writeYAMLValue(b, item, indent)
+		}
+	default:
+		b.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+func writeYAMLValue(b *bytes.Buffer, v interface{}, indent int) {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		if len(c) == 0 {
+			b.WriteString(" {}\n")
+			return
+		}
+	case []interface{}:
+		if len(c) == 0 {
+			b.WriteString(" []\n")
+			return
+		}
+	default:
+		b.WriteString(" " + yamlScalar(v) + "\n")
+		return
+	}
+	b.WriteString("\n")
+	writeYAML(b, v, indent+2)
+}
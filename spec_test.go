@@ -0,0 +1,185 @@
+package rest
+
+import (
+	"testing"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+type specYam struct {
+	Name      string    `json:"name"`
+	Weight    float64   `json:"weight,omitempty"`
+	Harvested time.Time `json:"harvested"`
+	Parent    *specYam  `json:"parent,omitempty"`
+	secret    string
+}
+
+func newSpecEndpoint() *Endpoint {
+	e := NewEndpoint("yams")
+	e.Codec.Accepts = "application/yams"
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.Put = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	return e
+}
+
+func TestSpecDocument(t *testing.T) {
+	e := newSpecEndpoint()
+	s := NewSpec("Yams", "1.0").Add(e, &TypeHints{Request: specYam{}, Response: &specYam{}})
+
+	doc := s.Document()
+	paths := doc["paths"].(map[string]interface{})
+	collection, ok := paths["/yams"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected /yams path in spec")
+	}
+	if _, ok := collection["get"]; !ok {
+		t.Errorf("Expected GET on /yams")
+	}
+	if _, ok := collection["post"]; ok {
+		t.Errorf("Expected no POST on /yams, as PostCollection is not implemented")
+	}
+
+	item, ok := paths["/yams/{id}"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected /yams/{id} path in spec")
+	}
+	for _, method := range []string{"get", "put"} {
+		if _, ok := item[method]; !ok {
+			t.Errorf("Expected %s on /yams/{id}", method)
+		}
+	}
+	for _, method := range []string{"head", "post", "delete"} {
+		if _, ok := item[method]; ok {
+			t.Errorf("Expected no %s on /yams/{id}", method)
+		}
+	}
+
+	responses := item["get"].(map[string]interface{})["responses"].(map[string]interface{})
+	notFound, ok := responses["404"].(map[string]interface{})
+	if !ok || notFound["description"] != ErrNotFound.Error() {
+		t.Errorf("Expected 404 response described by ErrNotFound, got %v", responses["404"])
+	}
+	content := responses["200"].(map[string]interface{})["content"].(map[string]interface{})
+	if _, ok := content["application/yams"]; !ok {
+		t.Errorf("Expected response content keyed by codec media type, got %v", content)
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	yam, ok := schemas["specYam"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected specYam component schema, got %v", schemas)
+	}
+	properties := yam["properties"].(map[string]interface{})
+	for _, name := range []string{"name", "weight", "harvested", "parent"} {
+		if _, ok := properties[name]; !ok {
+			t.Errorf("Expected property %s in specYam schema", name)
+		}
+	}
+	if _, ok := properties["secret"]; ok {
+		t.Errorf("Expected unexported field to be left out of schema")
+	}
+	if ref := properties["parent"].(map[string]interface{})["$ref"]; ref != "#/components/schemas/specYam" {
+		t.Errorf("Expected recursive $ref for parent, got %v", ref)
+	}
+	required := yam["required"].([]interface{})
+	if len(required) != 2 || required[0] != "name" || required[1] != "harvested" {
+		t.Errorf("Expected name and harvested to be required, got %v", required)
+	}
+}
+
+func TestSpecResponses(t *testing.T) {
+	e := newSpecEndpoint()
+	e.Head = e.Get
+	e.Model = specYam{}
+	e.Authenticator = BearerAuth{Verify: func(token string) (*Principal, error) {
+		return &Principal{Name: token}, nil
+	}}
+	e.Policies = map[Action]Policy{
+		ActionGetCollection: {Public: true},
+		ActionPut:           {Roles: []string{"farmer"}},
+	}
+	e.RateLimit = &RateLimit{Limit: 10, Window: time.Minute}
+	e.MethodRateLimits = map[Action]*RateLimit{ActionGetCollection: nil}
+	paths := NewSpec("Yams", "1.0").Add(e, nil).Document()["paths"].(map[string]interface{})
+	item := paths["/yams/{id}"].(map[string]interface{})
+
+	for _, test := range []struct {
+		path, method string
+		expected     []string
+		unexpected   []string
+	}{
+		{"/yams", "get", nil, []string{"401", "403", "422", "429"}},
+		{"/yams/{id}", "get", []string{"401", "429"}, []string{"403", "413", "422"}},
+		{"/yams/{id}", "put", []string{"401", "403", "413", "422", "429"}, nil},
+	} {
+		op := paths[test.path].(map[string]interface{})[test.method].(map[string]interface{})
+		responses := op["responses"].(map[string]interface{})
+		for _, code := range test.expected {
+			if _, ok := responses[code]; !ok {
+				t.Errorf("Expected %s response for %s %s, got %v", code, test.method, test.path, responses)
+			}
+		}
+		for _, code := range test.unexpected {
+			if _, ok := responses[code]; ok {
+				t.Errorf("Expected no %s response for %s %s", code, test.method, test.path)
+			}
+		}
+	}
+
+	head := item["head"].(map[string]interface{})
+	if ok := head["responses"].(map[string]interface{})["200"].(map[string]interface{}); ok["content"] != nil {
+		t.Errorf("Expected no content for HEAD, got %v", ok["content"])
+	}
+	if id := head["operationId"]; id != "yams.head" {
+		t.Errorf("Expected operationId yams.head, got %v", id)
+	}
+}
+
+func TestSpecHandler(t *testing.T) {
+	s := NewSpec("Yams", "1.0").Add(newSpecEndpoint(), nil)
+	router := s.Router(nil, "/openapi.json")
+	s.Router(router, "/openapi.yaml")
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/openapi.json", nil)
+	router.ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", ct)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Expected valid JSON document, got error %s", err)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("Expected openapi 3.1.0, got %v", doc["openapi"])
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "http://example.com/openapi.yaml", nil)
+	router.ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "application/yaml" {
+		t.Errorf("Expected YAML content type, got %s", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		"openapi: \"3.1.0\"\n",
+		"  \"/yams/{id}\":\n",
+		"        \"200\":\n",
+		"      - in: path\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected YAML document to contain %q, got:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+)
+
+/*
+Each calls f with every item of v, which may be a slice, an array, a channel,
+or an iterator function of the kind range loops take:
+
+	func(yield func(item T) bool)
+
+so that collection handlers can hand over results as they are produced. A
+channel is read until it is closed, and an iterator is stopped as soon as f
+returns an error, which Each then returns. Byte slices are not sequences.
+Each reports false, without calling f, if v is not a sequence.
+
+Codecs with a Stream function use Each to write items as they arrive; other
+codecs get channels and iterators collected into a slice first. A channel's
+sender should watch the request's context, since a client that goes away
+stops the reading.
+*/
+func Each(v interface{}, f func(item interface{}) error) (bool, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return false, nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := f(rv.Index(i).Interface()); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	case reflect.Chan:
+		if rv.Type().ChanDir()&reflect.RecvDir == 0 {
+			return false, nil
+		}
+		for {
+			item, ok := rv.Recv()
+			if !ok {
+				return true, nil
+			}
+			if err := f(item.Interface()); err != nil {
+				return true, err
+			}
+		}
+	case reflect.Func:
+		if !isIterator(rv.Type()) || rv.IsNil() {
+			return false, nil
+		}
+		var err error
+		yield := reflect.MakeFunc(rv.Type().In(0), func(args []reflect.Value) []reflect.Value {
+			if err == nil {
+				err = f(args[0].Interface())
+			}
+			return []reflect.Value{reflect.ValueOf(err == nil)}
+		})
+		rv.Call([]reflect.Value{yield})
+		return true, err
+	}
+	return false, nil
+}
+
+// isIterator reports whether t is func(func(T) bool).
+func isIterator(t reflect.Type) bool {
+	if t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	y := t.In(0)
+	return y.Kind() == reflect.Func && y.NumIn() == 1 && y.NumOut() == 1 && y.Out(0).Kind() == reflect.Bool
+}
+
+// collect gathers the items of a channel or iterator into a slice, for
+// codecs that cannot stream. Other values are returned as they are.
+func collect(v interface{}) interface{} {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Chan, reflect.Func:
+	default:
+		return v
+	}
+	items := []interface{}{}
+	if ok, _ := Each(v, func(item interface{}) error {
+		items = append(items, item)
+		return nil
+	}); !ok {
+		return v
+	}
+	return items
+}
+
+// discard drains v in the background if it is a channel, so that a sender
+// blocked on it can finish once a response turns out not to need it.
+// Iterators need no such care, since they only run when called.
+func discard(v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Chan && rv.Type().ChanDir()&reflect.RecvDir != 0 && !rv.IsNil() {
+		go Each(v, func(interface{}) error { return nil })
+	}
+}
+
+// streamWriter is the writer a Codec's Stream function writes a response
+// to. It can flush through any compression.
+type streamWriter struct {
+	io.Writer
+	zw io.WriteCloser
+	rw http.ResponseWriter
+}
+
+// Flush implements http.Flusher, pushing out everything written so far.
+func (s *streamWriter) Flush() {
+	if f, ok := s.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(s.rw).Flush()
+}
+
+// countingWriter counts the bytes of a streamed response as sent.
+type countingWriter struct {
+	w io.Writer
+	n *int
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += n
+	return n, err
+}
+
+// writeStream writes the header for a streamed response and has the codec
+// encode v into the body, compressing it if the client accepts that. It
+// returns the number of bytes sent.
+func (e *Endpoint) writeStream(w http.ResponseWriter, r *http.Request, statusCode int, codec *Codec, v interface{}) (int, error) {
+	name := e.contentCoding(w, r, statusCode, -1)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(statusCode)
+
+	var n int
+	s := &streamWriter{Writer: countingWriter{w, &n}, rw: w}
+	if name != "" {
+		zw, err := encoder(name)(s.Writer)
+		if err != nil {
+			return 0, err
+		}
+		s.Writer, s.zw = zw, zw
+	}
+	err := codec.Stream(s, v)
+	if s.zw != nil {
+		if closeErr := s.zw.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"testing"
+
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+// newStreamEndpoint returns an Endpoint whose codec streams each string in
+// a []string as a line, and marshals anything else with %v.
+func newStreamEndpoint() *Endpoint {
+	e := NewEndpoint("yams")
+	e.Codec.Accepts = "text/plain"
+	e.Codec.Stream = func(w io.Writer, v interface{}) error {
+		for _, line := range v.([]string) {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+			w.(http.Flusher).Flush()
+		}
+		return nil
+	}
+	e.Codec.Header = http.Header{"Content-Disposition": {"attachment"}}
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return []string{"yams", "more yams"}, nil
+	}
+	return e
+}
+
+func serveStream(e *Endpoint, method string, header http.Header) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, "http://example.com/yams", nil)
+	r.Header.Set("Accept", "text/plain")
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestStream(t *testing.T) {
+	e := newStreamEndpoint()
+	w := serveStream(e, "GET", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected http return code %d, got %d", http.StatusOK, w.Code)
+	}
+	if body := w.Body.String(); body != "yams\nmore yams\n" {
+		t.Errorf("Expected the streamed lines, got %q", body)
+	}
+	if !w.Flushed {
+		t.Errorf("Expected the stream to be flushed")
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("Expected no Content-Length, got %s", cl)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != "attachment" {
+		t.Errorf("Expected the codec's Content-Disposition, got %q", cd)
+	}
+
+	// compression wraps the stream, whatever its size
+	e.Compression = &Compression{MinSize: 1 << 10}
+	w = serveStream(e, "GET", http.Header{"Accept-Encoding": {"gzip"}})
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip, got %q", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Error reading gzip stream: %s", err)
+	}
+	if body, _ := ioutil.ReadAll(zr); string(body) != "yams\nmore yams\n" {
+		t.Errorf("Expected the streamed lines, got %q", body)
+	}
+
+	// errors and writes are marshaled as usual
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return nil, ErrNotFound
+	}
+	w = serveStream(e, "GET", nil)
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Length") == "" {
+		t.Errorf("Expected a marshaled %d, got %d with Content-Length %q", http.StatusNotFound, w.Code, w.Header().Get("Content-Length"))
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != "" {
+		t.Errorf("Expected no Content-Disposition on a failure, got %q", cd)
+	}
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return "posted", nil
+	}
+	if w = serveStream(e, "POST", nil); w.Body.String() != "posted" {
+		t.Errorf("Expected a marshaled POST response, got %q", w.Body.String())
+	}
+}
+
+func TestStreamNotModified(t *testing.T) {
+	e := newStreamEndpoint()
+	modified := time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		SetLastModified(r, modified)
+		return []string{"yams"}, nil
+	}
+	e.CachePolicy = &CachePolicy{MaxAge: time.Minute}
+	e.Cache = NewResponseCache(10)
+
+	w := serveStream(e, "GET", http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected an empty %d, got %d with %q", http.StatusNotModified, w.Code, w.Body.String())
+	}
+	if w = serveStream(e, "GET", nil); w.Header().Get("Cache-Control") != "max-age=60" {
+		t.Errorf("Expected Cache-Control max-age=60, got %q", w.Header().Get("Cache-Control"))
+	}
+	// streamed responses are not kept
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return []string{"fresh yams"}, nil
+	}
+	if w = serveStream(e, "GET", nil); !strings.Contains(w.Body.String(), "fresh") {
+		t.Errorf("Expected a fresh response, got %q", w.Body.String())
+	}
+
+	// a channel left unread by a 304 is drained, so its sender finishes
+	done := make(chan struct{})
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		SetLastModified(r, modified)
+		c := make(chan string)
+		go func() {
+			defer close(done)
+			defer close(c)
+			for _, yam := range []string{"yams", "more yams", "even more yams"} {
+				c <- yam
+			}
+		}()
+		return c, nil
+	}
+	w = serveStream(e, "GET", http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected http return code %d, got %d", http.StatusNotModified, w.Code)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the channel's sender to finish")
+	}
+}
+
+func TestEach(t *testing.T) {
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+	iterator := func(yield func(int) bool) {
+		for i := 1; i <= 3; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	for _, v := range []interface{}{[]int{1, 2, 3}, [3]int{1, 2, 3}, ch, iterator} {
+		var got []interface{}
+		ok, err := Each(v, func(item interface{}) error {
+			got = append(got, item)
+			return nil
+		})
+		if !ok || err != nil || len(got) != 3 || got[2] != 3 {
+			t.Errorf("%T: expected 3 items, got %v (%t, %v)", v, got, ok, err)
+		}
+	}
+
+	// errors stop the iteration
+	calls := 0
+	_, err := Each(iterator, func(item interface{}) error {
+		calls++
+		return ErrNotFound
+	})
+	if err != ErrNotFound || calls != 1 {
+		t.Errorf("Expected to stop at the first error, got %d calls and %v", calls, err)
+	}
+
+	for _, v := range []interface{}{nil, 3, "yams", []byte("yams"), func() {}, map[string]int{}} {
+		if ok, _ := Each(v, func(interface{}) error { return nil }); ok {
+			t.Errorf("%T: expected not to be a sequence", v)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	e := NewEndpoint("yams")
+	e.GetCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		ch := make(chan string)
+		go func() {
+			defer close(ch)
+			for _, yam := range []string{"garnet", "jewel"} {
+				ch <- yam
+			}
+		}()
+		return ch, nil
+	}
+	w := serveStream(e, "GET", nil)
+	if w.Body.String() != "[garnet jewel]" {
+		t.Errorf("Expected the channel to be collected, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,231 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBadTraceparent is returned by ParseTraceparent when the header value is
+// not a well-formed W3C traceparent.
+var ErrBadTraceparent error = errors.New("Malformed traceparent header")
+
+// SpanContext identifies a span within a trace. It carries exactly the
+// information in a W3C traceparent header.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// IsValid reports whether both the trace id and the span id are non-zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Sampled reports whether the sampled flag is set.
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&0x01 != 0
+}
+
+// String formats the span context as a version 00 traceparent header value.
+func (sc SpanContext) String() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" +
+		hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a W3C traceparent header value such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, ErrBadTraceparent
+	}
+	// version 00 has exactly four fields; later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, ErrBadTraceparent
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrBadTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrBadTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrBadTraceparent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, ErrBadTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrBadTraceparent
+	}
+	return sc, nil
+}
+
+// NewSpanContext returns a fresh span context that is a child of parent. If
+// parent is not valid, a new trace id is generated and the span is sampled.
+func NewSpanContext(parent SpanContext) SpanContext {
+	sc := SpanContext{Flags: 0x01}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	return sc
+}
+
+// Span is a single timed operation within a trace.
+type Span interface {
+	// Context returns the identity of this span, for use as a parent.
+	Context() SpanContext
+	// SetAttribute records a key/value pair on the span.
+	SetAttribute(key string, value interface{})
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	// End finishes the span. Calls after the first have no effect.
+	End()
+}
+
+// Tracer starts spans. rest calls Start once per request for the
+// "rest.request" span, whose parent is taken from the incoming traceparent
+// header, and once for each of its phases: "rest.read", "rest.decode" (only
+// for Endpoints with a Model), "rest.handle", "rest.marshal" and "rest.write".
+type Tracer interface {
+	Start(parent SpanContext, name string) Span
+}
+
+// NopTracer is a Tracer whose spans do nothing. It is used when an Endpoint
+// has no Tracer set.
+type NopTracer struct{}
+
+// Start returns a span that records nothing. The span context is propagated
+// unchanged so that handlers still see the caller's trace.
+func (NopTracer) Start(parent SpanContext, name string) Span {
+	return nopSpan{parent}
+}
+
+type nopSpan struct {
+	sc SpanContext
+}
+
+func (s nopSpan) Context() SpanContext                       { return s.sc }
+func (s nopSpan) SetAttribute(key string, value interface{}) {}
+func (s nopSpan) RecordError(err error)                      {}
+func (s nopSpan) End()                                       {}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromRequest returns the "rest.request" span for r, so handlers can
+// start child spans of their own. It returns a no-op span if there is none.
+func SpanFromRequest(r *http.Request) Span {
+	if span, ok := r.Context().Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return nopSpan{}
+}
+
+// RecordedSpan is a finished span as kept by MemoryTracer.
+type RecordedSpan struct {
+	Name       string
+	Parent     SpanContext
+	Context    SpanContext
+	Attributes map[string]interface{}
+	Err        error
+	Start      time.Time
+	End        time.Time
+}
+
+// MemoryTracer is a Tracer that keeps every finished span in memory. It is
+// meant for tests and debugging, not for production use.
+type MemoryTracer struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// Start begins a new span that will be recorded when it ends.
+func (m *MemoryTracer) Start(parent SpanContext, name string) Span {
+	return &memorySpan{
+		tracer: m,
+		rec: RecordedSpan{
+			Name:       name,
+			Parent:     parent,
+			Context:    NewSpanContext(parent),
+			Attributes: map[string]interface{}{},
+			Start:      time.Now(),
+		},
+	}
+}
+
+// Spans returns the finished spans in the order they ended.
+func (m *MemoryTracer) Spans() []RecordedSpan {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RecordedSpan(nil), m.spans...)
+}
+
+// Reset discards all recorded spans.
+func (m *MemoryTracer) Reset() {
+	m.mu.Lock()
+	m.spans = nil
+	m.mu.Unlock()
+}
+
+type memorySpan struct {
+	tracer *MemoryTracer
+	mu     sync.Mutex
+	rec    RecordedSpan
+	ended  bool
+}
+
+func (s *memorySpan) Context() SpanContext {
+	return s.rec.Context
+}
+
+func (s *memorySpan) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	s.rec.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+func (s *memorySpan) RecordError(err error) {
+	s.mu.Lock()
+	s.rec.Err = err
+	s.mu.Unlock()
+}
+
+func (s *memorySpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.rec.End = time.Now()
+	// the span may still be written to after it ends, so keep a copy
+	rec := s.rec
+	rec.Attributes = make(map[string]interface{}, len(s.rec.Attributes))
+	for k, v := range s.rec.Attributes {
+		rec.Attributes[k] = v
+	}
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, rec)
+	s.tracer.mu.Unlock()
+}
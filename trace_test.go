@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"testing"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("Expected no error parsing traceparent, got %s", err)
+	}
+	if !sc.Sampled() {
+		t.Errorf("Expected span context to be sampled")
+	}
+	if s := sc.String(); s != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Expected round-tripped traceparent, got %s", s)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := ParseTraceparent(bad); err != ErrBadTraceparent {
+			t.Errorf("ParseTraceparent(%q): expected ErrBadTraceparent, got %v", bad, err)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &MemoryTracer{}
+	e := newFalseEndpoint("yams")
+	e.Tracer = tracer
+	errYams := errors.New("out of yams")
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if !SpanFromRequest(r).Context().IsValid() {
+			t.Errorf("Expected handler to see a valid request span")
+		}
+		return nil, errYams
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/yams/1", nil)
+	r.Header.Set("Accept", "application/yams")
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.Handler().ServeHTTP(w, r)
+
+	spans := tracer.Spans()
+	names := []string{"rest.read", "rest.handle", "rest.marshal", "rest.write", "rest.request"}
+	if len(spans) != len(names) {
+		t.Fatalf("Expected %d spans, got %d", len(names), len(spans))
+	}
+	root := spans[len(spans)-1]
+	for i, name := range names {
+		if spans[i].Name != name {
+			t.Errorf("Span %d: expected name %s, got %s", i, name, spans[i].Name)
+		}
+		if spans[i].Context.TraceID != root.Parent.TraceID {
+			t.Errorf("Span %s: expected trace id to be propagated from traceparent", spans[i].Name)
+		}
+		if name != "rest.request" && spans[i].Parent != root.Context {
+			t.Errorf("Span %s: expected parent to be the request span", spans[i].Name)
+		}
+	}
+	if root.Parent.String() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Expected request span parent to come from traceparent, got %s", root.Parent)
+	}
+	if root.Err != errYams || spans[1].Err != errYams {
+		t.Errorf("Expected handler error on request and handle spans, got %v and %v", root.Err, spans[1].Err)
+	}
+	if code := root.Attributes["http.status_code"]; code != http.StatusInternalServerError {
+		t.Errorf("Expected http.status_code attribute %d, got %v", http.StatusInternalServerError, code)
+	}
+	if id := root.Attributes["rest.id"]; id != "1" {
+		t.Errorf("Expected rest.id attribute 1, got %v", id)
+	}
+
+	// without a traceparent a new trace is started
+	tracer.Reset()
+	r.Header.Del("traceparent")
+	e.Handler().ServeHTTP(httptest.NewRecorder(), r)
+	spans = tracer.Spans()
+	if len(spans) != len(names) {
+		t.Fatalf("Expected %d spans, got %d", len(names), len(spans))
+	}
+	if root := spans[len(spans)-1]; root.Parent.IsValid() || !root.Context.IsValid() {
+		t.Errorf("Expected a new root trace, got parent %s and context %s", root.Parent, root.Context)
+	}
+}
+
+func TestMemorySpanEnded(t *testing.T) {
+	tracer := &MemoryTracer{}
+	span := tracer.Start(SpanContext{}, "yams")
+	span.SetAttribute("yams", 1)
+	span.End()
+	span.SetAttribute("yams", 2)
+	if got := tracer.Spans()[0].Attributes["yams"]; got != 1 {
+		t.Errorf("Expected the recorded attribute to stay 1, got %v", got)
+	}
+}
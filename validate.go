@@ -0,0 +1,361 @@
+package rest
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator is implemented by request models that check themselves beyond
+// what struct tags can express. If Validate returns ValidationErrors they are
+// reported field by field; any other error is reported against the whole
+// body.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes one invalid field of a request body. Field is the
+// field's path using its JSON names, such as "address.city" or "items[2]".
+type FieldError struct {
+	Field   string `json:"field" xml:"field,attr"`
+	Message string `json:"message" xml:",chardata"`
+}
+
+// ValidationErrors is returned by Validate when a value breaks one or more
+// rules. Requests that fail validation receive 422 Unprocessable Entity, with
+// a ValidationFailure encoded by the Endpoint's Codec as the body.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, fe := range v {
+		if fe.Field == "" {
+			messages[i] = fe.Message
+		} else {
+			messages[i] = fe.Field + " " + fe.Message
+		}
+	}
+	return "Validation failed: " + strings.Join(messages, "; ")
+}
+
+// ValidationFailure is the response body sent when validation fails.
+type ValidationFailure struct {
+	Errors ValidationErrors `json:"errors" xml:"error"`
+}
+
+/*
+Validate checks v, which should be a struct or a pointer to one, against the
+rules in its "validate" struct tags, and then calls its Validate method if it
+implements Validator. Nested structs and slices of structs are checked too.
+Rules are separated by commas:
+
+	required      the field must not be its zero value
+	min=N, max=N  bounds on numbers, and on the length of strings, slices and maps
+	enum=a|b|c    the field must be one of the listed values
+	email         the field must be a bare email address
+	regex=EXPR    the field must match EXPR; this rule must come last, as EXPR
+	              may itself contain commas
+
+Apart from required, rules are skipped for empty strings and nil pointers,
+so optional fields are only checked when they are present. An unknown rule is
+reported as an error on its field, and an Endpoint refuses to decode into a
+Model that has one. The values of maps are not checked.
+*/
+func Validate(v interface{}) error {
+	var errs ValidationErrors
+	validateValue(reflect.ValueOf(v), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+func validateValue(v reflect.Value, path string, errs *ValidationErrors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		validateStruct(v, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	default:
+		if v.IsValid() && v.CanInterface() && v.Type().Implements(validatorType) {
+			validateSelf(v.Interface().(Validator), path, errs)
+		}
+	}
+}
+
+func validateStruct(v reflect.Value, path string, errs *ValidationErrors) {
+	validateFields(v, path, errs)
+
+	// the method set of a pointer includes that of its value, so take the
+	// address where possible; values reached through unexported fields
+	// cannot be handed out at all
+	t := v.Type()
+	if v.CanAddr() && v.Addr().CanInterface() && v.Addr().Type().Implements(validatorType) {
+		validateSelf(v.Addr().Interface().(Validator), path, errs)
+	} else if v.CanInterface() && t.Implements(validatorType) {
+		validateSelf(v.Interface().(Validator), path, errs)
+	}
+}
+
+func validateFields(v reflect.Value, path string, errs *ValidationErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, skip := jsonFieldName(f)
+		if skip {
+			continue
+		}
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		fv := v.Field(i)
+		if tag := f.Tag.Get("validate"); tag != "" && tag != "-" {
+			for _, message := range checkRules(fv, tag) {
+				*errs = append(*errs, FieldError{fieldPath, message})
+			}
+		}
+		if f.Anonymous {
+			validateEmbedded(fv, path, errs)
+		} else {
+			validateValue(fv, fieldPath, errs)
+		}
+	}
+}
+
+// validateEmbedded checks the fields of an embedded struct. Its Validate
+// method, if any, is promoted, and so runs as the outer struct's.
+func validateEmbedded(v reflect.Value, path string, errs *ValidationErrors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		validateFields(v, path, errs)
+	}
+}
+
+func validateSelf(validator Validator, path string, errs *ValidationErrors) {
+	err := validator.Validate()
+	if err == nil {
+		return
+	}
+	if fieldErrs, ok := err.(ValidationErrors); ok {
+		for _, fe := range fieldErrs {
+			if path != "" {
+				if fe.Field == "" {
+					fe.Field = path
+				} else {
+					fe.Field = path + "." + fe.Field
+				}
+			}
+			*errs = append(*errs, fe)
+		}
+		return
+	}
+	*errs = append(*errs, FieldError{path, err.Error()})
+}
+
+// splitRules splits a validate tag into its rules.
+func splitRules(tag string) []string {
+	var rules []string
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func ruleName(rule string) (name, arg string) {
+	if i := strings.Index(rule, "="); i >= 0 {
+		return rule[:i], rule[i+1:]
+	}
+	return rule, ""
+}
+
+func checkRules(v reflect.Value, tag string) []string {
+	var messages []string
+	for _, rule := range splitRules(tag) {
+		name, arg := ruleName(rule)
+		if name == "required" {
+			if isEmptyValue(v) {
+				messages = append(messages, "is required")
+				// nothing else to check on a missing value
+				return messages
+			}
+			continue
+		}
+		if message := checkRule(v, name, arg); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+var knownRules = map[string]bool{
+	"required": true, "min": true, "max": true, "enum": true, "email": true, "regex": true,
+}
+
+var modelRules sync.Map // reflect.Type -> error
+
+// checkModelRules returns an error naming the first unknown rule in the
+// validate tags of t and the types it holds, so that a misspelled rule does
+// not quietly switch validation off. The result is kept for each type.
+func checkModelRules(t reflect.Type) error {
+	if err, ok := modelRules.Load(t); ok {
+		err, _ := err.(error)
+		return err
+	}
+	err := findUnknownRule(t, map[reflect.Type]bool{})
+	modelRules.Store(t, err)
+	return err
+}
+
+func findUnknownRule(t reflect.Type, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, _, skip := jsonFieldName(f); skip {
+			continue
+		}
+		if tag := f.Tag.Get("validate"); tag != "" && tag != "-" {
+			for _, rule := range splitRules(tag) {
+				if name, _ := ruleName(rule); !knownRules[name] {
+					return fmt.Errorf("rest: unknown validate rule %q on %s.%s", name, t, f.Name)
+				}
+			}
+		}
+		if err := findUnknownRule(f.Type, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func checkRule(v reflect.Value, name, arg string) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String && v.Len() == 0 {
+		return ""
+	}
+
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return "has an invalid " + name + " rule"
+		}
+		var (
+			n    float64
+			unit string
+		)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			n = v.Float()
+		case reflect.String:
+			n, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+		case reflect.Slice, reflect.Map, reflect.Array:
+			n, unit = float64(v.Len()), " items"
+		default:
+			return ""
+		}
+		if name == "min" && n < limit {
+			return "must be at least " + arg + unit
+		}
+		if name == "max" && n > limit {
+			return "must be at most " + arg + unit
+		}
+	case "enum":
+		// fmt uses String methods where it may, and copes with values read
+		// through unexported fields
+		s := fmt.Sprint(v)
+		for _, option := range strings.Split(arg, "|") {
+			if s == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Replace(arg, "|", ", ", -1)
+	case "email":
+		if v.Kind() != reflect.String {
+			return ""
+		}
+		addr, err := mail.ParseAddress(v.String())
+		if err != nil || addr.Address != v.String() {
+			return "must be a valid email address"
+		}
+	case "regex":
+		if v.Kind() != reflect.String {
+			return ""
+		}
+		re, err := compileRule(arg)
+		if err != nil {
+			return "has an invalid regex rule"
+		}
+		if !re.MatchString(v.String()) {
+			return "must match " + arg
+		}
+	default:
+		return "has an unknown " + name + " rule"
+	}
+	return ""
+}
+
+var ruleRegexps sync.Map
+
+func compileRule(expr string) (*regexp.Regexp, error) {
+	if re, ok := ruleRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	ruleRegexps.Store(expr, re)
+	return re, nil
+}
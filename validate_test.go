@@ -0,0 +1,230 @@
+package rest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+)
+
+type validAddress struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"regex=^[0-9]{5}(-[0-9]{4})?$"`
+}
+
+type validYam struct {
+	Name     string         `json:"name" validate:"required,min=2,max=10"`
+	Color    string         `json:"color,omitempty" validate:"enum=orange|purple|white"`
+	Weight   int            `json:"weight" validate:"min=1"`
+	Farmer   string         `json:"farmer" validate:"email"`
+	Address  validAddress   `json:"address"`
+	Previous []validAddress `json:"previous"`
+	Nickname *string        `json:"nickname" validate:"min=3"`
+}
+
+func (y *validYam) Validate() error {
+	if y.Color == "white" && y.Weight > 100 {
+		return ValidationErrors{{"weight", "is too heavy for a white yam"}}
+	}
+	return nil
+}
+
+func fieldMessages(err error) map[string]string {
+	messages := map[string]string{}
+	if fieldErrs, ok := err.(ValidationErrors); ok {
+		for _, fe := range fieldErrs {
+			messages[fe.Field] = fe.Message
+		}
+	}
+	return messages
+}
+
+func TestValidate(t *testing.T) {
+	valid := &validYam{
+		Name:    "Beauregard",
+		Color:   "orange",
+		Weight:  3,
+		Farmer:  "farmer@example.com",
+		Address: validAddress{City: "Raleigh", Zip: "27601"},
+	}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Expected valid yam to pass validation, got %s", err)
+	}
+
+	short := "x"
+	invalid := &validYam{
+		Name:     "Y",
+		Color:    "blue",
+		Farmer:   "Farmer Jo <jo@example.com>",
+		Address:  validAddress{Zip: "2760"},
+		Previous: []validAddress{{City: "Durham"}, {}},
+		Nickname: &short,
+	}
+	messages := fieldMessages(Validate(invalid))
+	for field, message := range map[string]string{
+		"name":             "must be at least 2 characters",
+		"color":            "must be one of orange, purple, white",
+		"weight":           "must be at least 1",
+		"farmer":           "must be a valid email address",
+		"address.city":     "is required",
+		"address.zip":      "must match ^[0-9]{5}(-[0-9]{4})?$",
+		"previous[1].city": "is required",
+		"nickname":         "must be at least 3 characters",
+	} {
+		if messages[field] != message {
+			t.Errorf("Field %s: expected message %q, got %q", field, message, messages[field])
+		}
+	}
+	if len(messages) != 8 {
+		t.Errorf("Expected 8 field errors, got %v", messages)
+	}
+
+	heavy := *valid
+	heavy.Color = "white"
+	heavy.Weight = 200
+	if messages := fieldMessages(Validate(&heavy)); messages["weight"] != "is too heavy for a white yam" {
+		t.Errorf("Expected Validate method to report weight, got %v", messages)
+	}
+}
+
+type Harvest struct {
+	Season string `json:"season"`
+}
+
+func (h Harvest) Validate() error {
+	if h.Season == "" {
+		return errors.New("needs a season")
+	}
+	return nil
+}
+
+type storage struct {
+	Cellar string `json:"cellar" validate:"required"`
+	Shelf  string `json:"shelf" validate:"enum=top|bottom"`
+}
+
+func (s *storage) Validate() error {
+	return errors.New("cellar is full")
+}
+
+func TestValidateEmbedded(t *testing.T) {
+	// the promoted Validate runs once, as the outer struct's
+	err := Validate(&struct{ Harvest }{})
+	if fieldErrs, ok := err.(ValidationErrors); !ok || len(fieldErrs) != 1 || fieldErrs[0].Message != "needs a season" {
+		t.Errorf("Expected a single error from the embedded validator, got %v", err)
+	}
+
+	// unexported embedded types are checked through the outer struct only
+	err = Validate(&struct {
+		storage
+		Name string `json:"name" validate:"required"`
+	}{storage: storage{Shelf: "middle"}})
+	messages := fieldMessages(err)
+	if len(err.(ValidationErrors)) != 4 || messages["cellar"] != "is required" || messages["shelf"] != "must be one of top, bottom" ||
+		messages["name"] != "is required" || messages[""] != "cellar is full" {
+		t.Errorf("Expected errors for cellar, shelf, name and the whole, got %v", err)
+	}
+	err = Validate(&struct{ inner storage }{})
+	if err != nil {
+		t.Errorf("Expected unexported fields to be skipped, got %v", err)
+	}
+}
+
+func TestValidateNonFieldError(t *testing.T) {
+	err := Validate(validatorFunc(func() error { return errors.New("no yams on Sundays") }))
+	fieldErrs, ok := err.(ValidationErrors)
+	if !ok || len(fieldErrs) != 1 || fieldErrs[0].Field != "" || fieldErrs[0].Message != "no yams on Sundays" {
+		t.Errorf("Expected a single error for the whole body, got %v", err)
+	}
+}
+
+type misspeltYam struct {
+	Name  string `json:"name" validate:"requried"`
+	Items []struct {
+		Count int `json:"count" validate:"mni=3"`
+	} `json:"items"`
+}
+
+func TestValidateUnknownRule(t *testing.T) {
+	err := Validate(misspeltYam{Name: "Beauregard"})
+	fieldErrs, ok := err.(ValidationErrors)
+	if !ok || len(fieldErrs) != 1 || fieldErrs[0].Field != "name" || fieldErrs[0].Message != "has an unknown requried rule" {
+		t.Errorf("Expected the unknown rule to be reported, got %v", err)
+	}
+
+	type nested struct {
+		Items []struct {
+			Count int `validate:"mni=3"`
+		}
+	}
+	if err := checkModelRules(reflect.TypeOf(nested{})); err == nil || !strings.Contains(err.Error(), `"mni"`) {
+		t.Errorf("Expected the nested unknown rule to be found, got %v", err)
+	}
+	if err := checkModelRules(reflect.TypeOf(validYam{})); err != nil {
+		t.Errorf("Expected no unknown rules, got %v", err)
+	}
+
+	// a Model with one fails every request, whatever its body
+	e := newFalseEndpoint("yams")
+	e.Codec.Unmarshal = json.Unmarshal
+	e.Model = misspeltYam{}
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		return nil, nil
+	}
+	e.Logger = IOLogger{ioutil.Discard}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/yams", bytes.NewBufferString(`{"name":"Beauregard"}`))
+	r.Header.Set("Accept", "application/yams")
+	e.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected http return code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+type validatorFunc func() error
+
+func (f validatorFunc) Validate() error { return f() }
+
+func TestModelValidation(t *testing.T) {
+	e := newFalseEndpoint("yams")
+	e.Codec.Marshal = json.Marshal
+	e.Codec.Unmarshal = json.Unmarshal
+	e.Model = validYam{}
+	e.PostCollection = func(r *http.Request, body []byte) (interface{}, error) {
+		yam, ok := Decoded(r).(*validYam)
+		if !ok || yam.Name != "Beauregard" {
+			t.Errorf("Expected decoded yam in handler, got %+v", Decoded(r))
+		}
+		return yam, nil
+	}
+
+	for _, test := range []struct {
+		body string
+		code int
+	}{
+		{`{"name":"Beauregard","weight":2,"address":{"city":"Raleigh"}}`, http.StatusOK},
+		{`{"name":"Y","weight":2,"address":{"city":"Raleigh"}}`, http.StatusUnprocessableEntity},
+		{`{"name":`, http.StatusBadRequest},
+		{``, http.StatusUnprocessableEntity},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "http://example.com/yams", bytes.NewBufferString(test.body))
+		r.Header.Set("Accept", "application/yams")
+		e.Handler().ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Body %q: expected http return code %d, got %d", test.body, test.code, w.Code)
+		}
+		if w.Code == http.StatusUnprocessableEntity {
+			var failure ValidationFailure
+			if err := json.Unmarshal(w.Body.Bytes(), &failure); err != nil || len(failure.Errors) == 0 {
+				t.Errorf("Body %q: expected field errors in response, got %s", test.body, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownVersion is sent, as the body of a 400 (Bad Request) or, under
+// VersionByMediaType, a 406 (Not Acceptable), when a request names a version
+// that has not been added to a Versions set.
+var ErrUnknownVersion error = errors.New("Unknown API version")
+
+// VersionScheme selects how a request names the version it wants.
+type VersionScheme int
+
+const (
+	// VersionByPath expects a path prefix such as "/v2/yams".
+	VersionByPath VersionScheme = iota
+	// VersionByHeader expects a request header such as "X-API-Version: 2".
+	VersionByHeader
+	// VersionByMediaType expects a parameter on the requested media type,
+	// such as "Accept: application/vnd.acme+json;version=2". The parameter
+	// is removed before the Endpoint matches the Accept header against its
+	// Codec.
+	VersionByMediaType
+)
+
+// Version is one implementation of a versioned resource.
+type Version struct {
+	Name     string
+	Endpoint *Endpoint
+	// Deprecation, if not zero, is the time from which the version is
+	// deprecated. Responses then carry a Deprecation header.
+	Deprecation time.Time
+	// Sunset, if not zero, is the time after which the version will stop
+	// being served. Responses then carry a Sunset header.
+	Sunset time.Time
+	// DeprecationLink, if set, is sent as a Link header with
+	// rel="deprecation", pointing at migration documentation.
+	DeprecationLink string
+
+	handler http.Handler
+}
+
+// Versions serves several Endpoints implementing different versions of the
+// same resource side by side. Endpoints added to a Versions set should all
+// share the same Name.
+type Versions struct {
+	Scheme VersionScheme
+	// Header is the request header naming the version under
+	// VersionByHeader. It defaults to "X-API-Version".
+	Header string
+	// Param is the media type parameter naming the version under
+	// VersionByMediaType. It defaults to "version".
+	Param string
+	// Default is the version served when a request names none. If empty, the
+	// most recently added version is served. It is not used by VersionByPath.
+	Default string
+
+	versions []*Version
+}
+
+// NewVersions returns an empty Versions set using scheme.
+func NewVersions(scheme VersionScheme) *Versions {
+	return &Versions{
+		Scheme: scheme,
+		Header: "X-API-Version",
+		Param:  "version",
+	}
+}
+
+// Add registers e as version name, e.g. "2", and returns the Version so that
+// deprecation details can be filled in.
+func (v *Versions) Add(name string, e *Endpoint) *Version {
+	version := &Version{Name: name, Endpoint: e}
+	v.versions = append(v.versions, version)
+	return version
+}
+
+func (v *Versions) lookup(name string) *Version {
+	name = strings.TrimPrefix(strings.ToLower(name), "v")
+	for _, version := range v.versions {
+		if strings.TrimPrefix(strings.ToLower(version.Name), "v") == name {
+			return version
+		}
+	}
+	return nil
+}
+
+func (v *Versions) fallback() *Version {
+	if v.Default != "" {
+		return v.lookup(v.Default)
+	}
+	if len(v.versions) == 0 {
+		return nil
+	}
+	return v.versions[len(v.versions)-1]
+}
+
+// Router registers every version on m, and returns m. If the calling
+// function passes nil for m, Router will create a new http.ServeMux.
+func (v *Versions) Router(m *http.ServeMux) *http.ServeMux {
+	if m == nil {
+		m = http.NewServeMux()
+	}
+	for _, version := range v.versions {
+		version.handler = version.withName(version.Endpoint.Handler())
+	}
+
+	if v.Scheme == VersionByPath {
+		for _, version := range v.versions {
+			prefix := "/v" + strings.TrimPrefix(version.Name, "v")
+			m.Handle(prefix+"/", version.wrap(http.StripPrefix(prefix, version.handler)))
+		}
+		return m
+	}
+
+	names := map[string]bool{}
+	for _, version := range v.versions {
+		if names[version.Endpoint.Name] {
+			continue
+		}
+		names[version.Endpoint.Name] = true
+		m.HandleFunc("/"+version.Endpoint.Name, v.dispatch)
+		m.HandleFunc("/"+version.Endpoint.Name+"/", v.dispatch)
+	}
+	return m
+}
+
+// Handler creates an http.Handler serving every version.
+func (v *Versions) Handler() http.Handler {
+	return v.Router(nil)
+}
+
+// dispatch picks the version named by a header or media type parameter.
+func (v *Versions) dispatch(w http.ResponseWriter, r *http.Request) {
+	var name string
+	switch v.Scheme {
+	case VersionByHeader:
+		w.Header().Add("Vary", v.Header)
+		name = r.Header.Get(v.Header)
+	case VersionByMediaType:
+		w.Header().Add("Vary", "Accept")
+		var accept string
+		name, accept = splitAcceptVersion(r.Header.Get("Accept"), v.Param)
+		if name != "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Accept", accept)
+		}
+	}
+
+	var version *Version
+	if name == "" {
+		version = v.fallback()
+	} else {
+		version = v.lookup(name)
+	}
+	if version == nil {
+		code := http.StatusBadRequest
+		if v.Scheme == VersionByMediaType {
+			code = http.StatusNotAcceptable
+		}
+		http.Error(w, ErrUnknownVersion.Error(), code)
+		return
+	}
+	version.wrap(version.handler).ServeHTTP(w, r)
+}
+
+type versionKey struct{}
+
+// withName records the version's name on every request h serves, so that
+// responses cached for one version are not served for another.
+func (version *Version) withName(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, version.Name)))
+	})
+}
+
+// versionFrom returns the name of the version serving r, if any.
+func versionFrom(r *http.Request) string {
+	name, _ := r.Context().Value(versionKey{}).(string)
+	return name
+}
+
+// wrap adds the version's deprecation headers to every response.
+func (version *Version) wrap(h http.Handler) http.Handler {
+	if version.Deprecation.IsZero() && version.Sunset.IsZero() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !version.Deprecation.IsZero() {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(version.Deprecation.Unix(), 10))
+		}
+		if !version.Sunset.IsZero() {
+			w.Header().Set("Sunset", version.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if version.DeprecationLink != "" {
+			w.Header().Add("Link", "<"+version.DeprecationLink+">; rel=\"deprecation\"")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// splitAcceptVersion finds the first media range in accept carrying param,
+// and returns its value along with that media range with param removed.
+func splitAcceptVersion(accept, param string) (version, stripped string) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		version, ok := params[param]
+		if !ok {
+			continue
+		}
+		delete(params, param)
+		// a q value only has meaning relative to other ranges
+		delete(params, "q")
+		return version, mime.FormatMediaType(mediaType, params)
+	}
+	return "", accept
+}
@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func newVersionedEndpoint(accepts, body string) *Endpoint {
+	e := newFalseEndpoint("yams")
+	e.Codec.Accepts = accepts
+	e.Codec.Marshal = func(v interface{}) ([]byte, error) {
+		return []byte(body), nil
+	}
+	e.Get = func(r *http.Request, id string, data []byte) (interface{}, error) {
+		return nil, nil
+	}
+	return e
+}
+
+func tryVersions(h http.Handler, url string, header map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestVersionByPath(t *testing.T) {
+	sunset := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	v := NewVersions(VersionByPath)
+	old := v.Add("1", newVersionedEndpoint("application/yams", "v1"))
+	old.Deprecation = time.Unix(1700000000, 0)
+	old.Sunset = sunset
+	v.Add("2", newVersionedEndpoint("application/yams", "v2"))
+	h := v.Handler()
+
+	accept := map[string]string{"Accept": "application/yams"}
+	w := tryVersions(h, "http://example.com/v1/yams/1", accept)
+	if w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Errorf("/v1: expected 200 from version 1, got %d %q", w.Code, w.Body.String())
+	}
+	if d := w.Header().Get("Deprecation"); d != "@1700000000" {
+		t.Errorf("/v1: expected Deprecation header @1700000000, got %q", d)
+	}
+	if s := w.Header().Get("Sunset"); s != sunset.Format(http.TimeFormat) {
+		t.Errorf("/v1: expected Sunset header, got %q", s)
+	}
+
+	w = tryVersions(h, "http://example.com/v2/yams/1", accept)
+	if w.Code != http.StatusOK || w.Body.String() != "v2" {
+		t.Errorf("/v2: expected 200 from version 2, got %d %q", w.Code, w.Body.String())
+	}
+	if d := w.Header().Get("Deprecation"); d != "" {
+		t.Errorf("/v2: expected no Deprecation header, got %q", d)
+	}
+
+	if w = tryVersions(h, "http://example.com/v3/yams/1", accept); w.Code != http.StatusNotFound {
+		t.Errorf("/v3: expected http return code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestVersionByHeader(t *testing.T) {
+	v := NewVersions(VersionByHeader)
+	v.Add("1", newVersionedEndpoint("application/yams", "v1"))
+	v.Add("2", newVersionedEndpoint("application/yams", "v2"))
+	h := v.Handler()
+
+	for _, test := range []struct {
+		version string
+		code    int
+		body    string
+	}{
+		{"1", http.StatusOK, "v1"},
+		{"v2", http.StatusOK, "v2"},
+		{"", http.StatusOK, "v2"},
+		{"3", http.StatusBadRequest, "Unknown API version\n"},
+	} {
+		header := map[string]string{"Accept": "application/yams"}
+		if test.version != "" {
+			header["X-API-Version"] = test.version
+		}
+		w := tryVersions(h, "http://example.com/yams/1", header)
+		if w.Code != test.code {
+			t.Errorf("Version %q: expected http return code %d, got %d", test.version, test.code, w.Code)
+		} else if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("Version %q: expected body %q, got %q", test.version, test.body, w.Body.String())
+		}
+		if vary := w.Header().Get("Vary"); vary != "X-API-Version" {
+			t.Errorf("Version %q: expected Vary X-API-Version, got %q", test.version, vary)
+		}
+	}
+}
+
+func TestVersionByMediaType(t *testing.T) {
+	v := NewVersions(VersionByMediaType)
+	v.Default = "1"
+	v.Add("1", newVersionedEndpoint("application/vnd.acme+yams", "v1"))
+	v.Add("2", newVersionedEndpoint("application/vnd.acme+yams", "v2"))
+	h := v.Handler()
+
+	for _, test := range []struct {
+		accept string
+		code   int
+		body   string
+	}{
+		{"application/vnd.acme+yams;version=2", http.StatusOK, "v2"},
+		{"text/html, application/vnd.acme+yams; version=1; q=0.9", http.StatusOK, "v1"},
+		{"application/vnd.acme+yams", http.StatusOK, "v1"},
+		{"application/vnd.acme+yams;version=9", http.StatusNotAcceptable, "Unknown API version\n"},
+	} {
+		w := tryVersions(h, "http://example.com/yams/1", map[string]string{"Accept": test.accept})
+		if w.Code != test.code {
+			t.Errorf("Accept %q: expected http return code %d, got %d", test.accept, test.code, w.Code)
+		} else if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("Accept %q: expected body %q, got %q", test.accept, test.body, w.Body.String())
+		}
+	}
+}
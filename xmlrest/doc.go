@@ -0,0 +1,26 @@
+/*
+Package xmlrest provides a bootstrapped XML-REST service implementation for Go's
+net/http package, in the same way rest/jsonrest does for JSON.
+
+	e := xmlrest.NewEndpoint("yams")
+	http.Handle("/", e.Handler())
+
+Objects returned by handlers are serialized with xml.Marshal, so struct tags
+control the element names. Go has no XML form for a bare slice, so a slice
+returned from, say, GetCollection is wrapped in a root element, "collection"
+by default. Use NewCodec to pick another name:
+
+	e.Codec = xmlrest.NewCodec("yams")
+
+Handlers returning nil get an empty root element, so every successful
+response is a well-formed document.
+
+Failed requests whose handler returned no object are answered with an error
+element:
+
+	<error status="404">Not found</error>
+
+For 5xx responses the message is the standard status text, so internal error
+messages do not leak to clients.
+*/
+package xmlrest
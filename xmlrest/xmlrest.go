@@ -0,0 +1,143 @@
+package xmlrest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"reflect"
+
+	"rest"
+)
+
+// Codec is a REST codec set up for XML requests and responses, wrapping
+// collections in a <collection> element. By default it only allows request
+// bodies of up to a megabyte.
+var Codec rest.Codec = NewCodec("collection")
+
+func init() {
+	rest.RegisterCodec(Codec)
+}
+
+// Error is the response body of a failed request.
+type Error struct {
+	XMLName xml.Name `xml:"error"`
+	Status  int      `xml:"status,attr"`
+	Message string   `xml:",chardata"`
+}
+
+// NewCodec returns an XML codec that wraps slices in an element named root.
+func NewCodec(root string) rest.Codec {
+	return rest.Codec{
+		Accepts: "application/xml",
+		MaxSize: 1 << 20, // 1 megabyte
+		Marshal: func(v interface{}) ([]byte, error) {
+			return marshal(root, v)
+		},
+		Unmarshal:  xml.Unmarshal,
+		SplitArray: func(data []byte) ([][]byte, bool) { return splitArray(root, data) },
+		ErrorBody:  errorBody,
+	}
+}
+
+func marshal(root string, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	// nothing is sent as an empty root element, so the body is still a
+	// well-formed document
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		buf.WriteString("<" + root + "></" + root + ">")
+		return buf.Bytes(), nil
+	}
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Type().Elem().Kind() != reflect.Uint8 {
+		enc := xml.NewEncoder(&buf)
+		start := xml.StartElement{Name: xml.Name{Local: root}}
+		if err := enc.EncodeToken(start); err != nil {
+			return nil, err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+		if err := enc.EncodeToken(start.End()); err != nil {
+			return nil, err
+		}
+		if err := enc.Flush(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// splitArray splits a root element into the raw XML of its children.
+func splitArray(root string, data []byte) ([][]byte, bool) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		items [][]byte
+		depth int
+		start int64
+	)
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			// malformed, or ended before the root element closed
+			return nil, false
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 && tok.Name.Local != root {
+				return nil, false
+			}
+			if depth == 1 {
+				start = offset
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 1 {
+				items = append(items, data[start:dec.InputOffset()])
+			}
+			if depth == 0 {
+				return items, true
+			}
+		}
+	}
+}
+
+func errorBody(statusCode int, err error) interface{} {
+	message := err.Error()
+	if statusCode >= 500 {
+		message = http.StatusText(statusCode)
+	}
+	return Error{Status: statusCode, Message: message}
+}
+
+// NewEndpoint returns a *rest.Endpoint configured to use XML.
+func NewEndpoint(name string) *rest.Endpoint {
+	return &rest.Endpoint{
+		GetCollection:  rest.UnimplementedCollectionHandler,
+		PostCollection: rest.UnimplementedCollectionHandler,
+
+		Get:    rest.UnimplementedHandler,
+		Head:   rest.UnimplementedHandler,
+		Put:    rest.UnimplementedHandler,
+		Post:   rest.UnimplementedHandler,
+		Delete: rest.UnimplementedHandler,
+
+		Codec:            Codec,
+		Name:             name,
+		StatusCodeLookup: map[error]int{},
+		Logger:           rest.IOLogger{Writer: os.Stdout},
+	}
+}
@@ -0,0 +1,169 @@
+package xmlrest
+
+import (
+	"testing"
+
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"rest"
+)
+
+type testT struct {
+	XMLName  xml.Name `xml:"yam"`
+	Yams     string   `xml:"yams"`
+	HasYams  bool     `xml:"has_yams"`
+	YamCount int      `xml:"yam_count"`
+}
+
+func TestNewEndpoint(t *testing.T) {
+	e := NewEndpoint("yams")
+	handler := e.Handler()
+
+	// with valid Accept
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/yams/1", nil)
+	r.Header.Set("Accept", "application/xml")
+	r.Header.Set("Content-Type", "application/xml")
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("With valid Accept: expected http return code %d, got %d",
+			http.StatusNotImplemented, w.Code)
+	}
+
+	// with invalid Accept
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "http://example.com/yams/1", nil)
+	r.Header.Set("Accept", "application/yams")
+	r.Header.Set("Content-Type", "application/yams")
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("With invalid Accept: expected http return code %d, got %d",
+			http.StatusNotAcceptable, w.Code)
+	}
+
+	// now prepare for an actual test
+	e.Post = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		var yamObject testT
+		expectedYamObject := testT{
+			XMLName: xml.Name{Local: "yam"},
+			Yams:    "YAMSYAMSYAMS",
+		}
+		if err := xml.Unmarshal(body, &yamObject); err != nil {
+			t.Fatalf("testPostHandler: Expected no error unmarshaling XML, got %s (body %s)", err, string(body))
+		} else if yamObject != expectedYamObject {
+			t.Errorf("testPostHandler: expected yamObject to be %+v, got %+v", expectedYamObject, yamObject)
+		}
+
+		// fiddle the yam object some
+		yamObject.YamCount = strings.Count(yamObject.Yams, "YAMS")
+		yamObject.HasYams = yamObject.YamCount > 0
+		return yamObject, nil
+	}
+
+	// encode test object
+	testRequestObject := testT{
+		Yams: "YAMSYAMSYAMS",
+	}
+	data, err := xml.Marshal(&testRequestObject)
+	if err != nil {
+		t.Fatalf("Error creating test request body via xml.Marshal: %s", err)
+	}
+
+	// with an actual XML request body via POST
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "http://example.com/yams/1", bytes.NewBuffer(data))
+	r.Header.Set("Accept", "application/xml")
+	r.Header.Set("Content-Type", "application/xml")
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("With a real live XML body: expected http return code %d, got %d",
+			http.StatusOK, w.Code)
+	}
+
+	// we also expect a slightly mutated version of our request object
+	var testResponseObject testT
+	if err := xml.NewDecoder(w.Body).Decode(&testResponseObject); err != nil {
+		t.Fatalf("Error decoding XML object from response body: %s", err)
+	}
+	if !testResponseObject.HasYams {
+		t.Errorf("Expected testResponseObject.HasYams to be true, got false")
+	}
+	if testResponseObject.YamCount != 3 {
+		t.Errorf("Expected testResponseObject.YamCount to equal %d, got %d", 3, testResponseObject.YamCount)
+	}
+}
+
+func TestCollectionRoot(t *testing.T) {
+	yams := []testT{{Yams: "garnet"}, {Yams: "jewel"}}
+	for root, codec := range map[string]rest.Codec{"collection": Codec, "yams": NewCodec("yams")} {
+		data, err := codec.Marshal(yams)
+		if err != nil {
+			t.Fatalf("Error marshaling collection: %s", err)
+		}
+		expected := xml.Header + "<" + root + "><yam><yams>garnet</yams><has_yams>false</has_yams><yam_count>0</yam_count></yam>" +
+			"<yam><yams>jewel</yams><has_yams>false</has_yams><yam_count>0</yam_count></yam></" + root + ">"
+		if string(data) != expected {
+			t.Errorf("Expected %s, got %s", expected, data)
+		}
+
+		items, ok := codec.SplitArray(data)
+		if !ok || len(items) != 2 {
+			t.Fatalf("Expected collection to split into 2 items, got %d (ok %t)", len(items), ok)
+		}
+		var second testT
+		if err := codec.Unmarshal(items[1], &second); err != nil || second.Yams != "jewel" {
+			t.Errorf("Expected second item to be jewel, got %+v (%v)", second, err)
+		}
+	}
+
+	if _, ok := Codec.SplitArray([]byte("<yam><yams>garnet</yams></yam>")); ok {
+		t.Errorf("Expected a single object not to split")
+	}
+	if data, _ := Codec.Marshal([]testT{}); string(data) != xml.Header+"<collection></collection>" {
+		t.Errorf("Expected an empty collection element, got %s", data)
+	}
+	for _, v := range []interface{}{nil, (*testT)(nil)} {
+		if data, _ := Codec.Marshal(v); string(data) != xml.Header+"<collection></collection>" {
+			t.Errorf("Expected nil %T to be an empty collection element, got %s", v, data)
+		}
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	errYamsMissing := errors.New("No yams")
+	e := NewEndpoint("yams")
+	e.StatusCodeLookup[errYamsMissing] = http.StatusNotFound
+	e.Get = func(r *http.Request, id string, body []byte) (interface{}, error) {
+		if id == "1" {
+			return nil, errYamsMissing
+		}
+		return nil, errors.New("database on fire")
+	}
+	handler := e.Handler()
+
+	for id, expected := range map[string]Error{
+		"1": {Status: http.StatusNotFound, Message: "No yams"},
+		"2": {Status: http.StatusInternalServerError, Message: "Internal Server Error"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://example.com/yams/"+id, nil)
+		r.Header.Set("Accept", "application/xml")
+		handler.ServeHTTP(w, r)
+
+		var got Error
+		if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Error decoding XML error body %q: %s", w.Body.String(), err)
+		}
+		if w.Code != expected.Status || got.Status != expected.Status || got.Message != expected.Message {
+			t.Errorf("Expected %d %+v, got %d %+v", expected.Status, expected, w.Code, got)
+		}
+	}
+}